@@ -2,12 +2,17 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net/url"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/playmixer/bot-note/dateparse"
 	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/quickadd"
+	"github.com/playmixer/bot-note/schedule"
+	"github.com/playmixer/bot-note/tagquery"
 	tg "github.com/playmixer/telegram-bot-api/v3"
 )
 
@@ -15,82 +20,127 @@ const (
 	LIST_PAGE_SIZE = 5
 )
 
+// Коды маршрутов в данных кнопок, см. пакет callback. Коды короткие: данные кнопки не длиннее 64 байт
 const (
-	CB_ROUTE_LIST_ALL        = "_list_all"
-	CB_ROUTE_LIST_PREV       = "_list_prev"
-	CB_ROUTE_LIST_NEXT       = "_list_next"
-	CB_ROUTE_SHOW            = "_show"
-	CB_ROUTE_TAG_SHOW        = "_show_by_tag"
-	CB_ROUTE_NEW             = "_new"
-	CB_ROUTE_EDIT            = "_edit_"
-	CB_ROUTE_EDITING         = "_editing"
-	CB_ROUTE_DEL             = "_delete"
-	CB_ROUTE_SEARCH_TAG      = "_search_by_tag_all"
-	CB_ROUTE_SEARCH_TAG_PREV = "_search_by_tag_prev"
-	CB_ROUTE_SEARCH_TAG_NEXT = "_search_by_tag_next"
+	CB_ROUTE_LIST_ALL        = "l"
+	CB_ROUTE_LIST_PREV       = "lp"
+	CB_ROUTE_LIST_NEXT       = "ln"
+	CB_ROUTE_SHOW            = "s"
+	CB_ROUTE_TAG_SHOW        = "st"
+	CB_ROUTE_NEW             = "n"
+	CB_ROUTE_EDIT            = "e"
+	CB_ROUTE_EDITING         = "ed"
+	CB_ROUTE_DEL             = "d"
+	CB_ROUTE_SEARCH_TAG      = "t"
+	CB_ROUTE_SEARCH_TAG_PREV = "tp"
+	CB_ROUTE_SEARCH_TAG_NEXT = "tn"
+	CB_ROUTE_REMIND          = "r"
+	CB_ROUTE_REMINDER_PAUSE  = "rp"
+	CB_ROUTE_REMINDER_RESUME = "rr"
+	CB_ROUTE_REMINDER_DEL    = "rd"
+	CB_ROUTE_SETTINGS        = "cfg"
+	CB_ROUTE_SET_TIMEZONE    = "tz"
+	CB_ROUTE_SET_LANGUAGE    = "lng"
+	CB_ROUTE_SET_PAGE_SIZE   = "ps"
+	CB_ROUTE_SET_SORT        = "so"
+	CB_ROUTE_SEARCH_SHOW     = "sf"
+	CB_ROUTE_SEARCH_PREV     = "fp"
+	CB_ROUTE_SEARCH_NEXT     = "fn"
+	CB_ROUTE_TAG_TOGGLE      = "tt"
+	CB_ROUTE_TAG_APPLY       = "ta"
+	CB_ROUTE_TAG_RESET       = "tr"
+	CB_ROUTE_WIZARD          = "w"
+	CB_ROUTE_CHECK_TOGGLE    = "ct"
+	CB_ROUTE_CHECK_ADD       = "ca"
+	CB_ROUTE_CHECK_CLEAR     = "cc"
+	CB_ROUTE_HISTORY         = "h"
+	CB_ROUTE_REVISION        = "hv"
+	CB_ROUTE_RESTORE         = "hr"
+	CB_ROUTE_TRASH           = "tb"
+	CB_ROUTE_UNTRASH         = "u"
+	CB_ROUTE_PURGE           = "pg"
 )
 
-func start(update tg.UpdateResult, bot *tg.TelegramBot) {
+const (
+	REMINDER_TIME_LAYOUT = "02.01.2006 15:04"
+	HISTORY_LIMIT        = 10 // сколько последних ревизий показывать в истории заметки
+	TAGS_HELP            = "Отметьте теги и нажмите «Показать», чтобы найти заметки со всеми отмеченными тегами.\nСложные запросы: /search #work #go -#archived, /search (#a | #b) #c"
+)
+
+func start(r *Request) {
+	err := CacheUserStore(r.ChatId)
+	if err != nil {
+		log.ERROR("caching user store error:", err.Error())
+		return
+	}
+	// состояние начато заново, дальше работаем с ним, иначе withState затрёт его прежним
+	*r.User = store.Get(r.ChatId)
+	user := r.User
+	user.Status = USER_STATUS_NONE
+
 	keyboard := tg.InlineMarkup()
 
-	btnList := *keyboard.Button("Список заметок")
-	btnList.SetCallbackData(CB_ROUTE_LIST_ALL)
+	btnList := *keyboard.Button(user.T("Список заметок"))
+	btnList.SetCallbackData(user.Callback(CB_ROUTE_LIST_ALL))
 
-	btnAdd := *keyboard.Button("Новая заметка")
-	btnAdd.SetCallbackData(CB_ROUTE_NEW)
+	btnAdd := *keyboard.Button(user.T("Новая заметка"))
+	btnAdd.SetCallbackData(user.Callback(CB_ROUTE_NEW))
 
 	keyboard.Add([]tg.InlineKeyboardButton{btnList, btnAdd})
 
-	msg := bot.SendMessage(update.Message.Chat.Id, "Бот для заметок, введите команду:\n/new - добавить заметку\n/list - увидеть свои заметки", keyboard.Option())
+	msg := r.Bot.SendMessage(r.ChatId, user.T("Бот для заметок, введите команду:\n/new - добавить заметку\n/cancel - отменить ввод\n/list - увидеть свои заметки\n/tags - ваши теги\n/reminders - ваши напоминания\n/search - поиск по заметкам\n/trash - корзина\n/settings - настройки"), keyboard.Option())
 	if !msg.Ok {
 		log.ERROR(msg.Description)
 		return
 	}
-	user := store.Get(update.Message.From.Id)
-	user.Status = USER_STATUS_NONE
-	defer func() {
-		store.Set(update.Message.From.Id, user)
-	}()
-
-	err := CacheUserStore(update.Message.From.Id)
-	if err != nil {
-		log.ERROR("caching user store error:", err.Error())
-		return
-	}
 
 	log.DEBUG(fmt.Sprint(user))
 }
 
-func list(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
+// cancelDialog команда /cancel, выходит из любого ввода и сбрасывает черновик
+func cancelDialog(r *Request) {
+	user := r.User
+
+	if !cancelWizard(user) && user.Status == USER_STATUS_NONE {
+		msg := r.Bot.SendMessage(r.ChatId, user.T("Нечего отменять"))
+		if !msg.Ok {
+			log.ERROR(msg.Description)
+		}
 		return
 	}
-	user := store.Get(update.Message.From.Id)
-	defer func() {
-		store.Set(update.Message.From.Id, user)
-	}()
+	user.Status = USER_STATUS_NONE
+	user.RemindNoteId = 0
+	log.INFO(fmt.Sprintf("%v canceled input", r.ChatId))
+
+	msg := r.Bot.SendMessage(r.ChatId, user.T("Действие отменено"))
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+func list(r *Request) {
+	user := r.User
 
 	options := []tg.MessageOption{
 		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
 	}
 
-	text := validateString("Загружаю...")
-	msg := bot.SendMessage(update.Message.From.Id, text, options...)
+	text := validateString(user.T("Загружаю..."))
+	msg := r.Bot.SendMessage(r.ChatId, text, options...)
 	if !msg.Ok {
 		log.ERROR("error send message", text)
 		log.ERROR(msg.Description)
 		return
 	}
 
-	keyboard, err := KeyboardList(&user)
+	keyboard, err := KeyboardList(user)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
 	}
 
-	text = "*Список заметок:*"
-	msg = bot.EditMessage(
-		update.Message.Chat.Id,
+	text = user.T("*Список заметок:*")
+	msg = r.Bot.EditMessage(
+		r.ChatId,
 		msg.Result.MessageId,
 		validateString(text),
 		keyboard.Option(),
@@ -105,250 +155,345 @@ func list(update tg.UpdateResult, bot *tg.TelegramBot) {
 	log.DEBUG(fmt.Sprint(user))
 }
 
-func new(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
-		return
-	}
-	log.INFO(fmt.Sprintf("user %v use command add", update.Message.From.Id))
-	msg := bot.SendMessage(update.Message.Chat.Id, "Введите название заметки:")
-	if !msg.Ok {
-		log.ERROR(msg.Description)
-		return
-	}
+func new(r *Request) {
+	user := r.User
 
-	user := store.Get(update.Message.From.Id)
-	defer func() {
-		store.Set(update.Message.From.Id, user)
-	}()
-	user.Status = USER_STATUS_NEW
+	log.INFO(fmt.Sprintf("user %v use command add", r.ChatId))
 
+	user.Note = Note{}
+	startWizard(user, newNoteWizard, "")
+	wizardPrompt(user, r.ChatId, r.Bot)
 }
 
-func echo(update tg.UpdateResult, bot *tg.TelegramBot) {
-	var err error
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
+func echo(r *Request) {
+	user := r.User
 
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
-		return
-	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
-	if update.CallbackQuery.Id != "" {
-		log.INFO(fmt.Sprintf("%v callback text %s", update.CallbackQuery.From.Id, update.CallbackQuery.Data))
-		return
+	if shared, ok := sharedMessageOf(r.Update); ok {
+		if attachment, ok := shared.Attachment(); ok && activeWizard(user) == editNoteWizard {
+			attachToNote(ctx, user, r.ChatId, attachment, r.Bot)
+			return
+		}
+		if shared.Shared() && (shared.Forwarded() || user.Status == USER_STATUS_NONE) {
+			saveSharedNote(ctx, user, r.ChatId, shared, r.Bot)
+			return
+		}
 	}
 
-	user := store.Get(update.Message.From.Id)
-	defer func() {
-		store.Set(update.Message.From.Id, user)
-	}()
-
 	if user.Status == USER_STATUS_NONE {
+		if quickadd.Is(r.Update.Message.Text) {
+			quickAddNote(ctx, user, r.ChatId, r.Update.Message.Text, r.Bot)
+			return
+		}
+		searchNotes(user, r.ChatId, r.Update.Message.Text, r.Bot)
 		return
 	}
 
-	keyboard, err := KeyboardNewNote(&user)
-	if err != nil {
-		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
-		return
-	}
-	keyboardEdit, err := KeyboardEditNote(&user)
-	if err != nil {
-		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+	if user.Status == USER_STATUS_WIZARD {
+		wizardInput(ctx, user, r.ChatId, r.Update.Message.Text, r.Bot)
 		return
 	}
 
 	switch user.Status {
-	case USER_STATUS_NEW:
-		user.Add(update.Message.Text)
-		user.Status = USER_STATUS_NEW_URL
-		log.DEBUG(fmt.Sprintf("%v set name %s", update.Message.From.Id, update.Message.Text))
-
-		bot.SendMessage(update.Message.Chat.Id, "Введите ссылку:", keyboard.Option())
-
-	case USER_STATUS_NEW_URL:
-		_, err := url.ParseRequestURI(update.Message.Text)
-		if err != nil {
-			bot.SendMessage(update.Message.Chat.Id, "Не корректная ссылка, введите ссылку:", keyboard.Option())
+	case USER_STATUS_REMIND:
+		var fireAt time.Time
+		repeat := ""
+		text := strings.TrimSpace(r.Update.Message.Text)
+
+		sched, err := schedule.Parse(text)
+		switch {
+		case err == nil:
+			repeat = sched.String()
+			fireAt = sched.Next(time.Now().In(user.Location()))
+		case errors.Is(err, schedule.ErrNotSchedule):
+			fireAt, err = dateparse.Parse(text, time.Now().In(user.Location()))
+		}
+		if err != nil || fireAt.IsZero() || fireAt.Before(time.Now()) {
+			r.Bot.SendMessage(r.ChatId, user.T("Не удалось разобрать дату, попробуйте так: \"завтра в 10\", \"через 2 часа\", \"в пятницу 18:30\", \"15.11 9:00\" или \"ежедневно в 10:00\":"))
 			return
 		}
-		user.AddUrl(update.Message.Text)
-		user.Status = USER_STATUS_NEW_DESCRIPTION
-		log.INFO(fmt.Sprintf("%v set url %s", update.Message.From.Id, update.Message.Text))
-
-		bot.SendMessage(update.Message.Chat.Id, "Добавьте описание:", keyboard.Option())
-
-	case USER_STATUS_NEW_DESCRIPTION:
-		user.AddDescription(update.Message.Text)
-		user.Status = USER_STATUS_NEW_TAGS
-		log.INFO(fmt.Sprintf("%v set description %s", update.Message.From.Id, update.Message.Text))
-
-		bot.SendMessage(update.Message.Chat.Id, "Добавьте теги (через пробел):", keyboard.Option())
 
-	case USER_STATUS_NEW_TAGS:
-		tags := strings.Split(update.Message.Text, " ")
-		user.AddTags(tags)
-		user.Status = USER_STATUS_NONE
-		log.INFO(fmt.Sprintf("%v set tags %s", update.Message.From.Id, update.Message.Text))
-
-		err = models.NewNote(ctx, user.Id, user.Note.Name, user.Note.URL, user.Note.Description, user.Note.Tags)
-		if err != nil {
-			log.ERROR(err.Error())
-			bot.SendMessage(update.Message.Chat.Id, "Ошибка на сервере")
+		_, err = storage.NewReminder(ctx, user.Id, user.RemindNoteId, fireAt, repeat)
+		if errors.Is(err, models.ErrNotFound) {
+			user.Status = USER_STATUS_NONE
+			user.RemindNoteId = 0
+			r.Bot.SendMessage(r.ChatId, user.T("Заметка не найдена"))
 			return
 		}
-		err = user.SaveNote()
 		if err != nil {
-			log.ERROR(err.Error())
-			bot.SendMessage(update.Message.Chat.Id, "Ошибка добавления заметки")
+			log.ERROR(fmt.Sprintf("%v database error: %e", r.ChatId, err))
+			r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 			return
 		}
-		log.INFO(fmt.Sprintf("%v saved note", update.Message.Chat.Id))
+		user.Status = USER_STATUS_NONE
+		user.RemindNoteId = 0
+		log.INFO(fmt.Sprintf("%v set reminder at %s, repeat %q", r.ChatId, fireAt, repeat))
 
-		bot.SendMessage(update.Message.Chat.Id, "Заметка сохранена")
+		text = fmt.Sprintf(user.T("Напоминание установлено на %s"), fireAt.In(user.Location()).Format(REMINDER_TIME_LAYOUT))
+		if repeat != "" {
+			text += fmt.Sprintf(user.T(", повтор %s"), sched.Describe(user.Settings.Language))
+		}
+		r.Bot.SendMessage(r.ChatId, text)
 		return
 
-	case USER_STATUS_EDIT:
-		user.Add(update.Message.Text)
-		user.Status = USER_STATUS_EDIT_URL
-		log.DEBUG(fmt.Sprintf("%v set name %s", update.Message.From.Id, update.Message.Text))
-
-		bot.SendMessage(update.Message.Chat.Id, "Введите ссылку:", keyboardEdit.Option())
-		return
-	case USER_STATUS_EDIT_URL:
-		_, err := url.ParseRequestURI(update.Message.Text)
+	case USER_STATUS_SETTINGS_TIMEZONE:
+		name := strings.TrimSpace(r.Update.Message.Text)
+		loc, err := time.LoadLocation(name)
+		if err != nil || name == "" || strings.EqualFold(name, "local") {
+			r.Bot.SendMessage(r.ChatId, user.T("Неизвестный часовой пояс, отправьте название, например Europe/Moscow:"))
+			return
+		}
+		user.Settings.Timezone = loc.String()
+		err = storage.SetUserSettings(ctx, user.Settings)
 		if err != nil {
-			bot.SendMessage(update.Message.Chat.Id, "Не корректная ссылка, введите ссылку:", keyboardEdit.Option())
+			log.ERROR(fmt.Sprintf("%v database error: %e", r.ChatId, err))
+			r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 			return
 		}
-		user.AddUrl(update.Message.Text)
-		user.Status = USER_STATUS_EDIT_DESCRIPTION
-		log.DEBUG(fmt.Sprintf("%v set url %s", update.Message.From.Id, update.Message.Text))
+		user.Status = USER_STATUS_NONE
 
-		bot.SendMessage(update.Message.Chat.Id, "Введите описание:", keyboardEdit.Option())
+		keyboard := KeyboardSettings(user)
+		r.Bot.SendMessage(r.ChatId, fmt.Sprintf(user.T("Часовой пояс установлен: %s"), loc.String()), keyboard.Option())
 		return
+	}
 
-	case USER_STATUS_EDIT_DESCRIPTION:
-		user.AddDescription(update.Message.Text)
-		user.Status = USER_STATUS_EDIT_TAGS
-		log.DEBUG(fmt.Sprintf("%v set description %s", update.Message.From.Id, update.Message.Text))
+}
+
+// userNote заметка пользователя по id из callback data. Если её нет или она чужая,
+// пользователь получает сообщение об этом и ok - false
+func userNote(user *User, chatId, noteId int64, bot *tg.TelegramBot) (note models.Note, ok bool) {
+	note, err := storage.GetNote(user.Id, noteId)
+	if errors.Is(err, models.ErrNotFound) {
+		log.INFO(fmt.Sprintf("%v note %v not found", user.Id, noteId))
+		bot.SendMessage(chatId, user.T("Заметка не найдена"))
+		return note, false
+	}
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка поиска заметки"))
+		return note, false
+	}
+	return note, true
+}
 
-		bot.SendMessage(update.Message.Chat.Id, "Введите теги (через пробел):", keyboardEdit.Option())
+func cbShow(r *Request) {
+	user := r.User
+
+	note, ok := userNote(user, r.ChatId, r.Data.Int(0), r.Bot)
+	if !ok {
 		return
-	case USER_STATUS_EDIT_TAGS:
-		tags := strings.Split(update.Message.Text, " ")
-		user.AddTags(tags)
-		user.Status = USER_STATUS_NONE
-		log.DEBUG(fmt.Sprintf("%v set tags %s", update.Message.From.Id, update.Message.Text))
-
-		err := models.UpdNote(ctx, models.Note{
-			Id:          user.Note.Id,
-			Title:       user.Note.Name,
-			UserId:      user.Id,
-			Description: user.Note.Description,
-			Url:         user.Note.URL,
-		}, tags)
-		if err != nil {
-			log.ERROR(fmt.Sprintf("%v database erros: %e", update.Message.From.Id, err))
-			return
-		}
-		bot.SendMessage(update.Message.Chat.Id, "Заметка обновлена")
+	}
+
+	user.ShowRoute = r.Data.Route
+	text, keyboard, attachments, err := NoteCard(user, note, r.Data.Route)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
+		return
+	}
+
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		validateString(text),
+		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
+		keyboard.Option(),
+	)
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 		return
 	}
 
+	if len(attachments) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err = sendAttachments(ctx, r.Bot, r.ChatId, attachments); err != nil {
+			log.ERROR(fmt.Sprintf("%v send attachments error: %s", user.Id, err))
+		}
+	}
 }
 
-func cbShow(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
+// cbChecklist отметка пунктов списка, очистка отмеченных и добавление новых пунктов.
+// Карточка заметки перерисовывается в том же сообщении
+func cbChecklist(r *Request) {
+	user := r.User
+
+	note, ok := userNote(user, r.ChatId, r.Data.Int(0), r.Bot)
+	if !ok {
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
 
-	if user.Id == 0 {
-		log.ERROR("user not found")
+	var err error
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	switch r.Data.Route {
+	case CB_ROUTE_CHECK_ADD:
+		user.Note = Note{Id: note.Id}
+		startWizard(user, checklistWizard, "")
+		wizardPrompt(user, r.ChatId, r.Bot)
 		return
+	case CB_ROUTE_CHECK_TOGGLE:
+		err = storage.ToggleChecklistItem(ctx, user.Id, note.Id, r.Data.Int(1))
+	case CB_ROUTE_CHECK_CLEAR:
+		err = storage.ClearDoneChecklistItems(ctx, user.Id, note.Id)
 	}
-	var cb string
-	var noteId int64
-	_, err := fmt.Sscan(update.CallbackQuery.Data, &cb, &noteId)
-	if err != nil {
-		log.ERROR(fmt.Sprintf("%v error: %e", user.Id, err))
-	}
-
-	note, err := models.GetNote(noteId)
-	if err != nil {
+	// пункт уже удалён другой кнопкой - карточка просто перерисуется
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
 		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
+		return
 	}
 
-	tags, err := models.GetTagsByNoteId(note.Id)
+	text, keyboard, _, err := NoteCard(user, note, user.ShowRouteOrDefault())
 	if err != nil {
-		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
+		return
 	}
-
-	tagsString := make([]string, len(tags))
-	for i, _t := range tags {
-		tagsString[i] = _t.Title
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		validateString(text),
+		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
+		keyboard.Option(),
+	)
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 	}
+}
 
-	text := fmt.Sprintf("*Название:* %s \n*Ссылка:* %s \n*Описание:* %s \n*Теги:* %s",
-		note.Title, note.Url, note.Description, strings.Join(tagsString, " "))
+// cbHistory история изменений заметки, просмотр ревизии и восстановление из неё.
+// Восстановление - обычное изменение заметки, поэтому само попадает в историю
+func cbHistory(r *Request) {
+	user := r.User
 
+	note, ok := userNote(user, r.ChatId, r.Data.Int(0), r.Bot)
+	if !ok {
+		return
+	}
+
+	var err error
+	var text string
 	var keyboard tg.InlineKeyboardMarkup
-	switch cb {
-	case CB_ROUTE_TAG_SHOW:
-		keyboard, err = KeyboardListByTag(&user, user.SearchTag)
-		if err != nil {
-			log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
-			return
-		}
-	default:
-		keyboard, err = KeyboardList(&user)
-		if err != nil {
-			log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
-			return
-		}
+	switch r.Data.Route {
+	case CB_ROUTE_HISTORY:
+		text, keyboard, err = historyView(user, note)
+	case CB_ROUTE_REVISION:
+		text, keyboard, err = revisionView(user, note, r.Data.Int(1))
+	case CB_ROUTE_RESTORE:
+		text, keyboard, err = restoreRevision(user, note, r.Data.Int(1))
+	}
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
+		return
 	}
 
-	msg := bot.EditMessage(update.CallbackQuery.From.Id, update.CallbackQuery.Message.MessageId,
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
 		validateString(text),
 		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
 		keyboard.Option(),
 	)
 	if !msg.Ok {
 		log.ERROR(msg.Description)
-		return
 	}
 }
 
-func cbChangePage(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
-		return
+// historyView список последних ревизий заметки
+func historyView(user *User, note models.Note) (string, tg.InlineKeyboardMarkup, error) {
+	revisions, err := storage.GetNoteRevisions(user.Id, note.Id, HISTORY_LIMIT)
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+	tags, err := storage.GetTagsByNoteId(user.Id, note.Id)
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
 
-	if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_LIST_PREV) && user.NotePage > 0 {
+	text := fmt.Sprintf(user.T("*История:* %s"), escapeMarkdown(note.Title))
+	if len(revisions) == 0 {
+		text += "\n" + user.T("Заметка ещё не менялась")
+	}
+	return text, KeyboardHistory(user, note, tagTitles(tags), revisions), nil
+}
+
+// revisionView заметка в том виде, какой она была в ревизии, и что в ней поменялось потом
+func revisionView(user *User, note models.Note, revisionId int64) (string, tg.InlineKeyboardMarkup, error) {
+	revision, err := storage.GetNoteRevision(user.Id, note.Id, revisionId)
+	if errors.Is(err, models.ErrNotFound) {
+		return historyView(user, note)
+	}
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+
+	revisions, err := storage.GetNoteRevisions(user.Id, note.Id, HISTORY_LIMIT)
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+	tags, err := storage.GetTagsByNoteId(user.Id, note.Id)
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+	// следующее состояние - более новая ревизия или сама заметка
+	next, nextTags := note, tagTitles(tags)
+	for _, r := range revisions {
+		if r.Id <= revision.Id {
+			break
+		}
+		next, nextTags = r.Note(), r.Tags
+	}
+
+	revisionTags := make([]models.Tag, len(revision.Tags))
+	for i, tag := range revision.Tags {
+		revisionTags[i] = models.Tag{Title: tag}
+	}
+	text := fmt.Sprintf(user.T("*Версия от %s*"), revision.CreatedAt.In(user.Location()).Format(REMINDER_TIME_LAYOUT)) + " \n" +
+		NoteText(user.Settings.Language, revision.Note(), revisionTags) + " \n" +
+		fmt.Sprintf(user.T("*Изменено после:* %s"), RevisionDiff(user, revision, next, nextTags))
+	return text, KeyboardRevision(user, revision), nil
+}
+
+// restoreRevision возвращает заметке название, ссылку, описание и теги из ревизии
+func restoreRevision(user *User, note models.Note, revisionId int64) (string, tg.InlineKeyboardMarkup, error) {
+	revision, err := storage.GetNoteRevision(user.Id, note.Id, revisionId)
+	if errors.Is(err, models.ErrNotFound) {
+		return historyView(user, note)
+	}
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	restored := revision.Note()
+	restored.UserId = user.Id
+	if err = storage.UpdNote(ctx, restored, revision.Tags); err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+	note, err = storage.GetNote(user.Id, note.Id)
+	if err != nil {
+		return "", tg.InlineKeyboardMarkup{}, err
+	}
+
+	text, keyboard, _, err := NoteCard(user, note, user.ShowRouteOrDefault())
+	return user.T("Заметка восстановлена") + " \n" + text, keyboard, err
+}
+
+func cbChangePage(r *Request) {
+	user := r.User
+
+	if r.Data.Route == CB_ROUTE_LIST_PREV && user.NotePage > 0 {
 		user.NotePage -= 1
 	}
-	if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_LIST_NEXT) {
+	if r.Data.Route == CB_ROUTE_LIST_NEXT {
 		user.NotePage += 1
 	}
 
-	keyboard, err := KeyboardList(&user)
+	keyboard, err := KeyboardList(user)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
 		return
 	}
-	msg := bot.EditMessage(update.CallbackQuery.From.Id, update.CallbackQuery.Message.MessageId,
-		validateString(update.CallbackQuery.Message.Text),
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		escapeMarkdown(r.Update.CallbackQuery.Message.Text),
 		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
 		keyboard.Option(),
 	)
@@ -358,25 +503,19 @@ func cbChangePage(update tg.UpdateResult, bot *tg.TelegramBot) {
 	}
 }
 
-func cbList(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
-		return
-	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
+func cbList(r *Request) {
+	user := r.User
+
 	log.DEBUG(fmt.Sprint(user))
-	keyboard, err := KeyboardList(&user)
+	keyboard, err := KeyboardList(user)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
 		return
 	}
 
-	text := "*Список заметок:*"
-	msg := bot.SendMessage(
-		update.CallbackQuery.From.Id,
+	text := user.T("*Список заметок:*")
+	msg := r.Bot.SendMessage(
+		r.ChatId,
 		validateString(text),
 		keyboard.Option(),
 		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
@@ -389,318 +528,654 @@ func cbList(update tg.UpdateResult, bot *tg.TelegramBot) {
 
 }
 
-func cbNew(update tg.UpdateResult, bot *tg.TelegramBot) {
+func cbNew(r *Request) {
+	user := r.User
+
 	log.DEBUG("route new")
-	var err error
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+	state := r.Data.String(0)
+	switch state {
+	case "url", "description", "tags":
+		if activeWizard(user) != newNoteWizard {
+			user.Note = Note{}
+		}
+		startWizard(user, newNoteWizard, state)
+	case "save":
+		wizardComplete(ctx, user, newNoteWizard, r.ChatId, r.Bot)
 		return
+	default:
+		user.Note = Note{}
+		startWizard(user, newNoteWizard, "")
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
+	wizardPrompt(user, r.ChatId, r.Bot)
+}
 
-	if update.CallbackQuery.Id == "" {
-		log.INFO(fmt.Sprintf("%v callback text %s", update.CallbackQuery.From.Id, update.CallbackQuery.Data))
-		return
-	}
+func cbEdit(r *Request) {
+	user := r.User
 
-	_qb := ""
-	state := ""
+	step := r.Data.String(1) // шаг мастера, если нужно сразу поправить одно поле
 
-	_, err = fmt.Sscan(update.CallbackQuery.Data, &_qb, &state)
+	note, ok := userNote(user, r.ChatId, r.Data.Int(0), r.Bot)
+	if !ok {
+		return
+	}
+	user.Note.Id = note.Id
+	user.Note.Name = note.Title
+	user.Note.URL = note.Url
+	user.Note.Description = note.Description
+	tags, err := storage.GetTagsByNoteId(user.Id, note.Id)
 	if err != nil {
-		log.WARN(fmt.Sprintf("%v cant sscan callback data: `%s`, error: %e", update.CallbackQuery.From.Id, update.CallbackQuery.Data, err))
+		log.ERROR(fmt.Sprintf("%v database error: %e", r.ChatId, err))
+		return
 	}
-
-	keyboard, err := KeyboardNewNote(&user)
+	user.Note.Tags = make([]string, len(tags))
+	for i, tag := range tags {
+		user.Note.Tags[i] = tag.Title
+	}
+	if step != "" {
+		if err = startWizard(user, editNoteWizard, step); err != nil {
+			log.WARN(fmt.Sprintf("%v unknown edit step in callback data %s", r.ChatId, r.Update.CallbackQuery.Data))
+			return
+		}
+		wizardPrompt(user, r.ChatId, r.Bot)
+		return
+	}
+	startWizard(user, editNoteWizard, "")
+	if note.Description == "" {
+		note.Description = "-"
+	}
+	if note.Url == "" {
+		note.Url = "-"
+	}
+	if note.Title == "" {
+		note.Title = "-"
+	}
+	escaped := make([]string, len(user.Note.Tags))
+	for i, tag := range user.Note.Tags {
+		escaped[i] = escapeMarkdown(tag)
+	}
+	text := fmt.Sprintf(user.T("*Название:* _%s_ \n*Ссылка:* _%s_ \n*Описание:* _%s_ \n*Теги:* _ %s _"),
+		escapeMarkdown(note.Title), escapeMarkdown(note.Url), escapeMarkdown(note.Description), strings.Join(escaped, " "))
+	keyboard, err := KeyboardEditNote(user)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
 		return
 	}
 
-	switch state {
-	case "url":
-		user.Status = USER_STATUS_NEW_URL
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите ссылку:", keyboard.Option())
+	msg := r.Bot.SendMessage(r.ChatId, validateString(text),
+		keyboard.Option(),
+		tg.StyleMarkdown(tg.MessageStyleMarkdownV2))
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+func cbEditing(r *Request) {
+	user := r.User
+
+	if user.Note.Id == 0 {
+		msg := r.Bot.SendMessage(r.ChatId, user.T("Заметка не выбрана"))
 		if !msg.Ok {
 			log.ERROR(msg.Description)
 		}
 		return
-	case "description":
-		user.Status = USER_STATUS_NEW_DESCRIPTION
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Добавьте описание:", keyboard.Option())
+	}
+
+	switch r.Data.String(0) {
+	case "title", "url", "description", "tags":
+		startWizard(user, editNoteWizard, r.Data.String(0))
+		wizardPrompt(user, r.ChatId, r.Bot)
+	case "update":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		wizardComplete(ctx, user, editNoteWizard, r.ChatId, r.Bot)
+	}
+}
+
+// cbWizard кнопки "Назад", "Пропустить" и "Отмена" в пошаговых диалогах
+func cbWizard(r *Request) {
+	user := r.User
+
+	if activeWizard(user) == nil {
+		msg := r.Bot.SendMessage(r.ChatId, user.T("Нечего отменять"))
 		if !msg.Ok {
 			log.ERROR(msg.Description)
 		}
 		return
-	case "tags":
-		user.Status = USER_STATUS_NEW_TAGS
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Добавьте теги (через пробел):", keyboard.Option())
+	}
+
+	switch r.Data.String(0) {
+	case "back":
+		wizardBack(user, r.ChatId, r.Bot)
+	case "skip":
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+		wizardSkip(ctx, user, r.ChatId, r.Bot)
+	case "cancel":
+		cancelWizard(user)
+		log.INFO(fmt.Sprintf("%v wizard canceled", r.ChatId))
+		msg := r.Bot.SendMessage(r.ChatId, user.T("Действие отменено"))
 		if !msg.Ok {
 			log.ERROR(msg.Description)
 		}
+	}
+}
+
+// cbDelete удаление заметки в корзину: сначала подтверждение, затем сообщение с кнопкой отмены
+func cbDelete(r *Request) {
+	user := r.User
+
+	noteId := r.Data.Int(0)
+	if noteId == 0 {
+		log.ERROR(fmt.Sprintf("not dound note id in data: %s", r.Update.CallbackQuery.Data))
 		return
-	case "save":
-		err = models.NewNote(ctx, user.Id, user.Note.Name, user.Note.URL, user.Note.Description, user.Note.Tags)
-		if err != nil {
-			log.ERROR(err.Error())
-			msg := bot.SendMessage(update.CallbackQuery.From.Id, "Ошибка на сервере")
-			if !msg.Ok {
-				log.ERROR(msg.Description)
-			}
-			return
-		}
-		err = user.SaveNote()
-		if err != nil {
-			log.ERROR(err.Error())
-			msg := bot.SendMessage(update.CallbackQuery.From.Id, "Ошибка добавления заметки")
-			if !msg.Ok {
-				log.ERROR(msg.Description)
-			}
-			return
-		}
-		log.INFO(fmt.Sprintf("%v saved note", update.CallbackQuery.From.Id))
+	}
+
+	note, ok := userNote(user, r.ChatId, noteId, r.Bot)
+	if !ok {
+		return
+	}
 
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Заметка сохранена")
+	switch r.Data.String(1) {
+	case "":
+		keyboard := KeyboardDeleteConfirm(user, note)
+		msg := r.Bot.SendMessage(r.ChatId, fmt.Sprintf(user.T("Удалить заметку \"%s\"?"), note.Title), keyboard.Option())
+		if !msg.Ok {
+			log.ERROR(msg.Description)
+		}
+		return
+	case DELETE_CANCEL_ARG:
+		msg := r.Bot.EditMessage(r.ChatId, r.MessageId(), user.T("Удаление отменено"))
 		if !msg.Ok {
 			log.ERROR(msg.Description)
-			return
 		}
-		user.Status = USER_STATUS_NONE
 		return
-
 	}
 
-	user.Status = USER_STATUS_NEW
+	err := storage.DeleteNote(user.Id, noteId)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("database error: %e", err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка удаления заметки"))
+		return
+	}
 
-	msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите название:")
+	keyboard := KeyboardDeleted(user, note)
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		fmt.Sprintf(user.T("Заметка \"%s\" удалена"), note.Title), keyboard.Option())
 	if !msg.Ok {
 		log.ERROR(msg.Description)
-		return
 	}
-
 }
 
-func cbEdit(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+func trash(r *Request) {
+	user := r.User
+
+	keyboard, err := KeyboardTrash(user)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
 
-	qb := ""
-	noteId := 0
+	msg := r.Bot.SendMessage(r.ChatId, TrashText(user, len(keyboard.InlineKeyboard) == 0), keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+		return
+	}
+}
+
+// cbTrash восстановление заметки из корзины и удаление навсегда.
+// Восстановление из сообщения об удалении отменяет удаление, из списка корзины - перерисовывает список
+func cbTrash(r *Request) {
+	user := r.User
 
-	fmt.Sscan(update.CallbackQuery.Data, &qb, &noteId)
-	log.DEBUG(fmt.Sprintf("%s %v", qb, noteId))
+	noteId, arg := r.Data.Int(0), r.Data.String(1)
 
-	user.Status = USER_STATUS_EDIT
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
 
-	note, err := models.GetNote(int64(noteId))
+	var err error
+	switch r.Data.Route {
+	case CB_ROUTE_UNTRASH:
+		_, err = storage.RestoreNote(ctx, user.Id, noteId)
+		if errors.Is(err, models.ErrNotFound) {
+			r.Bot.SendMessage(r.ChatId, user.T("Заметка не найдена"))
+			return
+		}
+		if err == nil && arg != TRASH_LIST_ARG {
+			// повторное нажатие "Отменить" тоже покажет восстановленную заметку
+			note, ok := userNote(user, r.ChatId, noteId, r.Bot)
+			if !ok {
+				return
+			}
+			msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+				fmt.Sprintf(user.T("Заметка \"%s\" восстановлена"), note.Title))
+			if !msg.Ok {
+				log.ERROR(msg.Description)
+			}
+			return
+		}
+	case CB_ROUTE_PURGE:
+		if arg != DELETE_CONFIRM_ARG {
+			purgeConfirm(user, r.ChatId, r.MessageId(), noteId, r.Bot)
+			return
+		}
+		err = storage.PurgeNote(ctx, user.Id, noteId)
+	}
 	if err != nil {
-		log.ERROR(fmt.Sprintf("%v not found note by callback data %s, error: %e", update.CallbackQuery.From.Id, update.CallbackQuery.Data, err))
-		bot.SendMessage(update.CallbackQuery.From.Id, "Ошибка поиска заметки")
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 		return
 	}
-	user.Note.Id = note.Id
-	user.Note.Name = note.Title
-	user.Note.URL = note.Url
-	user.Note.Description = note.Description
-	tags, err := models.GetTagsByNoteId(note.Id)
+
+	keyboard, err := KeyboardTrash(user)
 	if err != nil {
-		log.ERROR(fmt.Sprintf("%v database error: %e", update.CallbackQuery.From.Id, err))
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
 		return
 	}
-	user.Note.Tags = make([]string, len(tags))
-	for i, tag := range tags {
-		user.Note.Tags[i] = tag.Title
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		TrashText(user, len(keyboard.InlineKeyboard) == 0), keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 	}
-	if note.Description == "" {
-		note.Description = "-"
+}
+
+// purgeConfirm спрашивает, точно ли удалить заметку из корзины навсегда
+func purgeConfirm(user *User, chatId, messageId, noteId int64, bot *tg.TelegramBot) {
+	notes, err := storage.GetTrash(user.Id)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
+		return
 	}
-	if note.Url == "" {
-		note.Url = "-"
+	for _, note := range notes {
+		if note.Id != noteId {
+			continue
+		}
+		keyboard := KeyboardPurgeConfirm(user, note)
+		msg := bot.EditMessage(chatId, messageId, fmt.Sprintf(user.T("Удалить заметку \"%s\" навсегда? Её нельзя будет восстановить"), note.Title), keyboard.Option())
+		if !msg.Ok {
+			log.ERROR(msg.Description)
+		}
+		return
 	}
-	if note.Title == "" {
-		note.Title = "-"
+	bot.SendMessage(chatId, user.T("Заметка не найдена"))
+}
+
+func cbRemind(r *Request) {
+	user := r.User
+
+	note, ok := userNote(user, r.ChatId, r.Data.Int(0), r.Bot)
+	if !ok {
+		return
 	}
-	text := fmt.Sprintf("*Название:* _%s_ \n*Ссылка:* _%s_ \n*Описание:* _%s_ \n*Теги:* _ %s _",
-		note.Title, note.Url, note.Description, strings.Join(user.Note.Tags, " "))
-	keyboard, err := KeyboardEditNote(&user)
+
+	user.Status = USER_STATUS_REMIND
+	user.RemindNoteId = note.Id
+
+	msg := r.Bot.SendMessage(r.ChatId, fmt.Sprintf(user.T("Когда напомнить о заметке \"%s\"? Например:\n"+
+		"завтра в 10\nчерез 2 часа\nв пятницу 18:30\n15.11 9:00\n\n"+
+		"Или правило повтора:\nежедневно в 10:00\nпо пн,пт 9:00\nежемесячно 15 в 9:00\ncron 0 9 * * 1-5"), note.Title))
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+func reminders(r *Request) {
+	user := r.User
+
+	keyboard, err := KeyboardReminders(user)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 		return
 	}
 
-	msg := bot.SendMessage(update.CallbackQuery.From.Id, validateString(text),
-		keyboard.Option(),
-		tg.StyleMarkdown(tg.MessageStyleMarkdownV2))
+	text := user.T("Ваши напоминания:")
+	if len(keyboard.InlineKeyboard) == 0 {
+		text = user.T("Напоминаний нет")
+	}
+	msg := r.Bot.SendMessage(r.ChatId, text, keyboard.Option())
 	if !msg.Ok {
 		log.ERROR(msg.Description)
+		return
 	}
 }
 
-func cbEditing(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+func cbReminder(r *Request) {
+	user := r.User
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	reminder, err := storage.GetReminder(user.Id, r.Data.Int(0))
+	if errors.Is(err, models.ErrNotFound) {
+		r.Bot.SendMessage(r.ChatId, user.T("Напоминание не найдено"))
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
-	if user.Note.Id == 0 {
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Заметка не выбрана")
-		if !msg.Ok {
-			log.ERROR(msg.Description)
-		}
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
 		return
 	}
 
-	qb := ""
-	state := ""
+	switch r.Data.Route {
+	case CB_ROUTE_REMINDER_PAUSE:
+		err = storage.PauseReminder(ctx, user.Id, reminder.Id)
+	case CB_ROUTE_REMINDER_RESUME:
+		fireAt := reminder.FireAt
+		if reminder.Repeat != "" && fireAt.Before(time.Now()) {
+			sched, err := schedule.Parse(reminder.Repeat)
+			if err == nil {
+				fireAt = sched.Next(time.Now().In(user.Location()))
+			}
+		}
+		err = storage.ResumeReminder(ctx, user.Id, reminder.Id, fireAt)
+	case CB_ROUTE_REMINDER_DEL:
+		err = storage.DeleteReminder(ctx, user.Id, reminder.Id)
+	}
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
+		return
+	}
 
-	fmt.Sscan(update.CallbackQuery.Data, &qb, &state)
-	log.DEBUG(fmt.Sprintf("%s %v", qb, state))
-	keyboard, err := KeyboardEditNote(&user)
+	keyboard, err := KeyboardReminders(user)
 	if err != nil {
-		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
 		return
 	}
+	text := r.Update.CallbackQuery.Message.Text
+	if len(keyboard.InlineKeyboard) == 0 {
+		text = user.T("Напоминаний нет")
+	}
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(), text, keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+		return
+	}
+}
 
-	switch state {
-	case "title":
-		user.Status = USER_STATUS_EDIT
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите название", keyboard.Option())
-		if !msg.Ok {
-			log.ERROR(msg.Description)
-		}
+func settings(r *Request) {
+	user := r.User
+	user.Status = USER_STATUS_NONE
+	keyboard := KeyboardSettings(user)
+	msg := r.Bot.SendMessage(r.ChatId, user.T("⚙ Настройки"), keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 		return
-	case "url":
-		user.Status = USER_STATUS_EDIT_URL
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите ссылку", keyboard.Option())
-		if !msg.Ok {
-			log.ERROR(msg.Description)
+	}
+}
+
+func cbSettings(r *Request) {
+	user := r.User
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	cb, value := r.Data.Route, r.Data.String(0)
+
+	text := user.T("⚙ Настройки")
+	var keyboard tg.InlineKeyboardMarkup
+	changed := false
+	user.Status = USER_STATUS_NONE
+
+	switch {
+	case cb == CB_ROUTE_SET_TIMEZONE && value == "":
+		user.Status = USER_STATUS_SETTINGS_TIMEZONE
+		text = user.T("Выберите часовой пояс или отправьте его название, например Asia/Tokyo:")
+		keyboard = KeyboardSettingsOptions(user, cb)
+	case cb == CB_ROUTE_SET_TIMEZONE:
+		if _, err := time.LoadLocation(value); err == nil {
+			user.Settings.Timezone = value
+			changed = true
 		}
-		return
-	case "description":
-		user.Status = USER_STATUS_EDIT_DESCRIPTION
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите описание", keyboard.Option())
-		if !msg.Ok {
-			log.ERROR(msg.Description)
+	case cb == CB_ROUTE_SET_LANGUAGE && value == "":
+		text = user.T("Выберите язык:")
+		keyboard = KeyboardSettingsOptions(user, cb)
+	case cb == CB_ROUTE_SET_LANGUAGE:
+		if _, ok := languageNames[value]; ok {
+			user.Settings.Language = value
+			changed = true
+			text = user.T("⚙ Настройки")
 		}
-		return
-	case "tags":
-		user.Status = USER_STATUS_EDIT_TAGS
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Введите теги (через пробел):", keyboard.Option())
-		if !msg.Ok {
-			log.ERROR(msg.Description)
+	case cb == CB_ROUTE_SET_PAGE_SIZE && value == "":
+		text = user.T("Сколько заметок показывать на странице?")
+		keyboard = KeyboardSettingsOptions(user, cb)
+	case cb == CB_ROUTE_SET_PAGE_SIZE:
+		if size := int(r.Data.Int(0)); size > 0 && size <= 50 {
+			user.Settings.PageSize = size
+			user.NotePage = 0
+			changed = true
 		}
-		return
-	case "update":
-		ctx, _ := context.WithTimeout(context.Background(), time.Second*10)
-		err := models.UpdNote(
-			ctx,
-			models.Note{
-				Id:          user.Note.Id,
-				UserId:      user.Id,
-				Title:       user.Note.Name,
-				Url:         user.Note.URL,
-				Description: user.Note.Description,
-			},
-			user.Note.Tags,
-		)
+	case cb == CB_ROUTE_SET_SORT && value == "":
+		text = user.T("Как сортировать заметки?")
+		keyboard = KeyboardSettingsOptions(user, cb)
+	case cb == CB_ROUTE_SET_SORT:
+		switch models.SortOrder(value) {
+		case models.SORT_ORDER_NEW, models.SORT_ORDER_OLD, models.SORT_ORDER_TITLE:
+			user.Settings.SortOrder = models.SortOrder(value)
+			user.NotePage = 0
+			changed = true
+		}
+	}
+
+	if changed {
+		err := storage.SetUserSettings(ctx, user.Settings)
 		if err != nil {
-			log.ERROR(err.Error())
+			log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+			r.Bot.SendMessage(r.ChatId, user.T("Ошибка на сервере"))
 			return
 		}
-		user.Status = USER_STATUS_NONE
-		msg := bot.SendMessage(update.CallbackQuery.From.Id, "Заметка обновлена")
+		log.INFO(fmt.Sprintf("%v settings changed %s", r.ChatId, fmt.Sprint(user.Settings)))
+	}
+	if keyboard.InlineKeyboard == nil {
+		keyboard = KeyboardSettings(user)
+	}
+
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(), text, keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+		return
+	}
+}
+
+func search(r *Request) {
+	user := r.User
+	user.Status = USER_STATUS_NONE
+	query := strings.TrimSpace(strings.TrimPrefix(r.Update.Message.Text, "/search"))
+	if query == "" {
+		msg := r.Bot.SendMessage(r.ChatId, user.T("Введите запрос после команды, например /search docker, или просто отправьте текст"))
 		if !msg.Ok {
 			log.ERROR(msg.Description)
 		}
 		return
 	}
 
+	searchNotes(user, r.ChatId, query, r.Bot)
 }
 
-func cbDelete(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+// quickAddNote создаёт заметку из одного сообщения без мастера
+func quickAddNote(ctx context.Context, user *User, chatId int64, text string, bot *tg.TelegramBot) {
+	parsed, err := quickadd.Parse(text)
+	if err != nil {
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
-
-	cb := ""
-	var noteId int64
+	createNote(ctx, user, chatId, parsed.Title, parsed.Url, parsed.Description, parsed.Tags, nil, bot)
+}
 
-	fmt.Sscan(update.CallbackQuery.Data, &cb, &noteId)
+// saveSharedNote создаёт заметку из пересланного сообщения, подписи к медиа или текста со ссылкой,
+// файл из сообщения становится вложением заметки
+func saveSharedNote(ctx context.Context, user *User, chatId int64, shared sharedMessage, bot *tg.TelegramBot) {
+	title, url, description, tags := shared.Note(user.Settings.Language)
+	log.INFO(fmt.Sprintf("%v shared message, forwarded %v", chatId, shared.Forwarded()))
+	attachments := []models.Attachment{}
+	if attachment, ok := shared.Attachment(); ok {
+		attachments = append(attachments, attachment)
+	}
+	createNote(ctx, user, chatId, title, url, description, tags, attachments, bot)
+}
 
-	if noteId == 0 {
-		log.ERROR(fmt.Sprintf("not dound note id in data: %s", update.CallbackQuery.Data))
+// createNote сохраняет заметку без мастера и показывает её с кнопками, чтобы поправить название и теги
+func createNote(ctx context.Context, user *User, chatId int64, title, url, description string, tagTitles []string, attachments []models.Attachment, bot *tg.TelegramBot) {
+	noteId, err := storage.NewNote(ctx, user.Id, title, url, description, tagTitles)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
 		return
 	}
+	log.INFO(fmt.Sprintf("%v saved note %v", chatId, noteId))
 
-	note, err := models.GetNote(noteId)
+	for _, attachment := range attachments {
+		attachment.NoteId = noteId
+		if _, err = storage.AddAttachment(ctx, user.Id, attachment); err != nil {
+			log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		}
+	}
+
+	note := models.Note{
+		Id:          noteId,
+		UserId:      user.Id,
+		Title:       title,
+		Url:         url,
+		Description: description,
+	}
+	tags := make([]models.Tag, len(tagTitles))
+	for i, tag := range tagTitles {
+		tags[i] = models.Tag{UserId: user.Id, Title: tag}
+	}
+
+	keyboard := KeyboardSavedNote(user, note)
+	text := user.T("Заметка сохранена") + "\n\n" + NoteText(user.Settings.Language, note, tags) + AttachmentsText(user.Settings.Language, len(attachments))
+	msg := bot.SendMessage(chatId, validateString(text), tg.StyleMarkdown(tg.MessageStyleMarkdownV2), keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+// attachToNote прикрепляет файл к заметке, которую пользователь сейчас редактирует
+func attachToNote(ctx context.Context, user *User, chatId int64, attachment models.Attachment, bot *tg.TelegramBot) {
+	attachment.NoteId = user.Note.Id
+	added, err := storage.AddAttachment(ctx, user.Id, attachment)
+	if errors.Is(err, models.ErrNotFound) {
+		bot.SendMessage(chatId, user.T("Заметка не найдена"))
+		return
+	}
 	if err != nil {
-		log.ERROR(fmt.Sprintf("database error: %e", err))
-		bot.SendMessage(update.CallbackQuery.From.Id, "Ошибка поиска заметки")
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
 		return
 	}
-	if note.Id == 0 {
-		bot.SendMessage(update.CallbackQuery.From.Id, "Заметка не найдена")
-		log.DEBUG(fmt.Sprint(note))
+	count, err := storage.CountAttachments(user.Id, attachment.NoteId)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+	}
+	log.INFO(fmt.Sprintf("%v attach %s to note %v", chatId, attachment.Kind, attachment.NoteId))
+
+	text := fmt.Sprintf(user.T("Вложение добавлено, всего вложений: %d"), count)
+	if !added {
+		text = user.T("Этот файл уже прикреплён к заметке")
+	}
+	keyboard, err := wizardKeyboard(user)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+	}
+	msg := bot.SendMessage(chatId, text, keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+// searchNotes ищет заметки по тексту и отправляет первую страницу результатов
+func searchNotes(user *User, chatId int64, query string, bot *tg.TelegramBot) {
+	query = strings.TrimSpace(query)
+	if query == "" {
 		return
 	}
-	if note.UserId != user.Id {
-		bot.SendMessage(update.CallbackQuery.From.Id, "Заметка не найдена")
-		log.ERROR(fmt.Sprintf("user with id=%v, try deleting note by user id=%v", user.Id, note.UserId))
+	if tagquery.IsQuery(query) {
+		node, err := tagquery.Parse(query)
+		if err != nil {
+			bot.SendMessage(chatId, fmt.Sprintf(user.T("Не удалось разобрать запрос по тегам: %s\n\nПримеры: #work #go -#archived, #a | #b, (#a | #b) #c"), query))
+			return
+		}
+		showNotesByTagQuery(user, chatId, node, bot)
 		return
 	}
+	user.SearchQuery = query
+	user.NotePage = 0
 
-	err = models.DeleteNote(noteId)
+	keyboard, err := KeyboardSearch(user)
 	if err != nil {
-		log.ERROR(fmt.Sprintf("database error: %e", err))
-		bot.SendMessage(update.CallbackQuery.From.Id, "Ошибка удаления заметки")
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
 		return
 	}
+	log.INFO(fmt.Sprintf("%v search %q", chatId, query))
 
-	bot.SendMessage(update.CallbackQuery.From.Id, fmt.Sprintf("Заметка \"%s\" удалена", note.Title))
+	text := fmt.Sprintf(user.T("Результаты поиска \"%s\":"), query)
+	if len(keyboard.InlineKeyboard) == 0 || len(keyboard.InlineKeyboard[0]) == 0 {
+		text = fmt.Sprintf(user.T("Ничего не найдено по запросу \"%s\""), query)
+	}
+	msg := bot.SendMessage(chatId, text, keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
 }
 
-func tags(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.Message.From.Id))
+func cbChangePageBySearch(r *Request) {
+	user := r.User
+
+	if r.Data.Route == CB_ROUTE_SEARCH_PREV && user.NotePage > 0 {
+		user.NotePage -= 1
+	}
+	if r.Data.Route == CB_ROUTE_SEARCH_NEXT {
+		user.NotePage += 1
+	}
+
+	keyboard, err := KeyboardSearch(user)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
+		return
+	}
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		escapeMarkdown(r.Update.CallbackQuery.Message.Text),
+		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
+		keyboard.Option(),
+	)
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 		return
 	}
-	user := store.Get(update.Message.From.Id)
-	defer func() {
-		store.Set(update.Message.From.Id, user)
-	}()
+}
 
-	_tags, err := models.GetTagsByUserId(user.Id)
+// userTags теги пользователя по алфавиту
+func userTags(user *User) []models.Tag {
+	_tags, err := storage.GetTagsByUserId(user.Id)
 	if err != nil {
-		log.ERROR(fmt.Sprintf("error getting tags for user %d", update.Message.From.Id), err.Error())
+		log.ERROR(fmt.Sprintf("error getting tags for user %d", user.Id), err.Error())
 	}
-	tags := make([]string, len(_tags))
+	sort.Slice(_tags, func(i, j int) bool {
+		return _tags[i].Title < _tags[j].Title
+	})
+	return _tags
+}
 
-	for i, t := range _tags {
-		tags[i] = t.Title
+// userTag название тега пользователя по id из кнопки, ok - false, если тега больше нет
+func userTag(user *User, tagId int64) (string, bool) {
+	for _, tag := range userTags(user) {
+		if tag.Id == tagId {
+			return tag.Title, true
+		}
 	}
-	// сортируй tags по алфавиту
+	return "", false
+}
 
-	keyboard, _ := KeyboardTags(tags)
-	msg := bot.SendMessage(update.Message.From.Id, "Ваши теги", keyboard.Option())
+func tags(r *Request) {
+	user := r.User
+	user.SelectedTags = nil
+	keyboard, _ := KeyboardTags(user, userTags(user))
+	msg := r.Bot.SendMessage(r.ChatId, user.T("Ваши теги")+"\n\n"+user.T(TAGS_HELP), keyboard.Option())
 	if !msg.Ok {
 		log.ERROR(msg.Description)
 		return
@@ -708,61 +1183,99 @@ func tags(update tg.UpdateResult, bot *tg.TelegramBot) {
 
 }
 
-func cbSearchByTag(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+// cbSelectTag отметка тегов в /tags и поиск по отмеченным
+func cbSelectTag(r *Request) {
+	user := r.User
+
+	switch r.Data.Route {
+	case CB_ROUTE_TAG_TOGGLE:
+		// тег могли удалить вместе с последней заметкой: тогда просто перерисуем список
+		if tag, ok := userTag(user, r.Data.Int(0)); ok {
+			user.ToggleTag(tag)
+		}
+	case CB_ROUTE_TAG_RESET:
+		user.SelectedTags = nil
+	case CB_ROUTE_TAG_APPLY:
+		if len(user.SelectedTags) == 0 {
+			r.Bot.SendMessage(r.ChatId, user.T("Тег не выбран"))
+			return
+		}
+		query := tagquery.And{}
+		for _, t := range user.SelectedTags {
+			query.Exprs = append(query.Exprs, tagquery.Tag{Name: t})
+		}
+		var node tagquery.Node = query
+		if len(query.Exprs) == 1 {
+			node = query.Exprs[0]
+		}
+		showNotesByTagQuery(user, r.ChatId, node, r.Bot)
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
-
-	cb := ""
-	tag := ""
-	fmt.Sscan(update.CallbackQuery.Data, &cb, &tag)
 
-	if tag == "" {
-		log.ERROR(fmt.Sprintf("%s, tag is empty", update.CallbackQuery.Data))
-		bot.SendMessage(update.CallbackQuery.From.Id, "Тег не выбран")
+	keyboard, _ := KeyboardTags(user, userTags(user))
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		user.T("Ваши теги")+"\n\n"+user.T(TAGS_HELP),
+		keyboard.Option(),
+	)
+	if !msg.Ok {
+		log.ERROR(msg.Description)
 		return
 	}
+}
 
-	user.SearchTag = tag
+// showNotesByTagQuery отправляет первую страницу заметок по запросу из тегов
+func showNotesByTagQuery(user *User, chatId int64, query tagquery.Node, bot *tg.TelegramBot) {
+	user.SearchTag = query.String()
+	user.NotePage = 0
+
+	keyboard, err := KeyboardListByTag(user, user.SearchTag)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
+		return
+	}
+	log.INFO(fmt.Sprintf("%v search by tags %q", chatId, user.SearchTag))
 
-	keyboard, _ := KeyboardListByTag(&user, tag)
-	msg := bot.SendMessage(update.CallbackQuery.From.Id, fmt.Sprintf("Заметки по тегу \"%s\"", tag), keyboard.Option())
+	text := fmt.Sprintf(user.T("Заметки по тегам: %s"), user.SearchTag)
+	if len(keyboard.InlineKeyboard) == 0 || len(keyboard.InlineKeyboard[0]) == 0 {
+		text = fmt.Sprintf(user.T("Нет заметок по тегам: %s"), user.SearchTag)
+	}
+	msg := bot.SendMessage(chatId, text, keyboard.Option())
 	if !msg.Ok {
 		log.ERROR(msg.Description)
-		return
 	}
 }
 
-func cbChangePageByTag(update tg.UpdateResult, bot *tg.TelegramBot) {
-	if !IsEnableTelegramUser(update, bot) {
-		log.INFO(fmt.Sprintf("user %d is note create", update.CallbackQuery.From.Id))
+func cbSearchByTag(r *Request) {
+	user := r.User
+
+	tag, ok := userTag(user, r.Data.Int(0))
+	if !ok {
+		log.ERROR(fmt.Sprintf("%s, tag not found", r.Update.CallbackQuery.Data))
+		r.Bot.SendMessage(r.ChatId, user.T("Тег не выбран"))
 		return
 	}
-	user := store.Get(update.CallbackQuery.From.Id)
-	defer func() {
-		store.Set(update.CallbackQuery.From.Id, user)
-	}()
 
-	if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SEARCH_TAG_PREV) && user.NotePage > 0 {
+	showNotesByTagQuery(user, r.ChatId, tagquery.Tag{Name: tag}, r.Bot)
+}
+
+func cbChangePageByTag(r *Request) {
+	user := r.User
+
+	if r.Data.Route == CB_ROUTE_SEARCH_TAG_PREV && user.NotePage > 0 {
 		user.NotePage -= 1
 	}
-	if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SEARCH_TAG_NEXT) {
+	if r.Data.Route == CB_ROUTE_SEARCH_TAG_NEXT {
 		user.NotePage += 1
 	}
 
-	keyboard, err := KeyboardListByTag(&user, user.SearchTag)
+	keyboard, err := KeyboardListByTag(user, user.SearchTag)
 	if err != nil {
 		log.ERROR(fmt.Sprintf("%v keyboard error %e", user.Id, err))
 		return
 	}
-	msg := bot.EditMessage(update.CallbackQuery.From.Id, update.CallbackQuery.Message.MessageId,
-		validateString(update.CallbackQuery.Message.Text),
-		tg.StyleMarkdown(tg.MessageStyleMarkdownV2),
+	msg := r.Bot.EditMessage(r.ChatId, r.MessageId(),
+		r.Update.CallbackQuery.Message.Text,
 		keyboard.Option(),
 	)
 	if !msg.Ok {
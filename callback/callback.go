@@ -0,0 +1,150 @@
+// Package callback данные inline-кнопок и маршрутизация нажатий по ним.
+//
+// Данные кнопки - версия формата, короткий код маршрута и аргументы через двоеточие:
+//
+//	1:s:42        маршрут "s" с аргументом 42
+//	1:tz:Asia/Tokyo
+//
+// Маршрут находится точным совпадением кода, поэтому одно нажатие обрабатывает ровно
+// один обработчик. Аргументы проверяются по типам, которые объявлены для маршрута.
+// Кнопки со старым форматом или другой версией отклоняются с ErrVersion.
+//
+// Signer дополнительно подписывает данные, чтобы клиент не мог подделать кнопку
+// или нажать кнопку, выданную другому пользователю.
+package callback
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	VERSION  = "1"
+	SEP      = ":"
+	MAX_SIZE = 64 // предел Telegram на callback_data в байтах
+)
+
+var (
+	ErrVersion = errors.New("callback: unsupported version")
+	ErrRoute   = errors.New("callback: unknown route")
+	ErrArgs    = errors.New("callback: bad arguments")
+	ErrSize    = errors.New("callback: data too long")
+)
+
+// Kind тип аргумента маршрута
+type Kind int
+
+const (
+	INT Kind = iota
+	STRING
+)
+
+// Data разобранные данные кнопки
+type Data struct {
+	Route string
+	Args  []string
+}
+
+// Int аргумент i как число, отсутствующий аргумент - 0
+func (d Data) Int(i int) int64 {
+	if i >= len(d.Args) {
+		return 0
+	}
+	n, _ := strconv.ParseInt(d.Args[i], 10, 64)
+	return n
+}
+
+// String аргумент i как строка, отсутствующий аргумент - пустая строка
+func (d Data) String(i int) string {
+	if i >= len(d.Args) {
+		return ""
+	}
+	return d.Args[i]
+}
+
+// Encode данные кнопки для маршрута route. Данные длиннее MAX_SIZE - ErrSize:
+// Telegram отклонит всё сообщение с такой кнопкой, а обрезать аргументы нельзя
+func Encode(route string, args ...any) (string, error) {
+	return encode(MAX_SIZE, route, args...)
+}
+
+func encode(limit int, route string, args ...any) (string, error) {
+	parts := make([]string, 0, len(args)+2)
+	parts = append(parts, VERSION, route)
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+	data := strings.Join(parts, SEP)
+	if len(data) > limit {
+		return "", fmt.Errorf("%w: %q is %d bytes, limit %d", ErrSize, data, len(data), limit)
+	}
+	return data, nil
+}
+
+type route[H any] struct {
+	handler H
+	args    []Kind
+}
+
+// Router обработчики H по кодам маршрутов
+type Router[H any] struct {
+	routes map[string]route[H]
+}
+
+func NewRouter[H any]() *Router[H] {
+	return &Router[H]{routes: map[string]route[H]{}}
+}
+
+// Handle регистрирует обработчик маршрута code с аргументами типов args.
+// Последний аргумент STRING может содержать SEP. Повторная регистрация кода - ошибка в коде бота
+func (r *Router[H]) Handle(code string, handler H, args ...Kind) {
+	if code == "" || strings.Contains(code, SEP) {
+		panic(fmt.Sprintf("callback: bad route code %q", code))
+	}
+	if _, ok := r.routes[code]; ok {
+		panic(fmt.Sprintf("callback: route %q already registered", code))
+	}
+	r.routes[code] = route[H]{handler: handler, args: args}
+}
+
+// Routes коды зарегистрированных маршрутов и типы их аргументов
+func (r *Router[H]) Routes() map[string][]Kind {
+	routes := make(map[string][]Kind, len(r.routes))
+	for code, rt := range r.routes {
+		routes[code] = append([]Kind{}, rt.args...)
+	}
+	return routes
+}
+
+// Match находит обработчик для данных кнопки и разбирает её аргументы.
+// Недостающие в конце аргументы допускаются, лишние и неверного типа - ErrArgs
+func (r *Router[H]) Match(data string) (H, Data, error) {
+	var none H
+	parts := strings.SplitN(data, SEP, 3)
+	if len(parts) < 2 || parts[0] != VERSION {
+		return none, Data{}, ErrVersion
+	}
+	rt, ok := r.routes[parts[1]]
+	if !ok {
+		return none, Data{}, fmt.Errorf("%w %q", ErrRoute, parts[1])
+	}
+
+	d := Data{Route: parts[1]}
+	if len(parts) == 3 {
+		if len(rt.args) == 0 {
+			return none, Data{}, fmt.Errorf("%w: %q takes no arguments", ErrArgs, d.Route)
+		}
+		d.Args = strings.SplitN(parts[2], SEP, len(rt.args))
+	}
+	for i, arg := range d.Args {
+		if rt.args[i] != INT {
+			continue
+		}
+		if _, err := strconv.ParseInt(arg, 10, 64); err != nil {
+			return none, Data{}, fmt.Errorf("%w: %q argument %d is not a number", ErrArgs, d.Route, i)
+		}
+	}
+	return rt.handler, d, nil
+}
@@ -0,0 +1,219 @@
+package callback
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testRouter() *Router[string] {
+	r := NewRouter[string]()
+	r.Handle("l", "list")
+	r.Handle("s", "show", INT)
+	r.Handle("e", "edit", INT, STRING)
+	r.Handle("ct", "toggle", INT, INT)
+	r.Handle("tz", "timezone", STRING)
+	return r
+}
+
+func TestEncodeMatch(t *testing.T) {
+	r := testRouter()
+	tests := []struct {
+		route   string
+		args    []any
+		handler string
+		want    []string
+	}{
+		{"l", nil, "list", nil},
+		{"s", []any{42}, "show", []string{"42"}},
+		{"s", []any{int64(-7)}, "show", []string{"-7"}},
+		{"e", []any{5}, "edit", []string{"5"}},
+		{"e", []any{5, "title"}, "edit", []string{"5", "title"}},
+		// последний STRING забирает остаток вместе с разделителями
+		{"e", []any{5, "a:b:c"}, "edit", []string{"5", "a:b:c"}},
+		{"ct", []any{int64(1) << 62, 3}, "toggle", []string{"4611686018427387904", "3"}},
+		{"tz", []any{"America/New_York"}, "timezone", []string{"America/New_York"}},
+		{"tz", []any{"тег"}, "timezone", []string{"тег"}},
+	}
+	for _, tt := range tests {
+		data, err := Encode(tt.route, tt.args...)
+		if err != nil {
+			t.Errorf("Encode(%q, %v) error: %s", tt.route, tt.args, err)
+			continue
+		}
+		handler, d, err := r.Match(data)
+		if err != nil {
+			t.Errorf("Match(%q) error: %s", data, err)
+			continue
+		}
+		if handler != tt.handler || d.Route != tt.route || strings.Join(d.Args, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Match(%q) = %s, %+v, want %s, %v", data, handler, d, tt.handler, tt.want)
+		}
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	r := testRouter()
+	routes := r.Routes()
+	if len(routes) != 5 || len(routes["l"]) != 0 || len(routes["e"]) != 2 || routes["e"][1] != STRING {
+		t.Fatalf("Routes() = %v", routes)
+	}
+	// каждый маршрут разбирается из своих же данных
+	for code, kinds := range routes {
+		args := []any{}
+		for _, kind := range kinds {
+			if kind == INT {
+				args = append(args, 1)
+			} else {
+				args = append(args, "x")
+			}
+		}
+		data, err := Encode(code, args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, d, err := r.Match(data); err != nil || d.Route != code || len(d.Args) != len(kinds) {
+			t.Errorf("Match(%q) = %+v, %v", data, d, err)
+		}
+	}
+}
+
+func TestMatchErrors(t *testing.T) {
+	r := testRouter()
+	tests := []struct {
+		data string
+		err  error
+	}{
+		{"", ErrVersion},
+		{"1", ErrVersion},
+		{"s:42", ErrVersion},
+		{"2:s:42", ErrVersion},
+		{"0:s:42", ErrVersion},
+		{"show_note_42", ErrVersion},
+		{"1:x:42", ErrRoute},
+		{"1::42", ErrRoute},
+		{"1:s:abc", ErrArgs},
+		{"1:s:4.2", ErrArgs},
+		{"1:s:", ErrArgs},
+		{"1:s:42:43", ErrArgs},
+		{"1:ct:1:x", ErrArgs},
+		{"1:l:1", ErrArgs},
+	}
+	for _, tt := range tests {
+		if _, _, err := r.Match(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("Match(%q) error = %v, want %v", tt.data, err, tt.err)
+		}
+	}
+
+	// недостающие в конце аргументы допускаются
+	if _, d, err := r.Match("1:ct:1"); err != nil || d.Int(0) != 1 || d.Int(1) != 0 || d.String(1) != "" {
+		t.Errorf("Match with a missing argument = %+v, %v", d, err)
+	}
+}
+
+func TestEncodeSize(t *testing.T) {
+	r := testRouter()
+	prefix := VERSION + SEP + "tz" + SEP
+
+	data, err := Encode("tz", strings.Repeat("a", MAX_SIZE-len(prefix)))
+	if err != nil || len(data) != MAX_SIZE {
+		t.Fatalf("Encode at the limit = %d bytes, %v", len(data), err)
+	}
+	if _, d, err := r.Match(data); err != nil || len(d.String(0)) != MAX_SIZE-len(prefix) {
+		t.Errorf("Match at the limit = %+v, %v", d, err)
+	}
+
+	if data, err = Encode("tz", strings.Repeat("a", MAX_SIZE-len(prefix)+1)); !errors.Is(err, ErrSize) || data != "" {
+		t.Errorf("Encode over the limit = %q, %v, want ErrSize", data, err)
+	}
+	// многобайтные символы считаются в байтах
+	if _, err = Encode("tz", strings.Repeat("я", (MAX_SIZE-len(prefix))/2+1)); !errors.Is(err, ErrSize) {
+		t.Errorf("Encode of multibyte data over the limit: %v, want ErrSize", err)
+	}
+}
+
+func TestSigner(t *testing.T) {
+	r := testRouter()
+	s := NewSigner("secret")
+
+	data, err := s.Encode(1001, "e", 5, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := s.Verify(1001, data)
+	if err != nil || payload != "1:e:5:title" {
+		t.Fatalf("Verify = %q, %v", payload, err)
+	}
+	if _, d, err := r.Match(payload); err != nil || d.Int(0) != 5 || d.String(1) != "title" {
+		t.Errorf("Match of verified data = %+v, %v", d, err)
+	}
+
+	forged := strings.Replace(data, "1:e:5:", "1:e:6:", 1)
+	other, err := s.Encode(1002, "e", 5, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := NewSigner("other secret").Encode(1001, "e", 5, "title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{
+		"forged arguments":     forged,
+		"another user's data":  other,
+		"another secret":       foreign,
+		"bad signature":        data[:len(data)-1] + "A",
+		"unsigned":             "1:e:5:title",
+		"no separator":         "garbage",
+		"signature only":       data[strings.LastIndex(data, SEP):],
+		"empty":                "",
+		"truncated signature":  data[:len(data)-2],
+		"signature of payload": payload + SEP,
+	} {
+		if _, err := s.Verify(1001, data); !errors.Is(err, ErrSignature) {
+			t.Errorf("Verify of %s %q: %v, want ErrSignature", name, data, err)
+		}
+	}
+}
+
+func TestSignerSize(t *testing.T) {
+	s := NewSigner("secret")
+	prefix := VERSION + SEP + "tz" + SEP
+
+	data, err := s.Encode(1001, "tz", strings.Repeat("a", MAX_SIZE-SIG_SIZE-len(prefix)))
+	if err != nil || len(data) != MAX_SIZE {
+		t.Fatalf("signed Encode at the limit = %d bytes, %v", len(data), err)
+	}
+	if _, err = s.Verify(1001, data); err != nil {
+		t.Errorf("Verify at the limit: %v", err)
+	}
+	if _, err = s.Encode(1001, "tz", strings.Repeat("a", MAX_SIZE-SIG_SIZE-len(prefix)+1)); !errors.Is(err, ErrSize) {
+		t.Errorf("signed Encode over the limit: %v, want ErrSize", err)
+	}
+}
+
+func TestNilSigner(t *testing.T) {
+	var s *Signer
+	data, err := s.Encode(1001, "s", 42)
+	if err != nil || data != "1:s:42" {
+		t.Fatalf("nil Signer Encode = %q, %v", data, err)
+	}
+	if payload, err := s.Verify(1002, data); err != nil || payload != data {
+		t.Errorf("nil Signer Verify = %q, %v", payload, err)
+	}
+	if got := s.Sign(1001, data); got != data {
+		t.Errorf("nil Signer Sign = %q", got)
+	}
+}
+
+func TestHandlePanics(t *testing.T) {
+	for _, code := range []string{"", "a:b", "s"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Handle(%q) did not panic", code)
+				}
+			}()
+			testRouter().Handle(code, "dup")
+		}()
+	}
+}
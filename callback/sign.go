@@ -0,0 +1,74 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	SIG_BYTES = 6 // длина обрезанного HMAC, в данных кнопки это 8 символов base64
+	SIG_SIZE  = len(SEP) + (SIG_BYTES*8+5)/6
+)
+
+var ErrSignature = errors.New("callback: bad signature")
+
+// Signer подписывает данные кнопок HMAC-SHA256 с секретом сервера и id пользователя Telegram:
+// подпись, выданная одному пользователю, не подходит другому.
+// nil Signer - подпись выключена, данные передаются как есть
+type Signer struct {
+	key []byte
+}
+
+func NewSigner(secret string) *Signer {
+	return &Signer{key: []byte(secret)}
+}
+
+// Encode данные кнопки маршрута route с подписью для пользователя userId.
+// Данные вместе с подписью длиннее MAX_SIZE - ErrSize
+func (s *Signer) Encode(userId int64, route string, args ...any) (string, error) {
+	if s == nil {
+		return Encode(route, args...)
+	}
+	data, err := encode(MAX_SIZE-SIG_SIZE, route, args...)
+	if err != nil {
+		return "", err
+	}
+	return s.Sign(userId, data), nil
+}
+
+// Sign добавляет к данным подпись для пользователя userId
+func (s *Signer) Sign(userId int64, data string) string {
+	if s == nil {
+		return data
+	}
+	return data + SEP + s.sum(userId, data)
+}
+
+// Verify проверяет подпись данных, нажатых пользователем userId, и возвращает данные без неё.
+// Поддельная, чужая или отсутствующая подпись - ErrSignature
+func (s *Signer) Verify(userId int64, data string) (string, error) {
+	if s == nil {
+		return data, nil
+	}
+	i := strings.LastIndex(data, SEP)
+	if i < 0 {
+		return "", ErrSignature
+	}
+	payload, sig := data[:i], data[i+len(SEP):]
+	if !hmac.Equal([]byte(sig), []byte(s.sum(userId, payload))) {
+		return "", ErrSignature
+	}
+	return payload, nil
+}
+
+func (s *Signer) sum(userId int64, data string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strconv.FormatInt(userId, 10)))
+	mac.Write([]byte(SEP))
+	mac.Write([]byte(data))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:SIG_BYTES])
+}
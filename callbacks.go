@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/playmixer/bot-note/callback"
+)
+
+// signer подпись данных кнопок ключом CALLBACK_SECRET, nil - кнопки не подписываются
+var signer *callback.Signer
+
+// callbacks маршруты нажатий на inline-кнопки и типы их аргументов
+var callbacks = newCallbackRouter()
+
+func newCallbackRouter() *callback.Router[HandlerFunc] {
+	r := callback.NewRouter[HandlerFunc]()
+
+	r.Handle(CB_ROUTE_LIST_ALL, cbList)
+	r.Handle(CB_ROUTE_LIST_PREV, cbChangePage)
+	r.Handle(CB_ROUTE_LIST_NEXT, cbChangePage)
+	r.Handle(CB_ROUTE_SHOW, cbShow, callback.INT)
+	r.Handle(CB_ROUTE_TAG_SHOW, cbShow, callback.INT)
+	r.Handle(CB_ROUTE_SEARCH_SHOW, cbShow, callback.INT)
+	r.Handle(CB_ROUTE_NEW, cbNew, callback.STRING)
+	r.Handle(CB_ROUTE_EDIT, cbEdit, callback.INT, callback.STRING)
+	r.Handle(CB_ROUTE_EDITING, cbEditing, callback.STRING)
+	r.Handle(CB_ROUTE_WIZARD, cbWizard, callback.STRING)
+	r.Handle(CB_ROUTE_DEL, cbDelete, callback.INT, callback.STRING)
+
+	r.Handle(CB_ROUTE_CHECK_TOGGLE, cbChecklist, callback.INT, callback.INT)
+	r.Handle(CB_ROUTE_CHECK_ADD, cbChecklist, callback.INT)
+	r.Handle(CB_ROUTE_CHECK_CLEAR, cbChecklist, callback.INT)
+
+	r.Handle(CB_ROUTE_HISTORY, cbHistory, callback.INT)
+	r.Handle(CB_ROUTE_REVISION, cbHistory, callback.INT, callback.INT)
+	r.Handle(CB_ROUTE_RESTORE, cbHistory, callback.INT, callback.INT)
+
+	r.Handle(CB_ROUTE_TRASH, cbTrash)
+	r.Handle(CB_ROUTE_UNTRASH, cbTrash, callback.INT, callback.STRING)
+	r.Handle(CB_ROUTE_PURGE, cbTrash, callback.INT, callback.STRING)
+
+	r.Handle(CB_ROUTE_REMIND, cbRemind, callback.INT)
+	r.Handle(CB_ROUTE_REMINDER_PAUSE, cbReminder, callback.INT)
+	r.Handle(CB_ROUTE_REMINDER_RESUME, cbReminder, callback.INT)
+	r.Handle(CB_ROUTE_REMINDER_DEL, cbReminder, callback.INT)
+
+	r.Handle(CB_ROUTE_SETTINGS, cbSettings)
+	r.Handle(CB_ROUTE_SET_TIMEZONE, cbSettings, callback.STRING)
+	r.Handle(CB_ROUTE_SET_LANGUAGE, cbSettings, callback.STRING)
+	r.Handle(CB_ROUTE_SET_PAGE_SIZE, cbSettings, callback.INT)
+	r.Handle(CB_ROUTE_SET_SORT, cbSettings, callback.STRING)
+
+	r.Handle(CB_ROUTE_SEARCH_PREV, cbChangePageBySearch)
+	r.Handle(CB_ROUTE_SEARCH_NEXT, cbChangePageBySearch)
+
+	r.Handle(CB_ROUTE_TAG_TOGGLE, cbSelectTag, callback.INT)
+	r.Handle(CB_ROUTE_TAG_APPLY, cbSelectTag)
+	r.Handle(CB_ROUTE_TAG_RESET, cbSelectTag)
+	r.Handle(CB_ROUTE_SEARCH_TAG, cbSearchByTag, callback.INT)
+	r.Handle(CB_ROUTE_SEARCH_TAG_PREV, cbChangePageByTag)
+	r.Handle(CB_ROUTE_SEARCH_TAG_NEXT, cbChangePageByTag)
+
+	return r
+}
+
+// verifyCallback пропускает дальше только нажатия на кнопки, подписанные для нажавшего их пользователя,
+// следующие обработчики получают данные кнопки уже без подписи
+func verifyCallback(next HandlerFunc) HandlerFunc {
+	return func(r *Request) {
+		data, err := signer.Verify(r.ChatId, r.Update.CallbackQuery.Data)
+		if err != nil {
+			// подделка, чужая кнопка или кнопка, выданная до включения подписи
+			log.WARN(fmt.Sprintf("%v callback %q rejected: %s", r.ChatId, r.Update.CallbackQuery.Data, err))
+			// проверка идёт до withUser: пользователь не создаётся, язык ответа берётся из состояния, если оно есть
+			user := store.Get(r.ChatId)
+			r.User = &user
+			staleCallback(r)
+			return
+		}
+		r.Update.CallbackQuery.Data = data
+		next(r)
+	}
+}
+
+// staleCallback просит открыть меню заново вместо кнопки, которую нельзя обработать
+func staleCallback(r *Request) {
+	r.Bot.SendMessage(r.ChatId, r.User.T("Кнопка устарела, откройте меню заново"))
+}
+
+// routeCallback передаёт нажатие на кнопку единственному обработчику её маршрута
+func routeCallback(r *Request) {
+	handler, data, err := callbacks.Match(r.Update.CallbackQuery.Data)
+	if errors.Is(err, callback.ErrVersion) {
+		// кнопка из сообщения, отправленного до смены формата
+		staleCallback(r)
+		return
+	}
+	if err != nil {
+		log.WARN(fmt.Sprintf("%v callback %q: %s", r.ChatId, r.Update.CallbackQuery.Data, err))
+		return
+	}
+	r.Data = data
+	handler(r)
+}
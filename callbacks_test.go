@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/playmixer/bot-note/callback"
+	"github.com/playmixer/corvid/logger"
+)
+
+// TestCallbackRoutes каждый маршрут бота с самыми длинными id помещается в подписанные данные кнопки
+// и после проверки подписи попадает в свой обработчик с теми же аргументами
+func TestCallbackRoutes(t *testing.T) {
+	s := callback.NewSigner("secret")
+	routes := callbacks.Routes()
+	if len(routes) == 0 {
+		t.Fatal("no callback routes registered")
+	}
+	for code, kinds := range routes {
+		args := []any{}
+		want := []string{}
+		for _, kind := range kinds {
+			arg := any(int64(math.MaxInt64))
+			if kind == callback.STRING {
+				// самый длинный строковый аргумент кнопок: шаг мастера
+				arg = "description"
+			}
+			args = append(args, arg)
+			want = append(want, fmt.Sprint(arg))
+		}
+		data, err := s.Encode(math.MaxInt64, code, args...)
+		if err != nil {
+			t.Errorf("route %q: %s", code, err)
+			continue
+		}
+		payload, err := s.Verify(math.MaxInt64, data)
+		if err != nil {
+			t.Errorf("route %q: Verify(%q): %s", code, data, err)
+			continue
+		}
+		handler, d, err := callbacks.Match(payload)
+		if err != nil || handler == nil || d.Route != code || fmt.Sprint(d.Args) != fmt.Sprint(want) {
+			t.Errorf("route %q: Match(%q) = %+v, %v", code, payload, d, err)
+		}
+	}
+}
+
+// TestCallbackSettingsValues варианты настроек передаются в кнопках целиком
+func TestCallbackSettingsValues(t *testing.T) {
+	s := callback.NewSigner("secret")
+	values := map[string][]string{
+		CB_ROUTE_SET_TIMEZONE: SETTINGS_TIMEZONES,
+		CB_ROUTE_SET_LANGUAGE: {LANG_RU, LANG_EN},
+	}
+	for _, order := range SETTINGS_SORT_ORDERS {
+		values[CB_ROUTE_SET_SORT] = append(values[CB_ROUTE_SET_SORT], string(order))
+	}
+	for route, options := range values {
+		for _, value := range options {
+			data, err := s.Encode(math.MaxInt64, route, value)
+			if err != nil {
+				t.Errorf("%q %q: %s", route, value, err)
+				continue
+			}
+			payload, _ := s.Verify(math.MaxInt64, data)
+			if _, d, err := callbacks.Match(payload); err != nil || d.String(0) != value {
+				t.Errorf("%q %q: Match = %+v, %v", route, value, d, err)
+			}
+		}
+	}
+}
+
+// TestUserCallbackTooLong слишком длинные данные не роняют обработчик, кнопка ведёт в список заметок
+func TestUserCallbackTooLong(t *testing.T) {
+	log = logger.New("test")
+	signer = callback.NewSigner("secret")
+	defer func() { signer = nil }()
+
+	user := User{tgId: math.MaxInt64}
+	data := user.Callback(CB_ROUTE_EDIT, int64(math.MaxInt64), strings.Repeat("x", callback.MAX_SIZE))
+	if len(data) > callback.MAX_SIZE {
+		t.Fatalf("Callback data is %d bytes", len(data))
+	}
+	payload, err := signer.Verify(math.MaxInt64, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, d, err := callbacks.Match(payload); err != nil || d.Route != CB_ROUTE_LIST_ALL {
+		t.Errorf("Match(%q) = %+v, %v", payload, d, err)
+	}
+}
@@ -5,41 +5,175 @@ import (
 	"strings"
 
 	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/schedule"
+	"github.com/playmixer/bot-note/tagquery"
 	tg "github.com/playmixer/telegram-bot-api/v3"
 )
 
+// MARKDOWN_SPECIAL символы, которые MarkdownV2 требует экранировать вне разметки
+const MARKDOWN_SPECIAL = "_*[]()~`>#+-=|{}.!\\"
+
+// validateString экранирует текст с разметкой MarkdownV2: * и _ остаются разметкой,
+// уже экранированные символы не трогаются. Данные пользователя в текст подставляются через escapeMarkdown
 func validateString(message string) string {
-	charsets := []rune{'-', '.', '='}
-	for _, c := range charsets {
-		message = strings.ReplaceAll(message, string(c), fmt.Sprintf("\\%c", c))
+	b := strings.Builder{}
+	escaped := false
+	for _, c := range message {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c != '*' && c != '_' && strings.ContainsRune(MARKDOWN_SPECIAL, c):
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
 	}
+	return b.String()
+}
 
-	return message
+// escapeMarkdown экранирует все спецсимволы MarkdownV2, текст выводится как есть
+func escapeMarkdown(text string) string {
+	b := strings.Builder{}
+	for _, c := range text {
+		if strings.ContainsRune(MARKDOWN_SPECIAL, c) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
 }
 
-func IsEnableTelegramUser(update tg.UpdateResult, bot *tg.TelegramBot) bool {
-	var userId int64 = update.Message.From.Id
-	if update.CallbackQuery.From.Id != 0 {
-		userId = update.CallbackQuery.From.Id
+func NoteText(lang string, note models.Note, tags []models.Tag) string {
+	tagsString := make([]string, len(tags))
+	for i, _t := range tags {
+		tagsString[i] = escapeMarkdown(_t.Title)
 	}
-	user := store.Get(userId)
 
-	if user.Id == 0 {
-		err := CacheUserStore(userId)
-		if err != nil {
-			log.ERROR("cached user store error:", err.Error())
-			return false
+	return fmt.Sprintf(Translate(lang, "*Название:* %s \n*Ссылка:* %s \n*Описание:* %s \n*Теги:* %s"),
+		escapeMarkdown(note.Title), escapeMarkdown(note.Url), escapeMarkdown(note.Description), strings.Join(tagsString, " "))
+}
+
+// tagTitles названия тегов
+func tagTitles(tags []models.Tag) []string {
+	titles := make([]string, len(tags))
+	for i, tag := range tags {
+		titles[i] = tag.Title
+	}
+	return titles
+}
+
+// NoteCard текст карточки заметки и клавиатура: действия, список дел и список заметок,
+// из которого открыта заметка (route - CB_ROUTE_SHOW, CB_ROUTE_TAG_SHOW или CB_ROUTE_SEARCH_SHOW)
+func NoteCard(user *User, note models.Note, route string) (string, tg.InlineKeyboardMarkup, []models.Attachment, error) {
+	tags, err := storage.GetTagsByNoteId(user.Id, note.Id)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+	}
+	attachments, err := storage.GetAttachments(user.Id, note.Id)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+	}
+	items, err := storage.GetChecklist(user.Id, note.Id)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+	}
+
+	text := NoteText(user.Settings.Language, note, tags) +
+		AttachmentsText(user.Settings.Language, len(attachments)) +
+		ChecklistText(user.Settings.Language, items)
+
+	var keyboard tg.InlineKeyboardMarkup
+	switch route {
+	case CB_ROUTE_TAG_SHOW:
+		keyboard, err = KeyboardListByTag(user, user.SearchTag)
+	case CB_ROUTE_SEARCH_SHOW:
+		keyboard, err = KeyboardSearch(user)
+	default:
+		keyboard, err = KeyboardList(user)
+	}
+	if err != nil {
+		return text, keyboard, attachments, err
+	}
+	if note.Id != 0 {
+		rows := [][]tg.InlineKeyboardButton{KeyboardNoteActions(user, note)}
+		rows = append(rows, KeyboardChecklist(user, note, items).InlineKeyboard...)
+		keyboard.InlineKeyboard = append(rows, keyboard.InlineKeyboard...)
+	}
+
+	return text, keyboard, attachments, nil
+}
+
+// KeyboardChecklist пункты списка дел кнопками ☐/☑ и кнопки добавления и очистки
+func KeyboardChecklist(user *User, note models.Note, items []models.ChecklistItem) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	hasDone := false
+	for _, item := range items {
+		mark := "☐"
+		if item.Done {
+			mark = "☑"
+			hasDone = true
 		}
-		return true
+		btnItem := keyboard.Button(fmt.Sprintf("%s %s", mark, item.Title)).SetCallbackData(user.Callback(CB_ROUTE_CHECK_TOGGLE, note.Id, item.Id))
+		keyboard.Add([]tg.InlineKeyboardButton{*btnItem})
+	}
+
+	btns := []tg.InlineKeyboardButton{}
+	btnAdd := keyboard.Button(user.T("➕ Пункт")).SetCallbackData(user.Callback(CB_ROUTE_CHECK_ADD, note.Id))
+	btns = append(btns, *btnAdd)
+	if hasDone {
+		btnClear := keyboard.Button(user.T("🧹 Убрать отмеченные")).SetCallbackData(user.Callback(CB_ROUTE_CHECK_CLEAR, note.Id))
+		btns = append(btns, *btnClear)
 	}
-	return true
+	keyboard.Add(btns)
+
+	return keyboard
+}
+
+// ChecklistText строка карточки заметки с прогрессом списка дел, без списка пустая
+func ChecklistText(lang string, items []models.ChecklistItem) string {
+	if len(items) == 0 {
+		return ""
+	}
+	p := models.ChecklistProgress{Total: len(items)}
+	for _, item := range items {
+		if item.Done {
+			p.Done++
+		}
+	}
+	return fmt.Sprintf(Translate(lang, " \n*Выполнено:* %s"), p)
+}
+
+// checklistProgress прогресс списков дел для страницы заметок, при ошибке - пустой
+func checklistProgress(user *User, notes []models.Note) map[int64]models.ChecklistProgress {
+	ids := make([]int64, len(notes))
+	for i, note := range notes {
+		ids[i] = note.Id
+	}
+	progress, err := storage.GetChecklistProgress(user.Id, ids)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v database error: %e", user.Id, err))
+		return map[int64]models.ChecklistProgress{}
+	}
+	return progress
+}
+
+// AttachmentsText строка карточки заметки со счётчиком вложений, без вложений пустая
+func AttachmentsText(lang string, count int) string {
+	if count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(Translate(lang, " \n*Вложения:* %d"), count)
 }
 
 func CacheUserStore(userId int64) error {
-	var user User
+	// состояние начинается заново, но с прежней версией, иначе UserStore отклонит запись
+	current := store.Get(userId)
+	user := User{version: current.version, loaded: current.loaded}
 
 	//ищем пользователя, если его нет то создаём
-	userModel, err := models.GetUserByTelegramId(userId)
+	userModel, err := storage.GetUserByTelegramId(userId)
 	if err != nil {
 		log.ERROR(err.Error())
 		log.DEBUG("user", fmt.Sprint(userModel))
@@ -47,7 +181,7 @@ func CacheUserStore(userId int64) error {
 		return err
 	}
 	if userModel.Id == 0 {
-		user.Id, err = models.NewUser(userId, "")
+		user.Id, err = storage.NewUser(userId, "")
 		if err != nil {
 			log.ERROR(err.Error())
 			return err
@@ -56,72 +190,387 @@ func CacheUserStore(userId int64) error {
 		user.Id = userModel.Id
 	}
 
+	user.Settings, err = storage.GetUserSettings(user.Id)
+	if err != nil {
+		log.ERROR(err.Error())
+		return err
+	}
+
 	log.DEBUG(fmt.Sprintf("cache user store %v, %s", userId, fmt.Sprint(user)))
 
-	store.Set(userId, user)
+	if err = store.Set(userId, user); err != nil {
+		log.ERROR(err.Error())
+		return err
+	}
 
 	return nil
 }
 
 func KeyboardList(user *User) (tg.InlineKeyboardMarkup, error) {
 	keyboard := tg.InlineMarkup()
-	notes, err := models.GetNotes(user.Id)
+	notes, err := storage.GetNotes(user.Id, user.Settings.SortOrder)
 	if err != nil {
 		return keyboard, err
 	}
 
-	_start := max(int(user.NotePage*LIST_PAGE_SIZE), 0)
-	_end := min(int(user.NotePage*LIST_PAGE_SIZE+LIST_PAGE_SIZE), len(notes))
+	pageSize := user.PageSize()
+	_start := max(int(user.NotePage)*pageSize, 0)
+	_end := min(int(user.NotePage)*pageSize+pageSize, len(notes))
 	_start = min(_start, _end)
 	_end = max(_start, _end)
 
+	progress := checklistProgress(user, notes[_start:_end])
 	for _, note := range notes[_start:_end] {
-		btnShow := keyboard.Button(note.Title).SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_SHOW, note.Id))
+		KeyboardNoteRows(&keyboard, user, note, progress[note.Id], CB_ROUTE_SHOW)
+	}
+	btnsControl := []tg.InlineKeyboardButton{}
+	btnPrev := keyboard.Button("<<").SetCallbackData(user.Callback(CB_ROUTE_LIST_PREV))
+	if user.NotePage > 0 {
+		btnsControl = append(btnsControl, *btnPrev)
+	}
+	btnNext := keyboard.Button(">>").SetCallbackData(user.Callback(CB_ROUTE_LIST_NEXT))
+	if int(user.NotePage)*pageSize+pageSize < len(notes) {
+		btnsControl = append(btnsControl, *btnNext)
+	}
+	keyboard.Add(btnsControl)
+	return keyboard, nil
+}
+
+// KeyboardNoteRows добавляет в клавиатуру строку с названием заметки и строку действий над ней,
+// у заметки со списком дел в названии показывается прогресс
+func KeyboardNoteRows(keyboard *tg.InlineKeyboardMarkup, user *User, note models.Note, progress models.ChecklistProgress, showRoute string) {
+	title := note.Title
+	if progress.Total > 0 {
+		title = fmt.Sprintf("%s (%s)", note.Title, progress)
+	}
+	btnShow := keyboard.Button(title).SetCallbackData(user.Callback(showRoute, note.Id))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnShow})
+
+	btns := []tg.InlineKeyboardButton{}
+
+	btnEdit := keyboard.Button("📝")
+	btnEdit.SetCallbackData(user.Callback(CB_ROUTE_EDIT, note.Id))
+	btns = append(btns, *btnEdit)
+
+	if note.Url != "" {
+		btnOpen := keyboard.Button("📖")
+		btnOpen.SetUrl(note.Url)
+		btns = append(btns, *btnOpen)
+	}
+
+	btnRemind := keyboard.Button("⏰")
+	btnRemind.SetCallbackData(user.Callback(CB_ROUTE_REMIND, note.Id))
+	btns = append(btns, *btnRemind)
+
+	btnDel := keyboard.Button("❌")
+	btnDel.SetCallbackData(user.Callback(CB_ROUTE_DEL, note.Id))
+	btns = append(btns, *btnDel)
+
+	keyboard.Add(btns)
+}
+
+// KeyboardNoteActions строка действий для карточки заметки
+func KeyboardNoteActions(user *User, note models.Note) []tg.InlineKeyboardButton {
+	keyboard := tg.InlineMarkup()
+
+	btnRemind := keyboard.Button(user.T("⏰ Напомнить")).SetCallbackData(user.Callback(CB_ROUTE_REMIND, note.Id))
+	btnHistory := keyboard.Button(user.T("🕓 История")).SetCallbackData(user.Callback(CB_ROUTE_HISTORY, note.Id))
+
+	return []tg.InlineKeyboardButton{*btnRemind, *btnHistory}
+}
+
+// KeyboardHistory ревизии заметки с кратким описанием изменений, сначала новые.
+// Изменение ревизии - разница между ней и следующим состоянием заметки
+func KeyboardHistory(user *User, note models.Note, tags []string, revisions []models.NoteRevision) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	next, nextTags := note, tags
+	for _, revision := range revisions {
+		title := fmt.Sprintf("%s · %s", revision.CreatedAt.In(user.Location()).Format(REMINDER_TIME_LAYOUT), RevisionDiff(user, revision, next, nextTags))
+		btn := keyboard.Button(title).SetCallbackData(user.Callback(CB_ROUTE_REVISION, note.Id, revision.Id))
+		keyboard.Add([]tg.InlineKeyboardButton{*btn})
+		next, nextTags = revision.Note(), revision.Tags
+	}
+
+	btnBack := keyboard.Button(user.T("◀ Назад")).SetCallbackData(user.Callback(user.ShowRouteOrDefault(), note.Id))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnBack})
+
+	return keyboard
+}
+
+// KeyboardRevision восстановление ревизии и возврат к истории
+func KeyboardRevision(user *User, revision models.NoteRevision) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	btnRestore := keyboard.Button(user.T("↩ Восстановить")).SetCallbackData(user.Callback(CB_ROUTE_RESTORE, revision.NoteId, revision.Id))
+	btnBack := keyboard.Button(user.T("◀ Назад")).SetCallbackData(user.Callback(CB_ROUTE_HISTORY, revision.NoteId))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnRestore, *btnBack})
+
+	return keyboard
+}
+
+// RevisionDiff что поменялось в заметке после ревизии: поля и добавленные/удалённые теги
+func RevisionDiff(user *User, revision models.NoteRevision, next models.Note, nextTags []string) string {
+	changes := []string{}
+	if revision.Title != next.Title {
+		changes = append(changes, user.T("название"))
+	}
+	if revision.Url != next.Url {
+		changes = append(changes, user.T("ссылка"))
+	}
+	if revision.Description != next.Description {
+		changes = append(changes, user.T("описание"))
+	}
+
+	before := map[string]bool{}
+	for _, tag := range revision.Tags {
+		before[tag] = true
+	}
+	tagChanges := []string{}
+	for _, tag := range nextTags {
+		if tag != "" && !before[tag] {
+			tagChanges = append(tagChanges, "+"+escapeMarkdown(tag))
+		}
+		delete(before, tag)
+	}
+	for _, tag := range revision.Tags {
+		if before[tag] {
+			tagChanges = append(tagChanges, "−"+escapeMarkdown(tag))
+		}
+	}
+	if len(tagChanges) > 0 {
+		changes = append(changes, user.T("теги")+" "+strings.Join(tagChanges, " "))
+	}
+
+	if len(changes) == 0 {
+		return user.T("без изменений")
+	}
+	return strings.Join(changes, ", ")
+}
+
+// KeyboardSavedNote кнопки под только что сохранённой заметкой
+func KeyboardSavedNote(user *User, note models.Note) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	btnTitle := keyboard.Button(user.T("✏ Название")).SetCallbackData(user.Callback(CB_ROUTE_EDIT, note.Id, "title"))
+	btnTags := keyboard.Button(user.T("🏷 Теги")).SetCallbackData(user.Callback(CB_ROUTE_EDIT, note.Id, "tags"))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnTitle, *btnTags})
+
+	btnEdit := keyboard.Button(user.T("📝 Редактировать")).SetCallbackData(user.Callback(CB_ROUTE_EDIT, note.Id))
+	btnRemind := keyboard.Button(user.T("⏰ Напомнить")).SetCallbackData(user.Callback(CB_ROUTE_REMIND, note.Id))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnEdit, *btnRemind})
+
+	return keyboard
+}
+
+func KeyboardReminders(user *User) (tg.InlineKeyboardMarkup, error) {
+	keyboard := tg.InlineMarkup()
+	reminders, err := storage.GetActiveReminders(user.Id)
+	if err != nil {
+		return keyboard, err
+	}
+
+	for _, reminder := range reminders {
+		btnShow := keyboard.Button(ReminderTitle(user, reminder)).SetCallbackData(user.Callback(CB_ROUTE_SHOW, reminder.NoteId))
 		keyboard.Add([]tg.InlineKeyboardButton{*btnShow})
 
 		btns := []tg.InlineKeyboardButton{}
 
-		btnEdit := keyboard.Button("📝")
-		btnEdit.SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_EDIT, note.Id))
-		btns = append(btns, *btnEdit)
-
-		if note.Url != "" {
-			btnOpen := keyboard.Button("📖")
-			btnOpen.SetUrl(note.Url)
-			btns = append(btns, *btnOpen)
+		if reminder.Paused {
+			btnResume := keyboard.Button("▶")
+			btnResume.SetCallbackData(user.Callback(CB_ROUTE_REMINDER_RESUME, reminder.Id))
+			btns = append(btns, *btnResume)
+		} else {
+			btnPause := keyboard.Button("⏸")
+			btnPause.SetCallbackData(user.Callback(CB_ROUTE_REMINDER_PAUSE, reminder.Id))
+			btns = append(btns, *btnPause)
 		}
 
 		btnDel := keyboard.Button("❌")
-		btnDel.SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_DEL, note.Id))
+		btnDel.SetCallbackData(user.Callback(CB_ROUTE_REMINDER_DEL, reminder.Id))
 		btns = append(btns, *btnDel)
 
 		keyboard.Add(btns)
-
 	}
-	btnsControl := []tg.InlineKeyboardButton{}
-	btnPrev := keyboard.Button("<<").SetCallbackData(CB_ROUTE_LIST_PREV)
-	if user.NotePage > 0 {
-		btnsControl = append(btnsControl, *btnPrev)
+
+	return keyboard, nil
+}
+
+// KeyboardDeleteConfirm подтверждение переноса заметки в корзину
+func KeyboardDeleteConfirm(user *User, note models.Note) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	btnConfirm := keyboard.Button(user.T("🗑 Удалить")).SetCallbackData(user.Callback(CB_ROUTE_DEL, note.Id, DELETE_CONFIRM_ARG))
+	btnCancel := keyboard.Button(user.T("Отмена")).SetCallbackData(user.Callback(CB_ROUTE_DEL, note.Id, DELETE_CANCEL_ARG))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnConfirm, *btnCancel})
+
+	return keyboard
+}
+
+// KeyboardDeleted кнопка отмены удаления под сообщением об удалённой заметке
+func KeyboardDeleted(user *User, note models.Note) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	btnUndo := keyboard.Button(user.T("↩ Отменить")).SetCallbackData(user.Callback(CB_ROUTE_UNTRASH, note.Id))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnUndo})
+
+	return keyboard
+}
+
+// KeyboardTrash заметки в корзине с кнопками восстановления и удаления навсегда
+func KeyboardTrash(user *User) (tg.InlineKeyboardMarkup, error) {
+	keyboard := tg.InlineMarkup()
+	notes, err := storage.GetTrash(user.Id)
+	if err != nil {
+		return keyboard, err
 	}
-	btnNext := keyboard.Button(">>").SetCallbackData(CB_ROUTE_LIST_NEXT)
-	if int(user.NotePage*LIST_PAGE_SIZE)+LIST_PAGE_SIZE < len(notes) {
-		btnsControl = append(btnsControl, *btnNext)
+
+	for _, note := range notes {
+		title := fmt.Sprintf("%s · %s", note.Title, note.DeletedAt.In(user.Location()).Format(REMINDER_TIME_LAYOUT))
+		btnTitle := keyboard.Button(title).SetCallbackData(user.Callback(CB_ROUTE_TRASH))
+		keyboard.Add([]tg.InlineKeyboardButton{*btnTitle})
+
+		btnRestore := keyboard.Button(user.T("♻ Восстановить")).SetCallbackData(user.Callback(CB_ROUTE_UNTRASH, note.Id, TRASH_LIST_ARG))
+		btnPurge := keyboard.Button(user.T("🔥 Удалить навсегда")).SetCallbackData(user.Callback(CB_ROUTE_PURGE, note.Id))
+		keyboard.Add([]tg.InlineKeyboardButton{*btnRestore, *btnPurge})
 	}
-	keyboard.Add(btnsControl)
+
 	return keyboard, nil
 }
 
+// KeyboardPurgeConfirm подтверждение удаления заметки из корзины навсегда
+func KeyboardPurgeConfirm(user *User, note models.Note) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	btnConfirm := keyboard.Button(user.T("🔥 Удалить навсегда")).SetCallbackData(user.Callback(CB_ROUTE_PURGE, note.Id, DELETE_CONFIRM_ARG))
+	btnCancel := keyboard.Button(user.T("◀ Назад")).SetCallbackData(user.Callback(CB_ROUTE_TRASH))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnConfirm, *btnCancel})
+
+	return keyboard
+}
+
+// TrashText заголовок корзины со сроком хранения заметок
+func TrashText(user *User, empty bool) string {
+	if empty {
+		return user.T("Корзина пуста")
+	}
+	return fmt.Sprintf(user.T("Корзина. Заметки удаляются навсегда через %d дн. после удаления:"), trashRetention)
+}
+
+func ReminderTitle(user *User, reminder models.Reminder) string {
+	title := fmt.Sprintf("%s · %s", reminder.NoteTitle, reminder.FireAt.In(user.Location()).Format(REMINDER_TIME_LAYOUT))
+	if reminder.Repeat != "" {
+		if sched, err := schedule.Parse(reminder.Repeat); err == nil {
+			title += fmt.Sprintf(" (%s)", sched.Describe(user.Settings.Language))
+		}
+	}
+	if reminder.Paused {
+		title = "⏸ " + title
+	}
+	return title
+}
+
+// SETTINGS_TIMEZONES часовые пояса, которые предлагаются в настройках, остальные можно ввести текстом
+var SETTINGS_TIMEZONES = []string{
+	"Europe/Kaliningrad", "Europe/Moscow", "Europe/Samara", "Asia/Yekaterinburg",
+	"Asia/Omsk", "Asia/Novosibirsk", "Asia/Krasnoyarsk", "Asia/Irkutsk",
+	"Asia/Yakutsk", "Asia/Vladivostok", "Asia/Magadan", "Asia/Kamchatka",
+	"Europe/Minsk", "Europe/Kyiv", "Asia/Almaty", "Asia/Tbilisi",
+	"Europe/London", "Europe/Berlin", "America/New_York", "UTC",
+}
+
+var SETTINGS_PAGE_SIZES = []int{5, 10, 20}
+
+var SETTINGS_SORT_ORDERS = []models.SortOrder{models.SORT_ORDER_NEW, models.SORT_ORDER_OLD, models.SORT_ORDER_TITLE}
+
+func SortOrderName(user *User, order models.SortOrder) string {
+	switch order {
+	case models.SORT_ORDER_OLD:
+		return user.T("сначала старые")
+	case models.SORT_ORDER_TITLE:
+		return user.T("по названию")
+	}
+	return user.T("сначала новые")
+}
+
+func KeyboardSettings(user *User) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	timezone := user.Settings.Timezone
+	if timezone == "" {
+		timezone = user.T("время сервера")
+	}
+	language, ok := languageNames[user.Settings.Language]
+	if !ok {
+		language = user.Settings.Language
+	}
+
+	btnTimezone := keyboard.Button(fmt.Sprintf(user.T("🌍 Часовой пояс: %s"), timezone)).SetCallbackData(user.Callback(CB_ROUTE_SET_TIMEZONE))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnTimezone})
+	btnLanguage := keyboard.Button(fmt.Sprintf(user.T("🗣 Язык: %s"), language)).SetCallbackData(user.Callback(CB_ROUTE_SET_LANGUAGE))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnLanguage})
+	btnPageSize := keyboard.Button(fmt.Sprintf(user.T("📄 На странице: %v"), user.PageSize())).SetCallbackData(user.Callback(CB_ROUTE_SET_PAGE_SIZE))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnPageSize})
+	btnSort := keyboard.Button(fmt.Sprintf(user.T("↕ Сортировка: %s"), SortOrderName(user, user.Settings.SortOrder))).SetCallbackData(user.Callback(CB_ROUTE_SET_SORT))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnSort})
+
+	return keyboard
+}
+
+// KeyboardSettingsOptions варианты значений для одной настройки, route - маршрут этой настройки
+func KeyboardSettingsOptions(user *User, route string) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+
+	keyLine := []tg.InlineKeyboardButton{}
+	addOption := func(title, value string, perLine int) {
+		if len(keyLine) == perLine {
+			keyboard.Add(keyLine)
+			keyLine = []tg.InlineKeyboardButton{}
+		}
+		btn := keyboard.Button(title).SetCallbackData(user.Callback(route, value))
+		keyLine = append(keyLine, *btn)
+	}
+
+	switch route {
+	case CB_ROUTE_SET_TIMEZONE:
+		for _, tz := range SETTINGS_TIMEZONES {
+			addOption(tz, tz, 2)
+		}
+	case CB_ROUTE_SET_LANGUAGE:
+		for _, lang := range []string{LANG_RU, LANG_EN} {
+			addOption(languageNames[lang], lang, 2)
+		}
+	case CB_ROUTE_SET_PAGE_SIZE:
+		for _, size := range SETTINGS_PAGE_SIZES {
+			addOption(fmt.Sprint(size), fmt.Sprint(size), 3)
+		}
+	case CB_ROUTE_SET_SORT:
+		for _, order := range SETTINGS_SORT_ORDERS {
+			addOption(SortOrderName(user, order), string(order), 1)
+		}
+	}
+	if len(keyLine) > 0 {
+		keyboard.Add(keyLine)
+	}
+
+	btnBack := keyboard.Button(user.T("◀ Назад")).SetCallbackData(user.Callback(CB_ROUTE_SETTINGS))
+	keyboard.Add([]tg.InlineKeyboardButton{*btnBack})
+
+	return keyboard
+}
+
 func KeyboardNewNote(user *User) (tg.InlineKeyboardMarkup, error) {
 	keyboard := tg.InlineMarkup()
 
-	// btnNewTitle := keyboard.Button("Название").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_NEW, "title"))
-	btnNewUrl := keyboard.Button("Ссылка").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_NEW, "url"))
-	btnNewDescription := keyboard.Button("Описание").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_NEW, "description"))
-	btnNewTags := keyboard.Button("Теги").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_NEW, "tags"))
+	// btnNewTitle := keyboard.Button(user.T("Название")).SetCallbackData(user.Callback(CB_ROUTE_NEW, "title"))
+	btnNewUrl := keyboard.Button(user.T("Ссылка")).SetCallbackData(user.Callback(CB_ROUTE_NEW, "url"))
+	btnNewDescription := keyboard.Button(user.T("Описание")).SetCallbackData(user.Callback(CB_ROUTE_NEW, "description"))
+	btnNewTags := keyboard.Button(user.T("Теги")).SetCallbackData(user.Callback(CB_ROUTE_NEW, "tags"))
 	keyboard.Add([]tg.InlineKeyboardButton{*btnNewUrl, *btnNewDescription, *btnNewTags})
 
-	btnNewSave := keyboard.Button("Сохранить").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_NEW, "save"))
+	btnNewSave := keyboard.Button(user.T("Сохранить")).SetCallbackData(user.Callback(CB_ROUTE_NEW, "save"))
 	keyboard.Add([]tg.InlineKeyboardButton{*btnNewSave})
+	addWizardButtons(&keyboard, user)
 
 	return keyboard, nil
 }
@@ -129,19 +578,55 @@ func KeyboardNewNote(user *User) (tg.InlineKeyboardMarkup, error) {
 func KeyboardEditNote(user *User) (tg.InlineKeyboardMarkup, error) {
 	keyboard := tg.InlineMarkup()
 
-	btnNewTitle := keyboard.Button("Название").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_EDITING, "title"))
-	btnNewUrl := keyboard.Button("Ссылка").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_EDITING, "url"))
-	btnNewDescription := keyboard.Button("Описание").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_EDITING, "description"))
-	btnNewTags := keyboard.Button("Теги").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_EDITING, "tags"))
+	btnNewTitle := keyboard.Button(user.T("Название")).SetCallbackData(user.Callback(CB_ROUTE_EDITING, "title"))
+	btnNewUrl := keyboard.Button(user.T("Ссылка")).SetCallbackData(user.Callback(CB_ROUTE_EDITING, "url"))
+	btnNewDescription := keyboard.Button(user.T("Описание")).SetCallbackData(user.Callback(CB_ROUTE_EDITING, "description"))
+	btnNewTags := keyboard.Button(user.T("Теги")).SetCallbackData(user.Callback(CB_ROUTE_EDITING, "tags"))
 	keyboard.Add([]tg.InlineKeyboardButton{*btnNewTitle, *btnNewUrl, *btnNewDescription, *btnNewTags})
 
-	btnNewSave := keyboard.Button("Обновить").SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_EDITING, "update"))
+	btnNewSave := keyboard.Button(user.T("Обновить")).SetCallbackData(user.Callback(CB_ROUTE_EDITING, "update"))
 	keyboard.Add([]tg.InlineKeyboardButton{*btnNewSave})
+	addWizardButtons(&keyboard, user)
+
+	return keyboard, nil
+}
+
+// KeyboardWizard только кнопки перехода по шагам мастера
+func KeyboardWizard(user *User) (tg.InlineKeyboardMarkup, error) {
+	keyboard := tg.InlineMarkup()
+	addWizardButtons(&keyboard, user)
 
 	return keyboard, nil
 }
 
-func KeyboardTags(tags []string) (tg.InlineKeyboardMarkup, error) {
+// addWizardButtons добавляет строку "Назад", "Пропустить", "Отмена" для текущего шага мастера
+func addWizardButtons(keyboard *tg.InlineKeyboardMarkup, user *User) {
+	w := activeWizard(user)
+	if w == nil {
+		return
+	}
+	step, err := w.Current(user.Wizard)
+	if err != nil {
+		return
+	}
+
+	keyLine := []tg.InlineKeyboardButton{}
+	if user.Wizard.Step > 0 {
+		btnBack := keyboard.Button(user.T("◀ Назад")).SetCallbackData(user.Callback(CB_ROUTE_WIZARD, "back"))
+		keyLine = append(keyLine, *btnBack)
+	}
+	if step.Optional {
+		btnSkip := keyboard.Button(user.T("Пропустить")).SetCallbackData(user.Callback(CB_ROUTE_WIZARD, "skip"))
+		keyLine = append(keyLine, *btnSkip)
+	}
+	btnCancel := keyboard.Button(user.T("Отмена")).SetCallbackData(user.Callback(CB_ROUTE_WIZARD, "cancel"))
+	keyLine = append(keyLine, *btnCancel)
+	keyboard.Add(keyLine)
+}
+
+// KeyboardTags теги пользователя, отмеченные теги помечаются и ищутся вместе.
+// В кнопке id тега, а не название: длинное название не влезет в данные кнопки
+func KeyboardTags(user *User, tags []models.Tag) (tg.InlineKeyboardMarkup, error) {
 	keyboard := tg.InlineMarkup()
 
 	keyLine := []tg.InlineKeyboardButton{}
@@ -151,58 +636,84 @@ func KeyboardTags(tags []string) (tg.InlineKeyboardMarkup, error) {
 			keyboard.Add(keyLine)
 			keyLine = []tg.InlineKeyboardButton{}
 		}
-		btn := keyboard.Button(tag).SetCallbackData(fmt.Sprintf("%s %s", CB_ROUTE_SEARCH_TAG, tag))
+		title := tag.Title
+		if user.IsTagSelected(tag.Title) {
+			title = "✅ " + tag.Title
+		}
+		btn := keyboard.Button(title).SetCallbackData(user.Callback(CB_ROUTE_TAG_TOGGLE, tag.Id))
 		keyLine = append(keyLine, *btn)
 	}
 	if len(keyLine) > 0 {
 		keyboard.Add(keyLine)
 	}
+	if len(user.SelectedTags) > 0 {
+		btnApply := keyboard.Button(fmt.Sprintf(user.T("🔍 Показать (%d)"), len(user.SelectedTags))).SetCallbackData(user.Callback(CB_ROUTE_TAG_APPLY))
+		btnReset := keyboard.Button(user.T("✖ Сбросить")).SetCallbackData(user.Callback(CB_ROUTE_TAG_RESET))
+		keyboard.Add([]tg.InlineKeyboardButton{*btnApply, *btnReset})
+	}
 
 	return keyboard, nil
 }
 
-func KeyboardListByTag(user *User, tag string) (tg.InlineKeyboardMarkup, error) {
+// KeyboardListByTag заметки по запросу из тегов, например "#a | #b -#c"
+func KeyboardListByTag(user *User, query string) (tg.InlineKeyboardMarkup, error) {
 	keyboard := tg.InlineMarkup()
-	notes, err := models.GetNotesByTag(user.Id, tag)
+	node, err := tagquery.Parse(query)
+	if err != nil {
+		return keyboard, err
+	}
+	notes, err := storage.GetNotesByTagQuery(user.Id, node, user.Settings.SortOrder)
 	if err != nil {
 		return keyboard, err
 	}
 
-	_start := max(int(user.NotePage*LIST_PAGE_SIZE), 0)
-	_end := min(int(user.NotePage*LIST_PAGE_SIZE+LIST_PAGE_SIZE), len(notes))
+	pageSize := user.PageSize()
+	_start := max(int(user.NotePage)*pageSize, 0)
+	_end := min(int(user.NotePage)*pageSize+pageSize, len(notes))
 	_start = min(_start, _end)
 	_end = max(_start, _end)
 
+	progress := checklistProgress(user, notes[_start:_end])
 	for _, note := range notes[_start:_end] {
-		btnShow := keyboard.Button(note.Title).SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_TAG_SHOW, note.Id))
-		keyboard.Add([]tg.InlineKeyboardButton{*btnShow})
-
-		btns := []tg.InlineKeyboardButton{}
-
-		btnEdit := keyboard.Button("📝")
-		btnEdit.SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_EDIT, note.Id))
-		btns = append(btns, *btnEdit)
-
-		if note.Url != "" {
-			btnOpen := keyboard.Button("📖")
-			btnOpen.SetUrl(note.Url)
-			btns = append(btns, *btnOpen)
-		}
+		KeyboardNoteRows(&keyboard, user, note, progress[note.Id], CB_ROUTE_TAG_SHOW)
+	}
+	btnsControl := []tg.InlineKeyboardButton{}
+	btnPrev := keyboard.Button("<<").SetCallbackData(user.Callback(CB_ROUTE_SEARCH_TAG_PREV))
+	if user.NotePage > 0 {
+		btnsControl = append(btnsControl, *btnPrev)
+	}
+	btnNext := keyboard.Button(">>").SetCallbackData(user.Callback(CB_ROUTE_SEARCH_TAG_NEXT))
+	if int(user.NotePage)*pageSize+pageSize < len(notes) {
+		btnsControl = append(btnsControl, *btnNext)
+	}
+	keyboard.Add(btnsControl)
+	return keyboard, nil
+}
 
-		btnDel := keyboard.Button("❌")
-		btnDel.SetCallbackData(fmt.Sprintf("%s %v", CB_ROUTE_DEL, note.Id))
-		btns = append(btns, *btnDel)
+func KeyboardSearch(user *User) (tg.InlineKeyboardMarkup, error) {
+	keyboard := tg.InlineMarkup()
+	notes, err := storage.SearchNotesFuzzy(user.Id, user.SearchQuery)
+	if err != nil {
+		return keyboard, err
+	}
 
-		keyboard.Add(btns)
+	pageSize := user.PageSize()
+	_start := max(int(user.NotePage)*pageSize, 0)
+	_end := min(int(user.NotePage)*pageSize+pageSize, len(notes))
+	_start = min(_start, _end)
+	_end = max(_start, _end)
 
+	progress := checklistProgress(user, notes[_start:_end])
+	for _, note := range notes[_start:_end] {
+		KeyboardNoteRows(&keyboard, user, note, progress[note.Id], CB_ROUTE_SEARCH_SHOW)
 	}
 	btnsControl := []tg.InlineKeyboardButton{}
-	btnPrev := keyboard.Button("<<").SetCallbackData("_list_prev")
+	btnPrev := keyboard.Button("<<").SetCallbackData(user.Callback(CB_ROUTE_SEARCH_PREV))
 	if user.NotePage > 0 {
 		btnsControl = append(btnsControl, *btnPrev)
 	}
-	btnNext := keyboard.Button(">>").SetCallbackData("_list_next")
-	if int(user.NotePage*LIST_PAGE_SIZE)+LIST_PAGE_SIZE < len(notes) {
+	btnNext := keyboard.Button(">>").SetCallbackData(user.Callback(CB_ROUTE_SEARCH_NEXT))
+	if int(user.NotePage)*pageSize+pageSize < len(notes) {
 		btnsControl = append(btnsControl, *btnNext)
 	}
 	keyboard.Add(btnsControl)
@@ -0,0 +1,599 @@
+// Package dateparse разбирает дату и время, записанные человеческим языком на русском или английском:
+//
+//	завтра в 10
+//	через 2 часа
+//	в пятницу 18:30
+//	15.11 9:00
+//	15 ноября в 7 вечера
+//	tomorrow at 10am
+//	in 30 minutes
+//	next monday 9:00
+//	next month
+//	tonight at 9
+//
+// Относительные даты считаются от переданного момента now, результат возвращается в его часовом поясе.
+package dateparse
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrUnknown = errors.New("dateparse: can't parse date")
+
+// DefaultHour час, который подставляется, если указана только дата
+const DefaultHour = 9
+
+type date struct {
+	year     int
+	month    time.Month
+	day      int
+	hasYear  bool
+	weekday  bool
+	relative bool
+}
+
+type clock struct {
+	hour      int
+	minute    int
+	ambiguous bool // час до полудня без am/pm и "утра/вечера", часть суток может его сдвинуть
+}
+
+type parser struct {
+	now      time.Time
+	date     *date
+	clock    *clock
+	absolute *time.Time
+	period   *clock // часть суток без точного времени: вечером, tonight
+	meridiem string // как понимать час без am/pm в этой части суток
+}
+
+// Parse разбирает text относительно now
+func Parse(text string, now time.Time) (time.Time, error) {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return time.Time{}, ErrUnknown
+	}
+
+	p := parser{now: now}
+	for i := 0; i < len(tokens); {
+		n, err := p.consume(tokens[i:])
+		if err != nil {
+			return time.Time{}, err
+		}
+		i += n
+	}
+
+	return p.result()
+}
+
+func tokenize(text string) []string {
+	text = strings.ToLower(strings.TrimSpace(text))
+	text = strings.NewReplacer("ё", "е", ",", " ").Replace(text)
+	return strings.Fields(text)
+}
+
+var fillers = map[string]bool{
+	"в": true, "во": true, "к": true, "на": true, "и": true,
+	"at": true, "on": true, "the": true, "of": true, "this": true, "by": true,
+}
+
+func (p *parser) consume(tokens []string) (int, error) {
+	head := tokens[0]
+
+	if n, ok := p.relative(tokens); ok {
+		return n, nil
+	}
+	if n, ok := p.dayWord(tokens); ok {
+		return n, nil
+	}
+	if n, ok := p.weekday(tokens); ok {
+		return n, nil
+	}
+	if n, ok := p.calendarDate(tokens); ok {
+		return n, nil
+	}
+	if n, ok := p.timeOfDay(tokens); ok {
+		return n, nil
+	}
+	if fillers[head] {
+		return 1, nil
+	}
+
+	return 0, fmt.Errorf("%w: unexpected %q", ErrUnknown, head)
+}
+
+func (p *parser) result() (time.Time, error) {
+	loc := p.now.Location()
+
+	if p.absolute != nil {
+		if p.date != nil || p.clock != nil || p.period != nil {
+			return time.Time{}, fmt.Errorf("%w: relative time can't be combined with a date", ErrUnknown)
+		}
+		return *p.absolute, nil
+	}
+	if p.date == nil && p.clock == nil && p.period == nil {
+		return time.Time{}, ErrUnknown
+	}
+
+	c := clock{hour: DefaultHour}
+	switch {
+	case p.clock != nil:
+		c = *p.clock
+		if c.ambiguous && p.period != nil {
+			c.hour = toDayHour(c.hour, p.meridiem)
+		}
+	case p.period != nil:
+		c = *p.period
+	}
+
+	if p.date == nil {
+		t := time.Date(p.now.Year(), p.now.Month(), p.now.Day(), c.hour, c.minute, 0, 0, loc)
+		if !t.After(p.now) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+
+	d := *p.date
+	t := time.Date(d.year, d.month, d.day, c.hour, c.minute, 0, 0, loc)
+	if t.Day() != d.day {
+		return time.Time{}, fmt.Errorf("%w: no such day", ErrUnknown)
+	}
+	switch {
+	case d.weekday && !t.After(p.now):
+		t = t.AddDate(0, 0, 7)
+	case !d.hasYear && !d.relative && t.Before(p.now.AddDate(0, 0, -1)):
+		t = t.AddDate(1, 0, 0)
+	}
+
+	return t, nil
+}
+
+func (p *parser) setDate(d date) error {
+	if p.date != nil {
+		return fmt.Errorf("%w: date is set twice", ErrUnknown)
+	}
+	p.date = &d
+	return nil
+}
+
+func (p *parser) setClock(hour, minute int, ambiguous bool) bool {
+	if p.clock != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return false
+	}
+	p.clock = &clock{hour: hour, minute: minute, ambiguous: ambiguous}
+	return true
+}
+
+// setPeriod часть суток: время по умолчанию и как понимать час, указанный без am/pm
+func (p *parser) setPeriod(hour int, meridiem string) bool {
+	if p.period != nil {
+		return false
+	}
+	p.period = &clock{hour: hour}
+	p.meridiem = meridiem
+	return true
+}
+
+func (p *parser) dayOffset(days int) date {
+	t := p.now.AddDate(0, 0, days)
+	return date{year: t.Year(), month: t.Month(), day: t.Day(), hasYear: true, relative: true}
+}
+
+// сегодня, завтра, послезавтра, today, tomorrow, day after tomorrow
+func (p *parser) dayWord(tokens []string) (int, bool) {
+	offset, n := 0, 1
+	switch tokens[0] {
+	case "сегодня", "today", "tonight":
+	case "завтра", "tomorrow":
+		offset = 1
+	case "послезавтра":
+		offset = 2
+	case "day":
+		if len(tokens) < 3 || tokens[1] != "after" || tokens[2] != "tomorrow" {
+			return 0, false
+		}
+		offset, n = 2, 3
+	default:
+		return 0, false
+	}
+	if p.setDate(p.dayOffset(offset)) != nil {
+		return 0, false
+	}
+	if tokens[0] == "tonight" {
+		p.setPeriod(20, "pm")
+	}
+	return n, true
+}
+
+// через 2 часа, через неделю, in 30 minutes, in an hour, next month, в следующем году
+func (p *parser) relative(tokens []string) (int, bool) {
+	if tokens[0] != "через" && tokens[0] != "in" && !isNext(tokens[0]) {
+		return 0, false
+	}
+	if len(tokens) < 2 {
+		return 0, false
+	}
+
+	amount, n := 1, 1
+	if isNext(tokens[0]) {
+		// next monday разбирает weekday, здесь только единицы календаря
+		if !hasAnyPrefix(tokens[1], "недел", "week", "месяц", "month", "год", "year") {
+			return 0, false
+		}
+	} else if v, ok := parseAmount(tokens[1]); ok {
+		if len(tokens) < 3 {
+			return 0, false
+		}
+		amount, n = v, 2
+	}
+
+	unit := tokens[n]
+	if unit == "полчаса" || (unit == "half" && len(tokens) > n+2 && tokens[n+1] == "an" && tokens[n+2] == "hour") {
+		t := p.now.Add(30 * time.Minute).Truncate(time.Minute)
+		p.absolute = &t
+		if unit == "half" {
+			return n + 3, true
+		}
+		return n + 1, true
+	}
+
+	switch {
+	case hasAnyPrefix(unit, "минут", "мин", "minute", "min"):
+		t := p.now.Add(time.Duration(amount) * time.Minute).Truncate(time.Minute)
+		p.absolute = &t
+	case hasAnyPrefix(unit, "час", "hour", "hr") || unit == "ч" || unit == "h":
+		t := p.now.Add(time.Duration(amount) * time.Hour).Truncate(time.Minute)
+		p.absolute = &t
+	case hasAnyPrefix(unit, "дн", "день", "сут", "day"):
+		if p.setDate(p.dayOffset(amount)) != nil {
+			return 0, false
+		}
+	case hasAnyPrefix(unit, "недел", "week"):
+		if p.setDate(p.dayOffset(amount*7)) != nil {
+			return 0, false
+		}
+	case hasAnyPrefix(unit, "месяц", "month"):
+		t := p.now.AddDate(0, amount, 0)
+		if p.setDate(date{year: t.Year(), month: t.Month(), day: t.Day(), hasYear: true, relative: true}) != nil {
+			return 0, false
+		}
+	case hasAnyPrefix(unit, "год", "лет", "year"):
+		t := p.now.AddDate(amount, 0, 0)
+		if p.setDate(date{year: t.Year(), month: t.Month(), day: t.Day(), hasYear: true, relative: true}) != nil {
+			return 0, false
+		}
+	default:
+		return 0, false
+	}
+
+	return n + 1, true
+}
+
+// основы русских названий дней недели: пятница, в пятницу, по пятницам
+var weekdayStems = []struct {
+	stem string
+	day  time.Weekday
+}{
+	{"понед", time.Monday}, {"вторн", time.Tuesday}, {"сред", time.Wednesday}, {"четв", time.Thursday},
+	{"пятн", time.Friday}, {"субб", time.Saturday}, {"воскр", time.Sunday},
+}
+
+// сокращения и английские названия дней недели, совпадают только целым словом
+var weekdayWords = map[string]time.Weekday{
+	"пн": time.Monday, "вт": time.Tuesday, "ср": time.Wednesday, "чт": time.Thursday,
+	"пт": time.Friday, "сб": time.Saturday, "вс": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+	"sun": time.Sunday, "sunday": time.Sunday,
+}
+
+// ParseWeekday день недели по слову в нижнем регистре: пятницу, пт, fri, fridays.
+// Английские слова сравниваются целиком, иначе month стал бы понедельником
+func ParseWeekday(token string) (time.Weekday, bool) {
+	if day, ok := weekdayWords[token]; ok {
+		return day, true
+	}
+	if strings.HasSuffix(token, "days") {
+		if day, ok := weekdayWords[strings.TrimSuffix(token, "s")]; ok {
+			return day, true
+		}
+	}
+	for _, w := range weekdayStems {
+		if strings.HasPrefix(token, w.stem) {
+			return w.day, true
+		}
+	}
+	return 0, false
+}
+
+func isNext(token string) bool {
+	return token == "next" || hasAnyPrefix(token, "следующ")
+}
+
+// в пятницу, в следующий понедельник, on friday, next monday
+func (p *parser) weekday(tokens []string) (int, bool) {
+	n := 0
+	next := false
+	if isNext(tokens[0]) {
+		if len(tokens) < 2 {
+			return 0, false
+		}
+		next, n = true, 1
+	}
+
+	day, ok := ParseWeekday(tokens[n])
+	if !ok {
+		return 0, false
+	}
+
+	offset := (int(day) - int(p.now.Weekday()) + 7) % 7
+	if next && offset == 0 {
+		offset = 7
+	}
+	d := p.dayOffset(offset)
+	d.relative = false
+	d.weekday = !next
+	if p.setDate(d) != nil {
+		return 0, false
+	}
+	return n + 1, true
+}
+
+var monthStems = []struct {
+	stem  string
+	month time.Month
+}{
+	{"январ", time.January}, {"феврал", time.February}, {"март", time.March}, {"апрел", time.April},
+	{"ма", time.May}, {"июн", time.June}, {"июл", time.July}, {"август", time.August},
+	{"сентябр", time.September}, {"октябр", time.October}, {"ноябр", time.November}, {"декабр", time.December},
+	{"jan", time.January}, {"feb", time.February}, {"mar", time.March}, {"apr", time.April},
+	{"may", time.May}, {"jun", time.June}, {"jul", time.July}, {"aug", time.August},
+	{"sep", time.September}, {"oct", time.October}, {"nov", time.November}, {"dec", time.December},
+}
+
+func parseMonth(token string) (time.Month, bool) {
+	token = strings.TrimSuffix(token, ".")
+	if len([]rune(token)) < 3 {
+		return 0, false
+	}
+	for _, m := range monthStems {
+		if strings.HasPrefix(token, m.stem) {
+			return m.month, true
+		}
+	}
+	return 0, false
+}
+
+// 15.11, 15.11.2026, 2026-11-15, 15 ноября 2026, nov 15
+func (p *parser) calendarDate(tokens []string) (int, bool) {
+	head := tokens[0]
+
+	if d, ok := p.numericDate(head); ok {
+		if p.setDate(d) != nil {
+			return 0, false
+		}
+		return 1, true
+	}
+
+	// 15 ноября [2026]
+	if day, err := strconv.Atoi(head); err == nil && len(tokens) > 1 {
+		if month, ok := parseMonth(tokens[1]); ok {
+			d := date{year: p.now.Year(), month: month, day: day}
+			n := 2
+			if len(tokens) > 2 {
+				if year, ok := parseYear(tokens[2]); ok {
+					d.year, d.hasYear = year, true
+					n = 3
+				}
+			}
+			if p.setDate(d) != nil {
+				return 0, false
+			}
+			return n, true
+		}
+	}
+
+	// nov 15 [2026]
+	if month, ok := parseMonth(head); ok && len(tokens) > 1 {
+		day, err := strconv.Atoi(strings.TrimRight(tokens[1], "stndrh"))
+		if err != nil {
+			return 0, false
+		}
+		d := date{year: p.now.Year(), month: month, day: day}
+		n := 2
+		if len(tokens) > 2 {
+			if year, ok := parseYear(tokens[2]); ok {
+				d.year, d.hasYear = year, true
+				n = 3
+			}
+		}
+		if p.setDate(d) != nil {
+			return 0, false
+		}
+		return n, true
+	}
+
+	return 0, false
+}
+
+func (p *parser) numericDate(token string) (date, bool) {
+	if parts := strings.Split(token, "-"); len(parts) == 3 && len(parts[0]) == 4 {
+		year, err1 := strconv.Atoi(parts[0])
+		month, err2 := strconv.Atoi(parts[1])
+		day, err3 := strconv.Atoi(parts[2])
+		if err1 != nil || err2 != nil || err3 != nil || month < 1 || month > 12 {
+			return date{}, false
+		}
+		return date{year: year, month: time.Month(month), day: day, hasYear: true}, true
+	}
+
+	parts := strings.Split(strings.TrimSuffix(token, "."), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return date{}, false
+	}
+	day, err1 := strconv.Atoi(parts[0])
+	month, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || month < 1 || month > 12 || day < 1 || day > 31 {
+		return date{}, false
+	}
+	d := date{year: p.now.Year(), month: time.Month(month), day: day}
+	if len(parts) == 3 {
+		year, ok := parseYear(parts[2])
+		if !ok {
+			return date{}, false
+		}
+		d.year, d.hasYear = year, true
+	}
+	return d, true
+}
+
+func parseYear(token string) (int, bool) {
+	token = strings.TrimSuffix(strings.TrimSuffix(token, "г."), "г")
+	if len(token) != 2 && len(token) != 4 {
+		return 0, false
+	}
+	year, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, false
+	}
+	if year < 100 {
+		year += 2000
+	}
+	return year, true
+}
+
+// 10, 10:30, 7 вечера, 3pm, утром, noon
+func (p *parser) timeOfDay(tokens []string) (int, bool) {
+	head := tokens[0]
+
+	switch head {
+	case "полдень", "noon":
+		return 1, p.setClock(12, 0, false)
+	case "полночь", "midnight":
+		return 1, p.setClock(0, 0, false)
+	case "утром", "morning":
+		return 1, p.setPeriod(9, "am")
+	case "днем", "afternoon":
+		return 1, p.setPeriod(13, "pm")
+	case "вечером", "evening":
+		return 1, p.setPeriod(19, "pm")
+	case "ночью", "night":
+		return 1, p.setPeriod(23, "night")
+	}
+
+	suffix := ""
+	for _, s := range []string{"am", "pm"} {
+		if strings.HasSuffix(head, s) && len(head) > len(s) {
+			head, suffix = strings.TrimSuffix(head, s), s
+			break
+		}
+	}
+
+	hour, minute, ok := parseClock(head)
+	if !ok {
+		return 0, false
+	}
+
+	n := 1
+	if suffix == "" && len(tokens) > 1 {
+		switch {
+		case tokens[1] == "am" || tokens[1] == "pm":
+			suffix, n = tokens[1], 2
+		case hasAnyPrefix(tokens[1], "утра"):
+			suffix, n = "am", 2
+		case hasAnyPrefix(tokens[1], "дня", "вечера"):
+			suffix, n = "pm", 2
+		case hasAnyPrefix(tokens[1], "ночи"):
+			suffix, n = "night", 2
+		case hasAnyPrefix(tokens[1], "час", "ч"):
+			n = 2
+		}
+	}
+
+	ambiguous := suffix == "" && hour > 0 && hour < 12
+	hour = toDayHour(hour, suffix)
+	if hour > 23 {
+		return 0, false
+	}
+
+	return n, p.setClock(hour, minute, ambiguous)
+}
+
+// toDayHour час по 24-часовой шкале для часа с am/pm, "утра", "вечера" или "ночи"
+func toDayHour(hour int, meridiem string) int {
+	switch meridiem {
+	case "am":
+		if hour == 12 {
+			hour = 0
+		}
+	case "pm":
+		if hour < 12 {
+			hour += 12
+		}
+	case "night":
+		if hour == 12 {
+			hour = 0
+		}
+		if hour >= 6 && hour < 12 {
+			hour += 12
+		}
+	}
+	return hour
+}
+
+func parseClock(token string) (hour, minute int, ok bool) {
+	parts := strings.Split(token, ":")
+	if len(parts) > 2 {
+		return 0, 0, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts[0]) > 2 {
+		return 0, 0, false
+	}
+	if len(parts) == 2 {
+		if len(parts[1]) != 2 {
+			return 0, 0, false
+		}
+		minute, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return hour, minute, hour <= 24 && minute < 60
+}
+
+var amountWords = map[string]int{
+	"один": 1, "одну": 1, "одна": 1, "два": 2, "две": 2, "три": 3, "четыре": 4, "пять": 5,
+	"шесть": 6, "семь": 7, "восемь": 8, "девять": 9, "десять": 10, "пару": 2,
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+func parseAmount(token string) (int, bool) {
+	if v, ok := amountWords[token]; ok {
+		return v, true
+	}
+	v, err := strconv.Atoi(token)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
+func hasAnyPrefix(token string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(token, prefix) {
+			return true
+		}
+	}
+	return false
+}
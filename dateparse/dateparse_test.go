@@ -0,0 +1,109 @@
+package dateparse
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// now воскресенье 18 октября 2026, 10:00
+var now = time.Date(2026, time.October, 18, 10, 0, 0, 0, time.UTC)
+
+func at(month time.Month, day, hour, minute int) time.Time {
+	return time.Date(2026, month, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want time.Time
+	}{
+		{"завтра в 10", at(time.October, 19, 10, 0)},
+		{"сегодня в 18:30", at(time.October, 18, 18, 30)},
+		{"послезавтра", at(time.October, 20, DefaultHour, 0)},
+		{"через 2 часа", at(time.October, 18, 12, 0)},
+		{"через полчаса", at(time.October, 18, 10, 30)},
+		{"через неделю", at(time.October, 25, DefaultHour, 0)},
+		{"в пятницу 18:30", at(time.October, 23, 18, 30)},
+		{"в следующий понедельник", at(time.October, 19, DefaultHour, 0)},
+		{"в воскресенье в 9", at(time.October, 25, 9, 0)},
+		{"пт 9:00", at(time.October, 23, 9, 0)},
+		{"15.11 9:00", at(time.November, 15, 9, 0)},
+		{"15 ноября в 7 вечера", at(time.November, 15, 19, 0)},
+		{"завтра вечером", at(time.October, 19, 19, 0)},
+		{"завтра вечером в 9", at(time.October, 19, 21, 0)},
+		{"завтра утром в 7:30", at(time.October, 19, 7, 30)},
+		{"в 11 ночи", at(time.October, 18, 23, 0)},
+		{"в 9", at(time.October, 19, 9, 0)},
+		{"на следующей неделе", at(time.October, 25, DefaultHour, 0)},
+		{"в следующем месяце", at(time.November, 18, DefaultHour, 0)},
+		{"tomorrow at 10am", at(time.October, 19, 10, 0)},
+		{"in 30 minutes", at(time.October, 18, 10, 30)},
+		{"in an hour", at(time.October, 18, 11, 0)},
+		{"next monday 9:00", at(time.October, 19, 9, 0)},
+		{"next sunday", at(time.October, 25, DefaultHour, 0)},
+		{"on friday at 3pm", at(time.October, 23, 15, 0)},
+		{"next week", at(time.October, 25, DefaultHour, 0)},
+		{"next month", at(time.November, 18, DefaultHour, 0)},
+		{"next year", time.Date(2027, time.October, 18, DefaultHour, 0, 0, 0, time.UTC)},
+		{"tonight", at(time.October, 18, 20, 0)},
+		{"tonight at 9", at(time.October, 18, 21, 0)},
+		{"tonight at 10:30", at(time.October, 18, 22, 30)},
+		{"nov 15", at(time.November, 15, DefaultHour, 0)},
+		{"2026-12-31 23:59", at(time.December, 31, 23, 59)},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text, now)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.text, err)
+			continue
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("Parse(%q) = %s, want %s", tt.text, got.Format(time.RFC1123), tt.want.Format(time.RFC1123))
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"month",
+		"next",
+		"next time",
+		"31.02",
+		"через 2 часа завтра",
+		"завтра послезавтра",
+		"в 25:00",
+	} {
+		if got, err := Parse(text, now); !errors.Is(err, ErrUnknown) {
+			t.Errorf("Parse(%q) = %s, %v, want ErrUnknown", text, got, err)
+		}
+	}
+}
+
+func TestParseWeekday(t *testing.T) {
+	tests := []struct {
+		token string
+		day   time.Weekday
+		ok    bool
+	}{
+		{"пятницу", time.Friday, true},
+		{"пятницам", time.Friday, true},
+		{"пт", time.Friday, true},
+		{"fri", time.Friday, true},
+		{"friday", time.Friday, true},
+		{"fridays", time.Friday, true},
+		{"thurs", time.Thursday, true},
+		{"month", 0, false},
+		{"monthly", 0, false},
+		{"sunny", 0, false},
+		{"satellite", 0, false},
+		{"mons", 0, false},
+	}
+	for _, tt := range tests {
+		day, ok := ParseWeekday(tt.token)
+		if ok != tt.ok || day != tt.day {
+			t.Errorf("ParseWeekday(%q) = %s, %v, want %s, %v", tt.token, day, ok, tt.day, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+const (
+	LANG_RU = "ru"
+	LANG_EN = "en"
+)
+
+var languageNames = map[string]string{
+	LANG_RU: "Русский",
+	LANG_EN: "English",
+}
+
+// translations переводы интерфейса, ключом служит исходная строка на русском (как в gettext).
+// Если перевода нет, показывается исходная строка.
+var translations = map[string]map[string]string{
+	LANG_EN: {
+		"Список заметок": "Notes",
+		"Новая заметка":  "New note",
+		"Бот для заметок, введите команду:\n/new - добавить заметку\n/cancel - отменить ввод\n/list - увидеть свои заметки\n/tags - ваши теги\n/reminders - ваши напоминания\n/search - поиск по заметкам\n/trash - корзина\n/settings - настройки": "Notes bot, enter a command:\n/new - add a note\n/cancel - cancel input\n/list - show your notes\n/tags - your tags\n/reminders - your reminders\n/search - search notes\n/trash - trash\n/settings - settings",
+		"Загружаю...":                           "Loading...",
+		"*Список заметок:*":                     "*Notes:*",
+		"Введите название заметки:":             "Enter the note title:",
+		"Введите название:":                     "Enter the title:",
+		"Введите ссылку:":                       "Enter the link:",
+		"Не корректная ссылка, введите ссылку:": "Invalid link, enter the link:",
+		"Введите описание:":                     "Enter the description:",
+		"Введите теги (через пробел):":          "Enter tags (space separated):",
+		"Ошибка на сервере":                     "Server error",
+		"Ошибка добавления заметки":             "Failed to add the note",
+		"Ошибка поиска заметки":                 "Failed to find the note",
+		"Ошибка удаления заметки":               "Failed to delete the note",
+		"Заметка сохранена":                     "Note saved",
+		"Заметка обновлена":                     "Note updated",
+		"Заметка не выбрана":                    "No note selected",
+		"Заметка не найдена":                    "Note not found",
+		"Заметка \"%s\" удалена":                "Note \"%s\" deleted",
+		"Ваши теги":                             "Your tags",
+		"Тег не выбран":                         "No tag selected",
+		"Название":                              "Title",
+		"Ссылка":                                "Link",
+		"Описание":                              "Description",
+		"Теги":                                  "Tags",
+		"Сохранить":                             "Save",
+		"Обновить":                              "Update",
+		"*Название:* %s \n*Ссылка:* %s \n*Описание:* %s \n*Теги:* %s":           "*Title:* %s \n*Link:* %s \n*Description:* %s \n*Tags:* %s",
+		"*Название:* _%s_ \n*Ссылка:* _%s_ \n*Описание:* _%s_ \n*Теги:* _ %s _": "*Title:* _%s_ \n*Link:* _%s_ \n*Description:* _%s_ \n*Tags:* _ %s _",
+		"⏰ Напомнить":                   "⏰ Remind",
+		"⏰ *Напоминание*\n\n%s":         "⏰ *Reminder*\n\n%s",
+		"Напоминание установлено на %s": "Reminder set for %s",
+		", повтор %s":                   ", repeat %s",
+		"Ваши напоминания:":             "Your reminders:",
+		"Напоминаний нет":               "No reminders",
+		"Напоминание не найдено":        "Reminder not found",
+		"Не удалось разобрать дату, попробуйте так: \"завтра в 10\", \"через 2 часа\", \"в пятницу 18:30\", \"15.11 9:00\" или \"ежедневно в 10:00\":": "Can't parse the date, try: \"tomorrow at 10\", \"in 2 hours\", \"on friday 18:30\", \"15.11 9:00\" or \"daily 10:00\":",
+		"Когда напомнить о заметке \"%s\"? Например:\n" +
+			"завтра в 10\nчерез 2 часа\nв пятницу 18:30\n15.11 9:00\n\n" +
+			"Или правило повтора:\nежедневно в 10:00\nпо пн,пт 9:00\nежемесячно 15 в 9:00\ncron 0 9 * * 1-5": "When should I remind you about \"%s\"? For example:\n" +
+			"tomorrow at 10\nin 2 hours\non friday 18:30\n15.11 9:00\n\n" +
+			"Or a repeat rule:\ndaily 10:00\nevery mon,fri 9:00\nmonthly 15 9:00\ncron 0 9 * * 1-5",
+		"⚙ Настройки":        "⚙ Settings",
+		"🌍 Часовой пояс: %s": "🌍 Time zone: %s",
+		"🗣 Язык: %s":         "🗣 Language: %s",
+		"📄 На странице: %v":  "📄 Page size: %v",
+		"↕ Сортировка: %s":   "↕ Sort: %s",
+		"время сервера":      "server time",
+		"сначала новые":      "newest first",
+		"сначала старые":     "oldest first",
+		"по названию":        "by title",
+		"◀ Назад":            "◀ Back",
+		"Выберите часовой пояс или отправьте его название, например Asia/Tokyo:": "Choose a time zone or send its name, e.g. Asia/Tokyo:",
+		"Неизвестный часовой пояс, отправьте название, например Europe/Moscow:":  "Unknown time zone, send its name, e.g. Europe/Moscow:",
+		"Часовой пояс установлен: %s":                                            "Time zone set: %s",
+		"Сколько заметок показывать на странице?":                                "How many notes per page?",
+		"Как сортировать заметки?":                                               "How should notes be sorted?",
+		"Выберите язык:": "Choose a language:",
+		"Введите запрос после команды, например /search docker, или просто отправьте текст": "Type a query after the command, e.g. /search docker, or just send the text",
+		"Результаты поиска \"%s\":":           "Search results for \"%s\":",
+		"Ничего не найдено по запросу \"%s\"": "Nothing found for \"%s\"",
+		"Заметки по тегам: %s":                "Notes by tags: %s",
+		"Нет заметок по тегам: %s":            "No notes by tags: %s",
+		"🔍 Показать (%d)":                     "🔍 Show (%d)",
+		"✖ Сбросить":                          "✖ Reset",
+		TAGS_HELP:                             "Select tags and press «Show» to find notes with all of them.\nComplex queries: /search #work #go -#archived, /search (#a | #b) #c",
+		"Не удалось разобрать запрос по тегам: %s\n\nПримеры: #work #go -#archived, #a | #b, (#a | #b) #c": "Can't parse the tag query: %s\n\nExamples: #work #go -#archived, #a | #b, (#a | #b) #c",
+		"Пропустить": "Skip",
+		"Отмена":     "Cancel",
+		"Этот шаг нельзя пропустить":             "This step can't be skipped",
+		"Действие отменено":                      "Cancelled",
+		"Нечего отменять":                        "Nothing to cancel",
+		"📝 Редактировать":                        "📝 Edit",
+		"✏ Название":                             "✏ Title",
+		"🏷 Теги":                                 "🏷 Tags",
+		"Пересланное сообщение":                  "Forwarded message",
+		"Источник:":                              "Source:",
+		" \n*Вложения:* %d":                      " \n*Attachments:* %d",
+		"Вложение добавлено, всего вложений: %d": "Attachment added, %d in total",
+		"Этот файл уже прикреплён к заметке":     "This file is already attached to the note",
+		"➕ Пункт":                                "➕ Item",
+		"🧹 Убрать отмеченные":                    "🧹 Remove checked",
+		" \n*Выполнено:* %s":                     " \n*Done:* %s",
+		"Отправьте пункты списка, каждый с новой строки:": "Send the checklist items, one per line:",
+		"Пункты добавлены":        "Items added",
+		"📋 Открыть заметку":       "📋 Open the note",
+		"🕓 История":               "🕓 History",
+		"↩ Восстановить":          "↩ Restore",
+		"*История:* %s":           "*History:* %s",
+		"Заметка ещё не менялась": "The note has not been changed yet",
+		"*Версия от %s*":          "*Version of %s*",
+		"*Изменено после:* %s":    "*Changed afterwards:* %s",
+		"Заметка восстановлена":   "Note restored",
+		"название":                "title",
+		"ссылка":                  "link",
+		"описание":                "description",
+		"теги":                    "tags",
+		"без изменений":           "no changes",
+		"🗑 Удалить":               "🗑 Delete",
+		"↩ Отменить":              "↩ Undo",
+		"♻ Восстановить":          "♻ Restore",
+		"🔥 Удалить навсегда":      "🔥 Delete forever",
+		"Корзина пуста":           "Trash is empty",
+		"Корзина. Заметки удаляются навсегда через %d дн. после удаления:": "Trash. Notes are deleted forever %d days after deletion:",
+		"Удалить заметку \"%s\"?":      "Delete the note \"%s\"?",
+		"Удаление отменено":            "Deletion cancelled",
+		"Заметка \"%s\" восстановлена": "Note \"%s\" restored",
+		"Удалить заметку \"%s\" навсегда? Её нельзя будет восстановить": "Delete the note \"%s\" forever? It cannot be restored",
+		"Кнопка устарела, откройте меню заново":                         "This button is outdated, please open the menu again",
+		"Не удалось сохранить изменения, повторите действие":            "Could not save the changes, please try again",
+	},
+}
+
+// Translate перевод строки на язык lang
+func Translate(lang, text string) string {
+	if t, ok := translations[lang][text]; ok {
+		return t
+	}
+	return text
+}
@@ -12,7 +12,7 @@ package main
 поиск по тегу
 редактировать теги у заметки
 
-Добавить событие по расписанию с сообщением в ТГ с зметкой
+напоминание о заметке в назначенное время (кнопка ⏰)
 
 
 
@@ -21,36 +21,40 @@ start - начать работать с ботом
 list - показать все заметки
 new - добавить заметку
 tags - ваши теги
+reminders - ваши напоминания
+settings - настройки
+search - поиск по заметкам
+trash - корзина
 */
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
-	"strings"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/joho/godotenv"
+	"github.com/playmixer/bot-note/callback"
+	"github.com/playmixer/bot-note/migrations"
 	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/state"
 	"github.com/playmixer/corvid/logger"
 	tg "github.com/playmixer/telegram-bot-api/v3"
 )
 
 var (
-	bot   *tg.TelegramBot
-	log   *logger.Logger
-	store UserStore
+	bot     *tg.TelegramBot
+	log     *logger.Logger
+	store   *UserStore
+	storage models.Storage
 )
 
-func init() {
-	store = UserStore{
-		data: make(map[int64]User),
-		mu:   sync.Mutex{},
-	}
-}
-
 func main() {
 	var err error
 	log = logger.New("app")
@@ -66,9 +70,58 @@ func main() {
 		http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
 
-	models.DB, err = models.Connect(os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
-	if err != nil {
-		panic(err)
+	dialect := ""
+	switch os.Getenv("DB_DRIVER") {
+	case "memory":
+		log.WARN("memory storage is used, data will be lost on restart")
+		storage = models.NewMemory()
+	case "sqlite":
+		path := os.Getenv("DB_PATH")
+		if path == "" {
+			path = "bot-note.db"
+		}
+		models.DB, err = models.ConnectSQLite(path)
+		if err != nil {
+			panic(err)
+		}
+		storage = models.NewSQLite(models.DB)
+		dialect = migrations.DIALECT_SQLITE
+	case "", "postgres":
+		models.DB, err = models.Connect(os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_NAME"))
+		if err != nil {
+			panic(err)
+		}
+		storage = models.NewPostgres(models.DB)
+		dialect = migrations.DIALECT_POSTGRES
+	default:
+		log.ERROR(fmt.Sprintf("unknown DB_DRIVER %q", os.Getenv("DB_DRIVER")))
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err = runMigrate(dialect, os.Args[2:]); err != nil {
+			log.ERROR(err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if dialect != "" {
+		if err = migrateUp(context.Background(), dialect); err != nil {
+			log.ERROR(fmt.Sprintf("migration error: %s", err))
+			return
+		}
+	}
+
+	var states state.Store = state.NewMemory()
+	if models.DB != nil {
+		states = state.NewSQL(models.DB)
+	}
+	store = NewUserStore(states, USER_STATE_TTL)
+
+	if secret := os.Getenv("CALLBACK_SECRET"); secret != "" {
+		signer = callback.NewSigner(secret)
+	} else {
+		log.WARN("CALLBACK_SECRET is not set, callback data is not signed")
 	}
 
 	bot, err = tg.NewBot(os.Getenv("TELEGRAM_BOT_API_KEY"))
@@ -77,63 +130,55 @@ func main() {
 		return
 	}
 
-	bot.AddHandle(tg.Command("start", start))
-	bot.AddHandle(tg.Command("new", new))
-	bot.AddHandle(tg.Command("list", list))
-	bot.AddHandle(tg.Command("tags", tags))
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SEARCH_TAG) {
-			cbSearchByTag(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SEARCH_TAG_PREV) ||
-			strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SEARCH_TAG_NEXT) {
-			cbChangePageByTag(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_SHOW) ||
-			strings.Contains(update.CallbackQuery.Data, CB_ROUTE_TAG_SHOW) {
-			cbShow(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_LIST_ALL) {
-			cbList(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_NEW) {
-			cbNew(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_EDIT) {
-			cbEdit(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_EDITING) {
-			cbEditing(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_DEL) {
-			cbDelete(update, bot)
-		}
-	})
-	bot.AddHandle(func(update tg.UpdateResult, bot *tg.TelegramBot) {
-		if strings.Contains(update.CallbackQuery.Data, CB_ROUTE_LIST_PREV) ||
-			strings.Contains(update.CallbackQuery.Data, CB_ROUTE_LIST_NEXT) {
-			cbChangePage(update, bot)
-		}
+	bot.AddHandle(onMessage(tg.Command("start", handle(start))))
+	bot.AddHandle(onMessage(tg.Command("new", handle(new))))
+	bot.AddHandle(onMessage(tg.Command("list", handle(list))))
+	bot.AddHandle(onMessage(tg.Command("tags", handle(tags))))
+	bot.AddHandle(onMessage(tg.Command("reminders", handle(reminders))))
+	bot.AddHandle(onMessage(tg.Command("settings", handle(settings))))
+	bot.AddHandle(onMessage(tg.Command("search", handle(search))))
+	bot.AddHandle(onMessage(tg.Command("cancel", handle(cancelDialog))))
+	bot.AddHandle(onMessage(tg.Command("trash", handle(trash))))
+	bot.AddHandle(onCallback(handle(routeCallback, verifyCallback)))
+	bot.AddHandle(onMessage(tg.Text(handle(echo))))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	jobs := sync.WaitGroup{}
+	runJob := func(job func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+	trashRetention = trashRetentionDays()
+	runJob(func() { runScheduler(ctx, REMINDER_POLL_INTERVAL) })
+	runJob(func() { runStatePurge(ctx, STATE_PURGE_INTERVAL) })
+	runJob(func() {
+		runTrashPurge(ctx, TRASH_PURGE_INTERVAL, time.Duration(trashRetention)*time.Hour*24)
 	})
-	bot.AddHandle(tg.Text(echo))
 
 	bot.Timeout = time.Second
-	log.INFO("Start")
-	log.INFO(fmt.Sprintln(bot.WebhookServer(os.Getenv("ADDR"), os.Getenv("ROUTE"))))
-	// bot.Polling()
+	mode := os.Getenv("MODE")
+	if mode == "" {
+		mode = MODE_WEBHOOK
+	}
+	log.INFO(fmt.Sprintf("Start, mode %s", mode))
+	switch mode {
+	case MODE_WEBHOOK:
+		err = runWebhook(ctx, bot)
+	case MODE_POLLING:
+		err = poll(ctx, bot)
+	default:
+		err = fmt.Errorf("unknown MODE %q", mode)
+	}
+	if err != nil {
+		log.ERROR(err.Error())
+	}
+	// транспорт мог упасть сам, фоновые задачи тоже нужно остановить
+	stop()
+	shutdown(&jobs)
 	log.INFO("Exit")
 }
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/playmixer/bot-note/callback"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+// Request одно обновление от Telegram и пользователь, который его прислал
+type Request struct {
+	Update tg.UpdateResult
+	Bot    *tg.TelegramBot
+	ChatId int64         // id пользователя Telegram, в личном чате совпадает с id чата
+	User   *User         // состояние пользователя, сохраняется после обработчика
+	Data   callback.Data // разобранные данные кнопки, только для нажатий на кнопки
+}
+
+// IsCallback нажатие на inline-кнопку
+func (r *Request) IsCallback() bool {
+	return r.Update.CallbackQuery.Id != ""
+}
+
+// MessageId сообщение с нажатой кнопкой
+func (r *Request) MessageId() int64 {
+	return r.Update.CallbackQuery.Message.MessageId
+}
+
+type HandlerFunc func(r *Request)
+
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// middlewares общая цепочка для всех обработчиков, первый - внешний
+var middlewares = []Middleware{withRecover, withLogging}
+
+// userMiddlewares загрузка и сохранение пользователя, идут после extra из handle
+var userMiddlewares = []Middleware{withUser, withState}
+
+// handle tg.Handle из обработчика h: общая цепочка, extra и загрузка пользователя.
+// extra выполняются до withUser, чтобы отклонённое обновление не создавало пользователя и не меняло состояние
+func handle(h HandlerFunc, extra ...Middleware) tg.Handle {
+	chain := append(append(append([]Middleware{}, middlewares...), extra...), userMiddlewares...)
+	for i := len(chain) - 1; i >= 0; i-- {
+		h = chain[i](h)
+	}
+	return func(update tg.UpdateResult, bot *tg.TelegramBot) {
+		r := &Request{Update: update, Bot: bot, ChatId: update.Message.From.Id}
+		if r.IsCallback() {
+			r.ChatId = update.CallbackQuery.From.Id
+		}
+		h(r)
+	}
+}
+
+// onMessage пропускает к h только сообщения. Все обработчики получают каждое обновление,
+// поэтому цепочка с загрузкой пользователя должна стоять за таким фильтром
+func onMessage(h tg.Handle) tg.Handle {
+	return func(update tg.UpdateResult, bot *tg.TelegramBot) {
+		if update.CallbackQuery.Id == "" && update.Message.From.Id != 0 {
+			h(update, bot)
+		}
+	}
+}
+
+// onCallback пропускает к h только нажатия на inline-кнопки
+func onCallback(h tg.Handle) tg.Handle {
+	return func(update tg.UpdateResult, bot *tg.TelegramBot) {
+		if update.CallbackQuery.Id != "" {
+			h(update, bot)
+		}
+	}
+}
+
+// withRecover паника в обработчике не роняет бота, пользователь получает сообщение об ошибке.
+// Состояние пользователя после паники не сохраняется
+func withRecover(next HandlerFunc) HandlerFunc {
+	return func(r *Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				log.ERROR(fmt.Sprintf("update=%d user=%d panic: %v\n%s", r.Update.UpdateId, r.ChatId, err, debug.Stack()))
+				text := "Ошибка на сервере"
+				if r.User != nil {
+					text = r.User.T(text)
+				}
+				r.Bot.SendMessage(r.ChatId, text)
+			}
+		}()
+		next(r)
+	}
+}
+
+// withLogging одна строка на обновление: кто, что прислал и сколько длилась обработка
+func withLogging(next HandlerFunc) HandlerFunc {
+	return func(r *Request) {
+		start := time.Now()
+		next(r)
+		kind, payload := "message", r.Update.Message.Text
+		if r.IsCallback() {
+			kind, payload = "callback", r.Update.CallbackQuery.Data
+		}
+		log.INFO(fmt.Sprintf("update=%d user=%d kind=%s payload=%q duration=%s",
+			r.Update.UpdateId, r.ChatId, kind, payload, time.Since(start).Round(time.Millisecond)))
+	}
+}
+
+// withUser загружает состояние пользователя, нового пользователя сначала заводит в базе
+func withUser(next HandlerFunc) HandlerFunc {
+	return func(r *Request) {
+		user := store.Get(r.ChatId)
+		if user.Id == 0 {
+			if err := CacheUserStore(r.ChatId); err != nil {
+				log.ERROR(fmt.Sprintf("%v cached user store error: %s", r.ChatId, err))
+				return
+			}
+			user = store.Get(r.ChatId)
+		}
+		r.User = &user
+		next(r)
+	}
+}
+
+// withState сохраняет состояние пользователя после обработчика. Если его не удалось сохранить,
+// пользователь узнаёт, что действие нужно повторить
+func withState(next HandlerFunc) HandlerFunc {
+	return func(r *Request) {
+		next(r)
+		if err := store.Set(r.ChatId, *r.User); err != nil {
+			log.ERROR(fmt.Sprintf("%v %s", r.ChatId, err))
+			r.Bot.SendMessage(r.ChatId, r.User.T("Не удалось сохранить изменения, повторите действие"))
+		}
+	}
+}
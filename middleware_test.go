@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+// TestHandleOrder extra из handle выполняются до загрузки пользователя: отклонённое обновление
+// не доходит до withUser и withState
+func TestHandleOrder(t *testing.T) {
+	defer func(outer, user []Middleware) {
+		middlewares, userMiddlewares = outer, user
+	}(middlewares, userMiddlewares)
+
+	calls := []string{}
+	record := func(name string, pass bool) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(r *Request) {
+				calls = append(calls, name)
+				if pass {
+					next(r)
+				}
+			}
+		}
+	}
+	middlewares = []Middleware{record("recover", true), record("logging", true)}
+	userMiddlewares = []Middleware{record("user", true), record("state", true)}
+	h := func(r *Request) { calls = append(calls, "handler") }
+
+	tests := []struct {
+		extra []Middleware
+		want  string
+	}{
+		{nil, "recover logging user state handler"},
+		{[]Middleware{record("verify", true)}, "recover logging verify user state handler"},
+		{[]Middleware{record("verify", false)}, "recover logging verify"},
+	}
+	for _, tt := range tests {
+		calls = calls[:0]
+		handle(h, tt.extra...)(tg.UpdateResult{}, nil)
+		if got := strings.Join(calls, " "); got != tt.want {
+			t.Errorf("chain = %q, want %q", got, tt.want)
+		}
+	}
+}
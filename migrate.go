@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/playmixer/bot-note/migrations"
+	"github.com/playmixer/bot-note/models"
+)
+
+// migrateUp применяет новые миграции схемы базы данных
+func migrateUp(ctx context.Context, dialect string) error {
+	migrator, err := migrations.New(models.DB, dialect)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	for _, m := range applied {
+		log.INFO(fmt.Sprintf("migration %04d_%s applied", m.Version, m.Name))
+	}
+	return err
+}
+
+// runMigrate подкоманда migrate:
+//
+//	app migrate [up]       применить новые миграции
+//	app migrate down [n]   откатить n последних миграций (по умолчанию одну)
+//	app migrate status     показать состояние миграций
+func runMigrate(dialect string, args []string) error {
+	if dialect == "" {
+		return errors.New("migrations are not used with memory storage")
+	}
+	ctx := context.Background()
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	migrator, err := migrations.New(models.DB, dialect)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		return migrateUp(ctx, dialect)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("bad number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.INFO(fmt.Sprintf("migration %04d_%s rolled back", m.Version, m.Name))
+		}
+		if errors.Is(err, migrations.ErrNoMigrations) {
+			log.INFO("nothing to roll back")
+			return nil
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt.Format(REMINDER_TIME_LAYOUT)
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown migrate command %q, use up, down [n] or status", command)
+}
@@ -0,0 +1,272 @@
+// Package migrations хранит схему базы данных в виде пронумерованных SQL файлов,
+// встроенных в бинарник, и применяет их по порядку.
+//
+// Файлы называются NNNN_name.up.sql и NNNN_name.down.sql и лежат в каталоге своей базы
+// (postgres, sqlite). Применённые версии записываются в таблицу schema_migrations.
+// В Postgres на время миграции берётся advisory lock, поэтому при запуске нескольких
+// реплик схему обновляет только одна из них.
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LOCK_ID ключ advisory lock, общий для всех реплик бота
+const LOCK_ID = 7_347_275_001
+
+const (
+	DIALECT_POSTGRES = "postgres"
+	DIALECT_SQLITE   = "sqlite"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+var ErrNoMigrations = errors.New("migrations: nothing to roll back")
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type Status struct {
+	Migration
+	AppliedAt time.Time
+	Applied   bool
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    string
+	migrations []Migration
+}
+
+// New мигратор для базы dialect: DIALECT_POSTGRES или DIALECT_SQLITE
+func New(db *sql.DB, dialect string) (*Migrator, error) {
+	if dialect != DIALECT_POSTGRES && dialect != DIALECT_SQLITE {
+		return nil, fmt.Errorf("migrations: unknown dialect %q", dialect)
+	}
+	migrations, err := Load(files, dialect)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+// Load читает миграции из каталога dir и сортирует их по версии
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		file := entry.Name()
+		var direction string
+		switch {
+		case strings.HasSuffix(file, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(file, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(file, "."+direction+".sql")
+		number, name, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("migrations: bad file name %q", file)
+		}
+		version, err := strconv.Atoi(number)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migrations: bad version in %q", file)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, file))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if m.Name != name {
+			return nil, fmt.Errorf("migrations: version %d has different names %q and %q", version, m.Name, name)
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migrations: version %d has no up file", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Up применяет все ещё не применённые миграции, возвращает применённые
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := []Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if _, ok := versions[migration.Version]; ok {
+				continue
+			}
+			err = m.apply(ctx, conn, migration, migration.Up, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "insert into schema_migrations (version, name, applied_at) values ($1, $2, $3)",
+					migration.Version, migration.Name, time.Now().UTC())
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down откатывает steps последних применённых миграций, возвращает откаченные
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	reverted := []Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := versions[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migrations: version %d can't be rolled back", migration.Version)
+			}
+			err = m.apply(ctx, conn, migration, migration.Down, func(tx *sql.Tx) error {
+				_, err := tx.ExecContext(ctx, "delete from schema_migrations where version = $1", migration.Version)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, migration)
+		}
+		if len(reverted) == 0 {
+			return ErrNoMigrations
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status состояние всех известных миграций
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	statuses := []Status{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		versions, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			appliedAt, ok := versions[migration.Version]
+			statuses = append(statuses, Status{Migration: migration, AppliedAt: appliedAt, Applied: ok})
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, query string, record func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("migrations: %04d_%s: %w", migration.Version, migration.Name, err)
+	}
+	if err = record(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// withLock выполняет f на одном соединении, в Postgres под advisory lock.
+// SQLite рассчитан на один процесс, блокировка ему не нужна.
+func (m *Migrator) withLock(ctx context.Context, f func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect == DIALECT_POSTGRES {
+		if _, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", LOCK_ID); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", LOCK_ID)
+	}
+
+	timestamp := "timestamptz"
+	if m.dialect == DIALECT_SQLITE {
+		timestamp = "timestamp"
+	}
+	_, err = conn.ExecContext(ctx, `create table if not exists schema_migrations (
+		version integer not null primary key,
+		name varchar not null,
+		applied_at `+timestamp+` not null
+	)`)
+	if err != nil {
+		return err
+	}
+	return f(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "select version, applied_at from schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		versions[version] = appliedAt
+	}
+	return versions, rows.Err()
+}
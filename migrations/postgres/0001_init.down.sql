@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS public.tags_to_note;
+DROP TABLE IF EXISTS public.notes;
+DROP TABLE IF EXISTS public.tags;
+DROP TABLE IF EXISTS public.users;
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS public.users (
+	id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+	tg_chat_id int4 NULL,
+	tg_username varchar NULL,
+	CONSTRAINT user_pk PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS user_tg_chat_id_idx ON public.users USING btree (tg_chat_id);
+
+CREATE TABLE IF NOT EXISTS public.tags (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	user_id int4 NOT NULL,
+	title varchar NOT NULL,
+	CONSTRAINT tag_pk PRIMARY KEY (id),
+	CONSTRAINT tag_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
+);
+
+CREATE TABLE IF NOT EXISTS public.notes (
+	id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
+	user_id int4 NOT NULL,
+	title varchar NOT NULL,
+	url varchar NULL,
+	description varchar NULL,
+	CONSTRAINT note_pk PRIMARY KEY (id),
+	CONSTRAINT note_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.tags_to_note (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	note_id int4 NOT NULL,
+	tag_id int4 NOT NULL,
+	CONSTRAINT tags_to_note_pk PRIMARY KEY (id),
+	CONSTRAINT tags_to_note_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE,
+	CONSTRAINT tags_to_note_tags_fk FOREIGN KEY (tag_id) REFERENCES public.tags(id) ON DELETE CASCADE
+);
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS public.reminders (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	user_id int4 NOT NULL,
+	note_id int4 NOT NULL,
+	fire_at timestamptz NOT NULL,
+	sent_at timestamptz NULL,
+	repeat varchar NULL,
+	paused bool DEFAULT false NOT NULL,
+	CONSTRAINT reminder_pk PRIMARY KEY (id),
+	CONSTRAINT reminder_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE,
+	CONSTRAINT reminder_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS reminders_fire_at_idx ON public.reminders USING btree (fire_at) WHERE sent_at IS NULL AND NOT paused;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS public.user_settings (
+	user_id int4 NOT NULL,
+	timezone varchar DEFAULT '' NOT NULL,
+	"language" varchar DEFAULT 'ru' NOT NULL,
+	page_size int4 DEFAULT 5 NOT NULL,
+	sort_order varchar DEFAULT 'new' NOT NULL,
+	CONSTRAINT user_settings_pk PRIMARY KEY (user_id),
+	CONSTRAINT user_settings_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
+);
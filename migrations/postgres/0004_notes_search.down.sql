@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS public.notes_search_vector_idx;
+ALTER TABLE public.notes DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,9 @@
+-- полнотекстовый поиск по заметкам
+ALTER TABLE public.notes ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('russian', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('russian', coalesce(description, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(description, '')), 'B') ||
+	setweight(to_tsvector('english', coalesce(url, '')), 'C')
+) STORED;
+CREATE INDEX IF NOT EXISTS notes_search_vector_idx ON public.notes USING gin (search_vector);
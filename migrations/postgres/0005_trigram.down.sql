@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS public.tags_title_trgm_idx;
+DROP INDEX IF EXISTS public.notes_title_trgm_idx;
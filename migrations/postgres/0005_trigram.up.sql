@@ -0,0 +1,4 @@
+-- поиск с опечатками по названиям заметок и тегам
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+CREATE INDEX IF NOT EXISTS notes_title_trgm_idx ON public.notes USING gin (title gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS tags_title_trgm_idx ON public.tags USING gin (title gin_trgm_ops);
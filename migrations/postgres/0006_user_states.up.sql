@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS public.user_states (
+	user_key int8 NOT NULL,
+	data jsonb NOT NULL,
+	version int8 NOT NULL,
+	expires_at timestamptz NOT NULL,
+	CONSTRAINT user_states_pk PRIMARY KEY (user_key)
+);
+CREATE INDEX IF NOT EXISTS user_states_expires_at_idx ON public.user_states USING btree (expires_at);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS public.note_attachments (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	note_id int4 NOT NULL,
+	kind varchar NOT NULL,
+	file_id varchar NOT NULL,
+	file_unique_id varchar NOT NULL,
+	file_name varchar NULL,
+	created_at timestamptz DEFAULT now() NOT NULL,
+	CONSTRAINT note_attachments_pk PRIMARY KEY (id),
+	CONSTRAINT note_attachments_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE,
+	CONSTRAINT note_attachments_unique UNIQUE (note_id, file_unique_id)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS public.checklist_items (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	note_id int4 NOT NULL,
+	"position" int4 NOT NULL,
+	title varchar NOT NULL,
+	done bool DEFAULT false NOT NULL,
+	CONSTRAINT checklist_items_pk PRIMARY KEY (id),
+	CONSTRAINT checklist_items_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS checklist_items_note_id_idx ON public.checklist_items USING btree (note_id, "position");
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS public.note_revisions;
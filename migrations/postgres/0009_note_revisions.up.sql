@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS public.note_revisions (
+	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
+	note_id int4 NOT NULL,
+	user_id int4 NOT NULL,
+	created_at timestamptz DEFAULT now() NOT NULL,
+	title varchar NOT NULL,
+	url varchar NOT NULL,
+	description varchar NOT NULL,
+	tags jsonb NOT NULL,
+	CONSTRAINT note_revisions_pk PRIMARY KEY (id),
+	CONSTRAINT note_revisions_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS note_revisions_note_id_idx ON public.note_revisions USING btree (note_id, id);
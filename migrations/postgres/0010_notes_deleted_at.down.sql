@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS public.notes_deleted_at_idx;
+ALTER TABLE public.notes DROP COLUMN IF EXISTS deleted_at;
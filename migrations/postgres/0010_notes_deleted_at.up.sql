@@ -0,0 +1,3 @@
+-- корзина: удалённые заметки хранятся до очистки
+ALTER TABLE public.notes ADD COLUMN IF NOT EXISTS deleted_at timestamptz NULL;
+CREATE INDEX IF NOT EXISTS notes_deleted_at_idx ON public.notes USING btree (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- не выполнится, если в базе уже есть id чатов больше 2^31
+ALTER TABLE public.users ALTER COLUMN tg_chat_id TYPE int4;
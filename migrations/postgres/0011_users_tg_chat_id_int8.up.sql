@@ -0,0 +1,2 @@
+-- id чатов Telegram не помещаются в int4
+ALTER TABLE public.users ALTER COLUMN tg_chat_id TYPE int8;
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS tags_to_note;
+DROP TABLE IF EXISTS notes;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS users;
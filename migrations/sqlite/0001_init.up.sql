@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS users (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	tg_chat_id integer NULL,
+	tg_username text NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS user_tg_chat_id_idx ON users (tg_chat_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL REFERENCES users(id),
+	title text NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS notes (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	title text NOT NULL,
+	url text NULL,
+	description text NULL
+);
+
+CREATE TABLE IF NOT EXISTS tags_to_note (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	note_id integer NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+	tag_id integer NOT NULL REFERENCES tags(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS reminders (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	user_id integer NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	note_id integer NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+	fire_at timestamp NOT NULL,
+	sent_at timestamp NULL,
+	repeat text NULL,
+	paused boolean DEFAULT false NOT NULL
+);
+CREATE INDEX IF NOT EXISTS reminders_fire_at_idx ON reminders (fire_at) WHERE sent_at IS NULL AND NOT paused;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_settings (
+	user_id integer NOT NULL PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	timezone text DEFAULT '' NOT NULL,
+	"language" text DEFAULT 'ru' NOT NULL,
+	page_size integer DEFAULT 5 NOT NULL,
+	sort_order text DEFAULT 'new' NOT NULL
+);
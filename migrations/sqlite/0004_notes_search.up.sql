@@ -0,0 +1,19 @@
+-- полнотекстовый поиск по заметкам, индекс FTS5 поддерживается триггерами
+CREATE VIRTUAL TABLE IF NOT EXISTS notes_fts USING fts5(
+	title, description, url,
+	content='notes', content_rowid='id',
+	tokenize='porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS notes_fts_insert AFTER INSERT ON notes BEGIN
+	INSERT INTO notes_fts (rowid, title, description, url) VALUES (new.id, new.title, new.description, new.url);
+END;
+CREATE TRIGGER IF NOT EXISTS notes_fts_delete AFTER DELETE ON notes BEGIN
+	INSERT INTO notes_fts (notes_fts, rowid, title, description, url) VALUES ('delete', old.id, old.title, old.description, old.url);
+END;
+CREATE TRIGGER IF NOT EXISTS notes_fts_update AFTER UPDATE ON notes BEGIN
+	INSERT INTO notes_fts (notes_fts, rowid, title, description, url) VALUES ('delete', old.id, old.title, old.description, old.url);
+	INSERT INTO notes_fts (rowid, title, description, url) VALUES (new.id, new.title, new.description, new.url);
+END;
+
+INSERT INTO notes_fts (notes_fts) VALUES ('rebuild');
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_states (
+	user_key integer NOT NULL PRIMARY KEY,
+	data text NOT NULL,
+	version integer NOT NULL,
+	expires_at timestamp NOT NULL
+);
+CREATE INDEX IF NOT EXISTS user_states_expires_at_idx ON user_states (expires_at);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS note_attachments (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	note_id integer NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+	kind text NOT NULL,
+	file_id text NOT NULL,
+	file_unique_id text NOT NULL,
+	file_name text NULL,
+	created_at timestamp DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	UNIQUE (note_id, file_unique_id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS checklist_items (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	note_id integer NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+	"position" integer NOT NULL,
+	title text NOT NULL,
+	done boolean DEFAULT false NOT NULL
+);
+CREATE INDEX IF NOT EXISTS checklist_items_note_id_idx ON checklist_items (note_id, "position");
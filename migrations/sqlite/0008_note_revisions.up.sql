@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS note_revisions (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	note_id integer NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+	user_id integer NOT NULL,
+	created_at timestamp NOT NULL,
+	title text NOT NULL,
+	url text NOT NULL,
+	description text NOT NULL,
+	tags text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS note_revisions_note_id_idx ON note_revisions (note_id, id);
@@ -0,0 +1,3 @@
+-- корзина: удалённые заметки хранятся до очистки
+ALTER TABLE notes ADD COLUMN deleted_at timestamp NULL;
+CREATE INDEX IF NOT EXISTS notes_deleted_at_idx ON notes (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"context"
+)
+
+type AttachmentKind string
+
+const (
+	ATTACHMENT_PHOTO    AttachmentKind = "photo"
+	ATTACHMENT_DOCUMENT AttachmentKind = "document"
+	ATTACHMENT_AUDIO    AttachmentKind = "audio"
+	ATTACHMENT_VOICE    AttachmentKind = "voice"
+)
+
+// Attachment файл Telegram, прикреплённый к заметке. Сам файл хранится в Telegram,
+// по FileId его можно отправить снова, FileUniqueId не меняется и отсекает повторы
+type Attachment struct {
+	Id           int64
+	NoteId       int64
+	Kind         AttachmentKind
+	FileId       string
+	FileUniqueId string
+	FileName     string
+}
+
+// AddAttachment прикрепляет файл к заметке пользователя, added - false, если этот файл уже прикреплён
+func (s *sqlStorage) AddAttachment(ctx context.Context, userId int64, attachment Attachment) (added bool, err error) {
+	if err = ownNote(ctx, s.db, userId, attachment.NoteId); err != nil {
+		return false, err
+	}
+	res, err := s.db.ExecContext(ctx, `insert into note_attachments (note_id, kind, file_id, file_unique_id, file_name)
+	values ($1, $2, $3, $4, $5)
+	on conflict (note_id, file_unique_id) do nothing`,
+		attachment.NoteId, attachment.Kind, attachment.FileId, attachment.FileUniqueId, attachment.FileName)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetAttachments вложения заметки в порядке добавления
+func (s *sqlStorage) GetAttachments(userId, noteId int64) ([]Attachment, error) {
+	attachments := []Attachment{}
+	rows, err := s.db.Query(`select a.id, a.note_id, a.kind, a.file_id, a.file_unique_id, coalesce(a.file_name, '')
+	from note_attachments a
+	join notes n on n.id = a.note_id
+	where a.note_id = $1 and n.user_id = $2
+	order by a.id`, noteId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		attachment := Attachment{}
+		err = rows.Scan(&attachment.Id, &attachment.NoteId, &attachment.Kind, &attachment.FileId, &attachment.FileUniqueId, &attachment.FileName)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (s *sqlStorage) CountAttachments(userId, noteId int64) (int, error) {
+	var count int
+	err := s.db.QueryRow(`select count(*) from note_attachments a
+	join notes n on n.id = a.note_id
+	where a.note_id = $1 and n.user_id = $2`, noteId, userId).Scan(&count)
+	return count, err
+}
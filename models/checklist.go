@@ -0,0 +1,126 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ChecklistItem пункт списка дел в заметке
+type ChecklistItem struct {
+	Id       int64
+	NoteId   int64
+	Position int
+	Title    string
+	Done     bool
+}
+
+// ChecklistProgress сколько пунктов списка отмечено
+type ChecklistProgress struct {
+	Done  int
+	Total int
+}
+
+func (p ChecklistProgress) String() string {
+	return fmt.Sprintf("%d/%d", p.Done, p.Total)
+}
+
+// AddChecklistItems добавляет пункты в конец списка заметки
+func (s *sqlStorage) AddChecklistItems(ctx context.Context, userId, noteId int64, titles []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err = ownNote(ctx, tx, userId, noteId); err != nil {
+		return err
+	}
+
+	for _, title := range titles {
+		_, err = tx.ExecContext(ctx, `insert into checklist_items (note_id, "position", title)
+		values ($1, coalesce((select max("position") from checklist_items where note_id = $1), 0) + 1, $2)`, noteId, title)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStorage) GetChecklist(userId, noteId int64) ([]ChecklistItem, error) {
+	items := []ChecklistItem{}
+	rows, err := s.db.Query(`select i.id, i.note_id, i."position", i.title, i.done from checklist_items i
+	join notes n on n.id = i.note_id
+	where i.note_id = $1 and n.user_id = $2
+	order by i."position"`, noteId, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := ChecklistItem{}
+		err = rows.Scan(&item.Id, &item.NoteId, &item.Position, &item.Title, &item.Done)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (s *sqlStorage) ToggleChecklistItem(ctx context.Context, userId, noteId, itemId int64) error {
+	if err := ownNote(ctx, s.db, userId, noteId); err != nil {
+		return err
+	}
+	return affected(s.db.ExecContext(ctx, "update checklist_items set done = not done where id = $1 and note_id = $2", itemId, noteId))
+}
+
+func (s *sqlStorage) ClearDoneChecklistItems(ctx context.Context, userId, noteId int64) error {
+	if err := ownNote(ctx, s.db, userId, noteId); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, "delete from checklist_items where note_id = $1 and done", noteId)
+	return err
+}
+
+// GetChecklistProgress прогресс списков заметок пользователя, заметок без списка в ответе нет
+func (s *sqlStorage) GetChecklistProgress(userId int64, noteIds []int64) (map[int64]ChecklistProgress, error) {
+	progress := map[int64]ChecklistProgress{}
+	if len(noteIds) == 0 {
+		return progress, nil
+	}
+
+	args := []any{userId}
+	placeholders := make([]string, len(noteIds))
+	for i, id := range noteIds {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	rows, err := s.db.Query(`select i.note_id, count(*) filter (where i.done), count(*) from checklist_items i
+	join notes n on n.id = i.note_id
+	where n.user_id = $1 and i.note_id in (`+strings.Join(placeholders, ", ")+`)
+	group by i.note_id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var noteId int64
+		p := ChecklistProgress{}
+		if err = rows.Scan(&noteId, &p.Done, &p.Total); err != nil {
+			return nil, err
+		}
+		progress[noteId] = p
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return progress, nil
+}
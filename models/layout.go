@@ -0,0 +1,65 @@
+package models
+
+import "unicode"
+
+// Раскладки клавиатуры QWERTY и ЙЦУКЕН: символы на одинаковых позициях соответствуют одной клавише
+const (
+	layoutEnglish = "`qwertyuiop[]asdfghjkl;'zxcvbnm,./" + "~QWERTYUIOP{}ASDFGHJKL:\"ZXCVBNM<>?"
+	layoutRussian = "ёйцукенгшщзхъфывапролджэячсмитьбю." + "ЁЙЦУКЕНГШЩЗХЪФЫВАПРОЛДЖЭЯЧСМИТЬБЮ,"
+)
+
+var (
+	layoutEnRu = map[rune]rune{}
+	layoutRuEn = map[rune]rune{}
+)
+
+func init() {
+	en := []rune(layoutEnglish)
+	ru := []rune(layoutRussian)
+	for i := range en {
+		layoutEnRu[en[i]] = ru[i]
+		if _, ok := layoutRuEn[ru[i]]; !ok {
+			layoutRuEn[ru[i]] = en[i]
+		}
+	}
+}
+
+// LayoutToRussian текст, набранный в английской раскладке вместо русской: ghbdtn -> привет
+func LayoutToRussian(text string) string {
+	return convertLayout(text, layoutEnRu)
+}
+
+// LayoutToEnglish текст, набранный в русской раскладке вместо английской: вщслук -> docker
+func LayoutToEnglish(text string) string {
+	return convertLayout(text, layoutRuEn)
+}
+
+// SwitchLayout переводит текст в другую раскладку в зависимости от того, каких букв в нём больше
+func SwitchLayout(text string) string {
+	latin, cyrillic := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		}
+	}
+	switch {
+	case latin > cyrillic:
+		return LayoutToRussian(text)
+	case cyrillic > latin:
+		return LayoutToEnglish(text)
+	}
+	return text
+}
+
+func convertLayout(text string, table map[rune]rune) string {
+	result := []rune(text)
+	for i, r := range result {
+		if c, ok := table[r]; ok {
+			result[i] = c
+		}
+	}
+	return string(result)
+}
@@ -0,0 +1,85 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/playmixer/bot-note/models"
+)
+
+func TestLayoutConversion(t *testing.T) {
+	tests := []struct {
+		en, ru string
+	}{
+		{"ghbdtn", "привет"},
+		{"Ghbdtn", "Привет"},
+		{"GHBDTN", "ПРИВЕТ"},
+		{"`", "ё"},
+		{"~", "Ё"},
+		{"[]", "хъ"},
+		{"{}", "ХЪ"},
+		{"/", "."},
+		{"?", ","},
+		{"<>", "БЮ"},
+	}
+	for _, tt := range tests {
+		if got := models.LayoutToRussian(tt.en); got != tt.ru {
+			t.Errorf("LayoutToRussian(%q) = %q, want %q", tt.en, got, tt.ru)
+		}
+		if got := models.LayoutToEnglish(tt.ru); got != tt.en {
+			t.Errorf("LayoutToEnglish(%q) = %q, want %q", tt.ru, got, tt.en)
+		}
+	}
+}
+
+func TestLayoutRoundTrip(t *testing.T) {
+	for _, text := range []string{
+		"docker compose",
+		"Go Memory Model",
+		"qwertyuiop[]asdfghjkl;'zxcvbnm,./",
+		"~QWERTYUIOP{}ASDFGHJKL:\"ZXCVBNM<>?",
+	} {
+		if got := models.LayoutToEnglish(models.LayoutToRussian(text)); got != text {
+			t.Errorf("en -> ru -> en %q = %q", text, got)
+		}
+	}
+	for _, text := range []string{
+		"заметки по работе",
+		"Съешь же ещё этих мягких французских булок.",
+		"ЙЦУКЕН,",
+	} {
+		if got := models.LayoutToRussian(models.LayoutToEnglish(text)); got != text {
+			t.Errorf("ru -> en -> ru %q = %q", text, got)
+		}
+	}
+}
+
+func TestLayoutPassThrough(t *testing.T) {
+	// цифры, пробелы и символы вне обеих раскладок не меняются
+	for _, text := range []string{"2026 - 10", "#+=!", "日本語", "é ß ñ", "🙂", "\t\n"} {
+		if got := models.LayoutToRussian(text); got != text {
+			t.Errorf("LayoutToRussian(%q) = %q", text, got)
+		}
+		if got := models.LayoutToEnglish(text); got != text {
+			t.Errorf("LayoutToEnglish(%q) = %q", text, got)
+		}
+	}
+	if got := models.LayoutToRussian("ghbdtn 2026 🙂"); got != "привет 2026 🙂" {
+		t.Errorf("LayoutToRussian mixed = %q", got)
+	}
+}
+
+func TestSwitchLayout(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"ghbdtn", "привет"},
+		{"вщслук", "docker"},
+		{"Вщслук", "Docker"},
+		{"2026", "2026"},
+	}
+	for _, tt := range tests {
+		if got := models.SwitchLayout(tt.text); got != tt.want {
+			t.Errorf("SwitchLayout(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
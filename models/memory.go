@@ -0,0 +1,817 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/playmixer/bot-note/tagquery"
+)
+
+// Memory хранилище в памяти процесса с той же семантикой, что и Postgres.
+// Данные теряются при перезапуске, подходит для тестов и запуска без базы.
+type Memory struct {
+	mu sync.Mutex
+
+	users       map[int64]User
+	tags        map[int64]Tag
+	notes       map[int64]Note
+	tagsToNote  map[int64][]int64 // id заметки -> id тегов
+	reminders   map[int64]memoryReminder
+	attachments map[int64][]Attachment    // id заметки -> вложения
+	checklists  map[int64][]ChecklistItem // id заметки -> пункты по порядку
+	revisions   map[int64][]NoteRevision  // id заметки -> ревизии, старые первыми
+	settings    map[int64]UserSettings
+
+	userSeq       int64
+	tagSeq        int64
+	noteSeq       int64
+	reminderSeq   int64
+	attachmentSeq int64
+	itemSeq       int64
+	revisionSeq   int64
+}
+
+type memoryReminder struct {
+	Reminder
+	sentAt time.Time
+}
+
+func (r memoryReminder) sent() bool {
+	return !r.sentAt.IsZero()
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:       map[int64]User{},
+		tags:        map[int64]Tag{},
+		notes:       map[int64]Note{},
+		tagsToNote:  map[int64][]int64{},
+		reminders:   map[int64]memoryReminder{},
+		attachments: map[int64][]Attachment{},
+		checklists:  map[int64][]ChecklistItem{},
+		revisions:   map[int64][]NoteRevision{},
+		settings:    map[int64]UserSettings{},
+	}
+}
+
+func (m *Memory) GetUserByTelegramId(id int64) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.TgChatId == id {
+			return user, nil
+		}
+	}
+	return User{}, nil
+}
+
+func (m *Memory) GetUserByUserId(id int64) (User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.users[id], nil
+}
+
+func (m *Memory) NewUser(tgChatId int64, tgUsername string) (id int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.users {
+		if user.TgChatId == tgChatId {
+			return 0, fmt.Errorf("user with tg_chat_id %v already exists", tgChatId)
+		}
+	}
+	m.userSeq++
+	m.users[m.userSeq] = User{Id: m.userSeq, TgChatId: tgChatId, TgUsername: tgUsername}
+	return m.userSeq, nil
+}
+
+func (m *Memory) GetTagsByNoteId(userId, noteId int64) ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.owns(userId, noteId) {
+		return nil, nil
+	}
+	return m.noteTags(noteId), nil
+}
+
+func (m *Memory) GetTagsByUserId(userId int64) ([]Tag, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var tags []Tag
+	for _, tag := range m.tags {
+		if tag.UserId == userId {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Id < tags[j].Id })
+	return tags, nil
+}
+
+func (m *Memory) RemoveNoteTag(ctx context.Context, userId, tagId, noteId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, noteId); !ok {
+		return ErrNotFound
+	}
+	m.unlinkTag(noteId, tagId)
+	return nil
+}
+
+func (m *Memory) NewNote(ctx context.Context, userId int64, title, url, description string, _tags []string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userId]; !ok {
+		return 0, fmt.Errorf("user %v not found", userId)
+	}
+
+	m.noteSeq++
+	m.notes[m.noteSeq] = Note{Id: m.noteSeq, UserId: userId, Title: title, Url: url, Description: description}
+	for _, _tag := range _tags {
+		if strings.Trim(_tag, " ") == "" {
+			continue
+		}
+		m.tagsToNote[m.noteSeq] = append(m.tagsToNote[m.noteSeq], m.userTag(userId, _tag))
+	}
+	return m.noteSeq, nil
+}
+
+func (m *Memory) UpdNote(ctx context.Context, note Note, newTags []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.ownNote(note.UserId, note.Id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	revision := NoteRevision{
+		NoteId:      note.Id,
+		UserId:      note.UserId,
+		CreatedAt:   time.Now().UTC(),
+		Title:       old.Title,
+		Url:         old.Url,
+		Description: old.Description,
+	}
+	for _, tag := range m.noteTags(note.Id) {
+		revision.Tags = append(revision.Tags, tag.Title)
+	}
+	if revision.Changed(note, newTags) {
+		m.revisionSeq++
+		revision.Id = m.revisionSeq
+		revision.Tags = sortedTags(revision.Tags)
+		m.revisions[note.Id] = append(m.revisions[note.Id], revision)
+	}
+
+	diffTags := map[string]bool{}
+	for _, _tag := range newTags {
+		diffTags[_tag] = true
+	}
+	for _, tag := range m.noteTags(note.Id) {
+		if _, ok := diffTags[tag.Title]; ok {
+			delete(diffTags, tag.Title)
+		} else {
+			m.unlinkTag(note.Id, tag.Id)
+		}
+	}
+
+	old.Title, old.Url, old.Description = note.Title, note.Url, note.Description
+	m.notes[note.Id] = old
+
+	for _tag := range diffTags {
+		if strings.Trim(_tag, " ") == "" {
+			continue
+		}
+		m.tagsToNote[note.Id] = append(m.tagsToNote[note.Id], m.userTag(note.UserId, _tag))
+	}
+	return nil
+}
+
+func (m *Memory) GetNotes(userId int64, order SortOrder) ([]Note, error) {
+	return m.filterNotes(userId, order, func(Note) bool { return true }), nil
+}
+
+func (m *Memory) GetNotesByTag(userId int64, tag string, order SortOrder) ([]Note, error) {
+	return m.filterNotes(userId, order, func(note Note) bool {
+		for _, t := range m.noteTags(note.Id) {
+			if t.Title == tag {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
+
+func (m *Memory) GetNotesByTagQuery(userId int64, query tagquery.Node, order SortOrder) ([]Note, error) {
+	return m.filterNotes(userId, order, func(note Note) bool {
+		tags := m.noteTags(note.Id)
+		return tagquery.Eval(query, func(tag string) bool {
+			for _, t := range tags {
+				if t.Title == tag {
+					return true
+				}
+			}
+			return false
+		})
+	}), nil
+}
+
+func (m *Memory) GetNote(userId, noteId int64) (Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	note, ok := m.ownNote(userId, noteId)
+	if !ok {
+		return Note{}, ErrNotFound
+	}
+	return note, nil
+}
+
+func (m *Memory) DeleteNote(userId, noteId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	note, ok := m.ownNote(userId, noteId)
+	if !ok {
+		return ErrNotFound
+	}
+	note.DeletedAt = time.Now().UTC()
+	m.notes[noteId] = note
+	return nil
+}
+
+func (m *Memory) GetTrash(userId int64) ([]Note, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notes := []Note{}
+	for _, note := range m.notes {
+		if note.UserId == userId && !note.DeletedAt.IsZero() {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		if !notes[i].DeletedAt.Equal(notes[j].DeletedAt) {
+			return notes[i].DeletedAt.After(notes[j].DeletedAt)
+		}
+		return notes[i].Id > notes[j].Id
+	})
+	return notes, nil
+}
+
+func (m *Memory) RestoreNote(ctx context.Context, userId, noteId int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	note, ok := m.notes[noteId]
+	if !ok || note.UserId != userId {
+		return false, ErrNotFound
+	}
+	if note.DeletedAt.IsZero() {
+		return false, nil
+	}
+	note.DeletedAt = time.Time{}
+	m.notes[noteId] = note
+	return true, nil
+}
+
+func (m *Memory) PurgeNote(ctx context.Context, userId, noteId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	note, ok := m.notes[noteId]
+	if ok && note.UserId == userId && !note.DeletedAt.IsZero() {
+		m.purge(noteId)
+	}
+	return nil
+}
+
+func (m *Memory) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var n int64
+	for id, note := range m.notes {
+		if !note.DeletedAt.IsZero() && !note.DeletedAt.After(before) {
+			m.purge(id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// purge удаляет заметку со всем, что к ней относится, вызывается под m.mu
+func (m *Memory) purge(noteId int64) {
+	delete(m.notes, noteId)
+	delete(m.tagsToNote, noteId)
+	delete(m.attachments, noteId)
+	delete(m.checklists, noteId)
+	delete(m.revisions, noteId)
+	for id, r := range m.reminders {
+		if r.NoteId == noteId {
+			delete(m.reminders, id)
+		}
+	}
+}
+
+func (m *Memory) AddAttachment(ctx context.Context, userId int64, attachment Attachment) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, attachment.NoteId); !ok {
+		return false, ErrNotFound
+	}
+	for _, a := range m.attachments[attachment.NoteId] {
+		if a.FileUniqueId == attachment.FileUniqueId {
+			return false, nil
+		}
+	}
+	m.attachmentSeq++
+	attachment.Id = m.attachmentSeq
+	m.attachments[attachment.NoteId] = append(m.attachments[attachment.NoteId], attachment)
+	return true, nil
+}
+
+func (m *Memory) GetAttachments(userId, noteId int64) ([]Attachment, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.owns(userId, noteId) {
+		return []Attachment{}, nil
+	}
+	return append([]Attachment{}, m.attachments[noteId]...), nil
+}
+
+func (m *Memory) CountAttachments(userId, noteId int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.owns(userId, noteId) {
+		return 0, nil
+	}
+	return len(m.attachments[noteId]), nil
+}
+
+func (m *Memory) AddChecklistItems(ctx context.Context, userId, noteId int64, titles []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, noteId); !ok {
+		return ErrNotFound
+	}
+	items := m.checklists[noteId]
+	for _, title := range titles {
+		position := 1
+		if len(items) > 0 {
+			position = items[len(items)-1].Position + 1
+		}
+		m.itemSeq++
+		items = append(items, ChecklistItem{Id: m.itemSeq, NoteId: noteId, Position: position, Title: title})
+	}
+	m.checklists[noteId] = items
+	return nil
+}
+
+func (m *Memory) GetChecklist(userId, noteId int64) ([]ChecklistItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.owns(userId, noteId) {
+		return []ChecklistItem{}, nil
+	}
+	return append([]ChecklistItem{}, m.checklists[noteId]...), nil
+}
+
+func (m *Memory) ToggleChecklistItem(ctx context.Context, userId, noteId, itemId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, noteId); !ok {
+		return ErrNotFound
+	}
+	for i, item := range m.checklists[noteId] {
+		if item.Id == itemId {
+			m.checklists[noteId][i].Done = !item.Done
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *Memory) ClearDoneChecklistItems(ctx context.Context, userId, noteId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, noteId); !ok {
+		return ErrNotFound
+	}
+	items := []ChecklistItem{}
+	for _, item := range m.checklists[noteId] {
+		if !item.Done {
+			items = append(items, item)
+		}
+	}
+	m.checklists[noteId] = items
+	return nil
+}
+
+func (m *Memory) GetChecklistProgress(userId int64, noteIds []int64) (map[int64]ChecklistProgress, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	progress := map[int64]ChecklistProgress{}
+	for _, noteId := range noteIds {
+		items := m.checklists[noteId]
+		if len(items) == 0 || !m.owns(userId, noteId) {
+			continue
+		}
+		p := ChecklistProgress{Total: len(items)}
+		for _, item := range items {
+			if item.Done {
+				p.Done++
+			}
+		}
+		progress[noteId] = p
+	}
+	return progress, nil
+}
+
+func (m *Memory) GetNoteRevisions(userId, noteId int64, limit int) ([]NoteRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revisions := []NoteRevision{}
+	if !m.owns(userId, noteId) {
+		return revisions, nil
+	}
+	all := m.revisions[noteId]
+	for i := len(all) - 1; i >= 0 && len(revisions) < limit; i-- {
+		revisions = append(revisions, all[i])
+	}
+	return revisions, nil
+}
+
+func (m *Memory) GetNoteRevision(userId, noteId, id int64) (NoteRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.owns(userId, noteId) {
+		return NoteRevision{}, ErrNotFound
+	}
+	for _, revision := range m.revisions[noteId] {
+		if revision.Id == id {
+			return revision, nil
+		}
+	}
+	return NoteRevision{}, ErrNotFound
+}
+
+// SearchNotes приближение полнотекстового поиска Postgres: каждое слово запроса
+// должно быть началом слова в названии, описании или ссылке, совпадения в названии весят больше.
+func (m *Memory) SearchNotes(userId int64, query string) ([]Note, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return []Note{}, nil
+	}
+
+	ranked := rankedNotes{}
+	for _, note := range m.filterNotes(userId, SORT_ORDER_NEW, func(Note) bool { return true }) {
+		fields := []struct {
+			words  []string
+			weight float64
+		}{
+			{searchWords(note.Title), 1},
+			{searchWords(note.Description), 0.4},
+			{searchWords(note.Url), 0.2},
+		}
+		rank := 0.0
+		for _, w := range words {
+			best := 0.0
+			for _, f := range fields {
+				if f.weight > best && hasWordPrefix(f.words, stem(w)) {
+					best = f.weight
+				}
+			}
+			if best == 0 {
+				rank = 0
+				break
+			}
+			rank += best
+		}
+		if rank > 0 {
+			ranked.add(note, rank)
+		}
+	}
+	return ranked.sorted(), nil
+}
+
+func (m *Memory) SearchNotesFuzzy(userId int64, query string) ([]Note, error) {
+	return searchFuzzy(userId, query, m.SearchNotes, m.addSimilar)
+}
+
+// addSimilar приближение pg_trgm: word_similarity по названиям и similarity по тегам
+func (m *Memory) addSimilar(ranked rankedNotes, userId int64, query string) error {
+	for _, note := range m.filterNotes(userId, SORT_ORDER_NEW, func(Note) bool { return true }) {
+		m.mu.Lock()
+		tags := m.noteTags(note.Id)
+		m.mu.Unlock()
+		titles := make([]string, len(tags))
+		for i, tag := range tags {
+			titles[i] = tag.Title
+		}
+		if rank := similarRank(query, note.Title, titles); rank > 0 {
+			ranked.add(note, rank)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) NewReminder(ctx context.Context, userId, noteId int64, fireAt time.Time, repeat string) (id int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.ownNote(userId, noteId); !ok {
+		return 0, ErrNotFound
+	}
+	m.reminderSeq++
+	m.reminders[m.reminderSeq] = memoryReminder{Reminder: Reminder{
+		Id:     m.reminderSeq,
+		UserId: userId,
+		NoteId: noteId,
+		FireAt: fireAt,
+		Repeat: repeat,
+	}}
+	return m.reminderSeq, nil
+}
+
+func (m *Memory) GetReminder(userId, id int64) (Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.reminders[id]
+	note, noteOk := m.notes[r.NoteId]
+	if !ok || !noteOk || r.UserId != userId {
+		return Reminder{}, ErrNotFound
+	}
+	reminder := r.Reminder
+	reminder.NoteTitle = note.Title
+	return reminder, nil
+}
+
+func (m *Memory) GetActiveReminders(userId int64) ([]Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reminders := []Reminder{}
+	for _, r := range m.reminders {
+		note, ok := m.activeNote(r.NoteId)
+		if !ok || r.UserId != userId || r.sent() {
+			continue
+		}
+		reminder := r.Reminder
+		reminder.NoteTitle = note.Title
+		reminders = append(reminders, reminder)
+	}
+	sortReminders(reminders)
+	return reminders, nil
+}
+
+func (m *Memory) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := []Reminder{}
+	for _, r := range m.reminders {
+		if _, ok := m.activeNote(r.NoteId); ok && !r.sent() && !r.Paused && !r.FireAt.After(now) {
+			due = append(due, r.Reminder)
+		}
+	}
+	sortReminders(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	reminders := []Reminder{}
+	for _, reminder := range due {
+		r := m.reminders[reminder.Id]
+		r.sentAt = now
+		m.reminders[reminder.Id] = r
+
+		user, ok := m.users[reminder.UserId]
+		if !ok {
+			continue
+		}
+		reminders = append(reminders, Reminder{
+			Id:       reminder.Id,
+			UserId:   reminder.UserId,
+			NoteId:   reminder.NoteId,
+			FireAt:   reminder.FireAt,
+			Repeat:   reminder.Repeat,
+			TgChatId: user.TgChatId,
+		})
+	}
+	return reminders, nil
+}
+
+func (m *Memory) ReleaseReminder(ctx context.Context, id int64) error {
+	return m.updateReminder(id, 0, func(r *memoryReminder) {
+		r.sentAt = time.Time{}
+	})
+}
+
+func (m *Memory) RescheduleReminder(ctx context.Context, id int64, fireAt time.Time) error {
+	return m.updateReminder(id, 0, func(r *memoryReminder) {
+		r.FireAt = fireAt
+		r.sentAt = time.Time{}
+	})
+}
+
+func (m *Memory) PauseReminder(ctx context.Context, userId, id int64) error {
+	return m.updateReminder(id, userId, func(r *memoryReminder) {
+		r.Paused = true
+	})
+}
+
+func (m *Memory) ResumeReminder(ctx context.Context, userId, id int64, fireAt time.Time) error {
+	return m.updateReminder(id, userId, func(r *memoryReminder) {
+		r.Paused = false
+		r.FireAt = fireAt
+	})
+}
+
+func (m *Memory) DeleteReminder(ctx context.Context, userId, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.reminders[id]; !ok || r.UserId != userId {
+		return ErrNotFound
+	}
+	delete(m.reminders, id)
+	return nil
+}
+
+func (m *Memory) GetUserSettings(userId int64) (UserSettings, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if settings, ok := m.settings[userId]; ok {
+		return settings, nil
+	}
+	return DefaultUserSettings(userId), nil
+}
+
+func (m *Memory) SetUserSettings(ctx context.Context, settings UserSettings) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[settings.UserId]; !ok {
+		return errors.New("user not found")
+	}
+	m.settings[settings.UserId] = settings
+	return nil
+}
+
+// updateReminder изменяет напоминание id, userId = 0 - без проверки владельца
+func (m *Memory) updateReminder(id, userId int64, update func(r *memoryReminder)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r, ok := m.reminders[id]
+	if !ok || (userId != 0 && r.UserId != userId) {
+		// без пользователя напоминание меняет планировщик, пропавшее напоминание для него не ошибка
+		if userId == 0 {
+			return nil
+		}
+		return ErrNotFound
+	}
+	update(&r)
+	m.reminders[id] = r
+	return nil
+}
+
+// filterNotes заметки пользователя, для которых match вернул true, в порядке order
+func (m *Memory) filterNotes(userId int64, order SortOrder, match func(note Note) bool) []Note {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	notes := []Note{}
+	for _, note := range m.notes {
+		if note.UserId == userId && note.DeletedAt.IsZero() && match(note) {
+			notes = append(notes, note)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		switch order {
+		case SORT_ORDER_OLD:
+			return notes[i].Id < notes[j].Id
+		case SORT_ORDER_TITLE:
+			a, b := strings.ToLower(notes[i].Title), strings.ToLower(notes[j].Title)
+			if a != b {
+				return a < b
+			}
+			return notes[i].Id < notes[j].Id
+		}
+		return notes[i].Id > notes[j].Id
+	})
+	return notes
+}
+
+// ownNote заметка пользователя не из корзины, как ownNote для SQL, вызывается под m.mu
+func (m *Memory) ownNote(userId, noteId int64) (Note, bool) {
+	note, ok := m.activeNote(noteId)
+	if !ok || note.UserId != userId {
+		return Note{}, false
+	}
+	return note, true
+}
+
+// owns принадлежит ли заметка, в том числе из корзины, пользователю, вызывается под m.mu
+func (m *Memory) owns(userId, noteId int64) bool {
+	note, ok := m.notes[noteId]
+	return ok && note.UserId == userId
+}
+
+// activeNote заметка не из корзины, вызывается под m.mu
+func (m *Memory) activeNote(noteId int64) (Note, bool) {
+	note, ok := m.notes[noteId]
+	if !ok || !note.DeletedAt.IsZero() {
+		return Note{}, false
+	}
+	return note, true
+}
+
+// noteTags теги заметки, вызывается под m.mu
+func (m *Memory) noteTags(noteId int64) []Tag {
+	var tags []Tag
+	for _, tagId := range m.tagsToNote[noteId] {
+		tags = append(tags, m.tags[tagId])
+	}
+	return tags
+}
+
+// userTag id тега пользователя по названию, тег создаётся если его нет, вызывается под m.mu
+func (m *Memory) userTag(userId int64, title string) int64 {
+	for _, tag := range m.tags {
+		if tag.UserId == userId && tag.Title == title {
+			return tag.Id
+		}
+	}
+	m.tagSeq++
+	m.tags[m.tagSeq] = Tag{Id: m.tagSeq, UserId: userId, Title: title}
+	return m.tagSeq
+}
+
+// unlinkTag убирает тег у заметки, вызывается под m.mu
+func (m *Memory) unlinkTag(noteId, tagId int64) {
+	ids := []int64{}
+	for _, id := range m.tagsToNote[noteId] {
+		if id != tagId {
+			ids = append(ids, id)
+		}
+	}
+	m.tagsToNote[noteId] = ids
+}
+
+func sortReminders(reminders []Reminder) {
+	sort.Slice(reminders, func(i, j int) bool {
+		if !reminders[i].FireAt.Equal(reminders[j].FireAt) {
+			return reminders[i].FireAt.Before(reminders[j].FireAt)
+		}
+		return reminders[i].Id < reminders[j].Id
+	})
+}
+
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// stem грубо отрезает окончание длинных слов, вместо словарей Postgres
+func stem(word string) string {
+	runes := []rune(word)
+	if len(runes) > 5 {
+		return string(runes[:len(runes)-2])
+	}
+	return word
+}
+
+func hasWordPrefix(words []string, prefix string) bool {
+	for _, w := range words {
+		if strings.HasPrefix(w, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
+	"github.com/playmixer/bot-note/tagquery"
 	"github.com/playmixer/corvid/logger"
 )
 
@@ -16,76 +18,36 @@ var (
 	log *logger.Logger
 )
 
+// ErrNotFound заметки, ревизии или напоминания нет или они принадлежат другому пользователю
+var ErrNotFound = errors.New("not found")
+
 func init() {
 	log = logger.New("database")
 }
 
-/*
-CREATE TABLE public.users (
-
-	id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
-	tg_chat_id int4 NULL,
-	tg_username varchar NULL,
-	CONSTRAINT user_pk PRIMARY KEY (id)
+// Таблицы создаются миграциями из каталога migrations (postgres, sqlite)
 
-);
-CREATE UNIQUE INDEX user_tg_chat_id_idx ON public.users USING btree (tg_chat_id);
-*/
 type User struct {
 	Id         int64  `json:"id"`
 	TgChatId   int64  `json:"tg_chat_id"`
 	TgUsername string `json:"tg_username"`
 }
 
-/*
-CREATE TABLE public.tags (
-
-	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
-	user_id int4 NOT NULL,
-	title varchar NOT NULL,
-	CONSTRAINT tag_pk PRIMARY KEY (id),
-	CONSTRAINT tag_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id)
-
-);
-*/
 type Tag struct {
 	Id     int64  `json:"id"`
 	UserId int64  `json:"user_id"`
 	Title  string `json:"title"`
 }
 
-/*
-CREATE TABLE public.notes (
-
-	id int4 GENERATED ALWAYS AS IDENTITY( INCREMENT BY 1 MINVALUE 1 MAXVALUE 2147483647 START 1 CACHE 1 NO CYCLE) NOT NULL,
-	user_id int4 NOT NULL,
-	title varchar NOT NULL,
-	url varchar NULL,
-	description varchar NULL,
-	CONSTRAINT note_pk PRIMARY KEY (id),
-	CONSTRAINT note_user_fk FOREIGN KEY (user_id) REFERENCES public.users(id) ON DELETE CASCADE
-
-);
-*/
 type Note struct {
-	Id          int64  `json:"id"`
-	UserId      int64  `json:"user_id"`
-	Title       string `json:"title"`
-	Url         string `json:"url"`
-	Description string `json:"description"`
+	Id          int64     `json:"id"`
+	UserId      int64     `json:"user_id"`
+	Title       string    `json:"title"`
+	Url         string    `json:"url"`
+	Description string    `json:"description"`
+	DeletedAt   time.Time `json:"deleted_at"` // когда заметка перенесена в корзину, нулевое для обычных заметок
 }
 
-/*
-CREATE TABLE public.tags_to_note (
-	id int4 GENERATED ALWAYS AS IDENTITY NOT NULL,
-	note_id int4 NOT NULL,
-	tag_id int4 NOT NULL,
-	CONSTRAINT tags_to_note_pk PRIMARY KEY (id),
-	CONSTRAINT tags_to_note_notes_fk FOREIGN KEY (note_id) REFERENCES public.notes(id) ON DELETE CASCADE,
-	CONSTRAINT tags_to_note_tags_fk FOREIGN KEY (tag_id) REFERENCES public.tags(id) ON DELETE CASCADE
-);
-*/
-
 func Connect(host, port, user, password, dbname string) (*sql.DB, error) {
 	psqlconn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable", host, port, user, password, dbname)
 
@@ -96,20 +58,55 @@ func Connect(host, port, user, password, dbname string) (*sql.DB, error) {
 	return db, nil
 }
 
-func GetUser(id int64) (User, error) {
-	row := DB.QueryRow("select * from \"users\" where id = $1 limit 1", id)
-	var user = User{}
-	err := row.Scan(&user.Id, &user.TgChatId, &user.TgUsername)
+// sqlStorage запросы, одинаковые для Postgres и SQLite
+type sqlStorage struct {
+	db *sql.DB
+}
+
+// queryer запросы, которые одинаково выполняются на *sql.DB и внутри *sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ownNote проверяет, что заметка есть, не в корзине и принадлежит пользователю,
+// иначе ErrNotFound. Вызывается перед изменением заметки и всего, что к ней относится
+func ownNote(ctx context.Context, q queryer, userId, noteId int64) error {
+	var id int64
+	err := q.QueryRowContext(ctx, "select id from notes where id = $1 and user_id = $2 and deleted_at is null", noteId, userId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// affected ErrNotFound, если запрос ничего не изменил
+func affected(res sql.Result, err error) error {
 	if err != nil {
-		return user, err
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
 	}
+	return nil
+}
 
-	return user, nil
+// Postgres хранилище в базе Postgres
+type Postgres struct {
+	sqlStorage
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{sqlStorage{db: db}}
 }
 
-func GetUserByTelegramId(id int64) (User, error) {
+func (s *sqlStorage) GetUserByTelegramId(id int64) (User, error) {
 	var user = User{}
-	row := DB.QueryRow("select id, tg_chat_id, tg_username from \"users\" where tg_chat_id = $1 limit 1", id)
+	row := s.db.QueryRow("select id, tg_chat_id, tg_username from \"users\" where tg_chat_id = $1 limit 1", id)
 
 	err := row.Scan(&user.Id, &user.TgChatId, &user.TgUsername)
 	if err != nil && errors.Is(sql.ErrNoRows, err) {
@@ -122,9 +119,9 @@ func GetUserByTelegramId(id int64) (User, error) {
 	return user, nil
 }
 
-func GetUserByUserId(id int64) (User, error) {
+func (s *sqlStorage) GetUserByUserId(id int64) (User, error) {
 	var user = User{}
-	row := DB.QueryRow("select id, tg_chat_id, tg_username from \"users\" where id = $1 limit 1", id)
+	row := s.db.QueryRow("select id, tg_chat_id, tg_username from \"users\" where id = $1 limit 1", id)
 
 	err := row.Scan(&user.Id, &user.TgChatId, &user.TgUsername)
 	if err != nil && errors.Is(sql.ErrNoRows, err) {
@@ -138,60 +135,57 @@ func GetUserByUserId(id int64) (User, error) {
 	return user, nil
 }
 
-func NewUser(tgChatId int64, tgUsername string) (id int64, err error) {
-	err = DB.QueryRow("insert into \"users\" (tg_chat_id, tg_username) values ($1, $2) returning id", tgChatId, tgUsername).Scan(&id)
+func (s *sqlStorage) NewUser(tgChatId int64, tgUsername string) (id int64, err error) {
+	err = s.db.QueryRow("insert into \"users\" (tg_chat_id, tg_username) values ($1, $2) returning id", tgChatId, tgUsername).Scan(&id)
 	return
 }
 
-func GetTagsByNoteId(noteId int64) ([]Tag, error) {
-	var tags []Tag
-	rows, err := DB.Query(`select tags.id, tags.user_id, tags.title from tags 
+func (s *sqlStorage) GetTagsByNoteId(userId, noteId int64) ([]Tag, error) {
+	return tagsByNoteId(context.Background(), s.db, userId, noteId)
+}
+
+// tagsByNoteId теги заметки, внутри транзакции читаются через неё
+func tagsByNoteId(ctx context.Context, q queryer, userId, noteId int64) ([]Tag, error) {
+	rows, err := q.QueryContext(ctx, `select tags.id, tags.user_id, tags.title from tags 
 	join tags_to_note ttn on tags.id = ttn.tag_id 
 	join notes on notes.id = ttn.note_id 
-	where notes.id = $1`, noteId)
-	if err != nil && !errors.Is(sql.ErrNoRows, err) {
-		return tags, nil
-	}
+	where notes.id = $1 and notes.user_id = $2`, noteId, userId)
 	if err != nil {
-		return tags, err
-	}
-	for rows.Next() {
-		tag := Tag{}
-		err = rows.Scan(&tag.Id, &tag.UserId, &tag.Title)
-		if err != nil {
-			return tags, err
-		}
-		tags = append(tags, tag)
+		return nil, err
 	}
-	return tags, nil
+	return scanTags(rows)
 }
 
-func GetTagsByUserId(userId int64) ([]Tag, error) {
-	var tags []Tag
-	rows, err := DB.Query(`select t.id, t.user_id, t.title from tags t
+func (s *sqlStorage) GetTagsByUserId(userId int64) ([]Tag, error) {
+	rows, err := s.db.Query(`select t.id, t.user_id, t.title from tags t
 	where t.user_id = $1`, userId)
-	if err != nil && !errors.Is(sql.ErrNoRows, err) {
-		return tags, nil
-	}
 	if err != nil {
-		return tags, err
+		return nil, err
 	}
+	return scanTags(rows)
+}
+
+func scanTags(rows *sql.Rows) ([]Tag, error) {
+	defer rows.Close()
+	var tags []Tag
 	for rows.Next() {
 		tag := Tag{}
-		err = rows.Scan(&tag.Id, &tag.UserId, &tag.Title)
-		if err != nil {
-			return tags, err
+		if err := rows.Scan(&tag.Id, &tag.UserId, &tag.Title); err != nil {
+			return nil, err
 		}
 		tags = append(tags, tag)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 	return tags, nil
 }
 
-func NewNote(ctx context.Context, userId int64, title, url, description string, _tags []string) error {
+func (s *sqlStorage) NewNote(ctx context.Context, userId int64, title, url, description string, _tags []string) (int64, error) {
 	var err error
-	tx, err := DB.BeginTx(ctx, nil)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 	tags := []Tag{}
@@ -205,13 +199,13 @@ func NewNote(ctx context.Context, userId int64, title, url, description string,
 		}
 		err = tx.QueryRowContext(ctx, "select id from tags where user_id = $1 and title = $2", userId, _tag).Scan(&tag.Id)
 		if err != nil && !errors.Is(sql.ErrNoRows, err) {
-			return err
+			return 0, err
 		}
 		if errors.Is(sql.ErrNoRows, err) {
 			row := tx.QueryRowContext(ctx, "insert into tags (user_id, title) values ($1, $2) returning id", userId, _tag)
 			err = row.Scan(&tag.Id)
 			if err != nil {
-				return err
+				return 0, err
 			}
 		}
 		tags = append(tags, tag)
@@ -220,24 +214,31 @@ func NewNote(ctx context.Context, userId int64, title, url, description string,
 	note := Note{}
 	err = tx.QueryRowContext(ctx, "insert into \"notes\" (user_id, title, url, description) values ($1, $2, $3, $4) returning id", userId, title, url, description).Scan(&note.Id)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	for _, tag := range tags {
 		_, err = tx.ExecContext(ctx, "insert into tags_to_note (note_id, tag_id) values ($1, $2)", note.Id, tag.Id)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit()
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return note.Id, nil
 }
 
-func RemoveNoteTag(ctx context.Context, tagId int64, noteId int64) error {
-	tx, err := DB.BeginTx(ctx, nil)
+func (s *sqlStorage) RemoveNoteTag(ctx context.Context, userId, tagId, noteId int64) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+	if err = ownNote(ctx, tx, userId, noteId); err != nil {
+		return err
+	}
 	_, err = tx.ExecContext(ctx, "delete from tags_to_note where tag_id = $1 and note_id = $2", tagId, noteId)
 	if err != nil {
 		return err
@@ -245,19 +246,27 @@ func RemoveNoteTag(ctx context.Context, tagId int64, noteId int64) error {
 	return tx.Commit()
 }
 
-func UpdNote(ctx context.Context, note Note, newTags []string) error {
+func (s *sqlStorage) UpdNote(ctx context.Context, note Note, newTags []string) error {
 	var err error
-	tx, err := DB.BeginTx(ctx, nil)
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		log.ERROR(err.Error())
 		return err
 	}
 	defer tx.Rollback()
-	oldTags, err := GetTagsByNoteId(note.Id)
+	// владелец проверяется до того, как меняются теги
+	if err = ownNote(ctx, tx, note.UserId, note.Id); err != nil {
+		return err
+	}
+	oldTags, err := tagsByNoteId(ctx, tx, note.UserId, note.Id)
 	if err != nil {
 		log.ERROR(err.Error())
 		return err
 	}
+	if err = s.saveRevision(ctx, tx, note, newTags); err != nil {
+		log.ERROR(err.Error())
+		return err
+	}
 
 	diffTags := map[string]bool{}
 	for _, _tag := range newTags {
@@ -318,10 +327,10 @@ func UpdNote(ctx context.Context, note Note, newTags []string) error {
 	return tx.Commit()
 }
 
-func GetNotes(userId int64) ([]Note, error) {
+func (s *sqlStorage) GetNotes(userId int64, order SortOrder) ([]Note, error) {
 	var err error
 	notes := []Note{}
-	rows, err := DB.Query("select id, title, url, description from notes where user_id = $1", userId)
+	rows, err := s.db.Query("select id, title, url, description from notes where user_id = $1 and deleted_at is null "+order.orderBy(), userId)
 	if err != nil && !errors.Is(sql.ErrNoRows, err) {
 		return nil, err
 	}
@@ -344,14 +353,14 @@ func GetNotes(userId int64) ([]Note, error) {
 
 	return notes, nil
 }
-func GetNotesByTag(userId int64, tag string) ([]Note, error) {
+func (s *sqlStorage) GetNotesByTag(userId int64, tag string, order SortOrder) ([]Note, error) {
 	var err error
 	notes := []Note{}
-	rows, err := DB.Query(`select notes.id, notes.title, url, description from notes 
+	rows, err := s.db.Query(`select notes.id, notes.title, url, description from notes 
 	join tags_to_note ttn on ttn.note_id = notes.id 
 	join tags t on t.id = ttn.tag_id and t.user_id = notes.user_id 
-	where notes.user_id = $1
-	and t.title = $2`, userId, tag)
+	where notes.user_id = $1 and notes.deleted_at is null
+	and t.title = $2 `+order.orderBy(), userId, tag)
 	if err != nil && !errors.Is(sql.ErrNoRows, err) {
 		return nil, err
 	}
@@ -375,25 +384,58 @@ func GetNotesByTag(userId int64, tag string) ([]Note, error) {
 	return notes, nil
 }
 
-func GetNote(noteId int64) (Note, error) {
+// GetNotesByTagQuery заметки, подходящие под запрос по тегам, например "#a | #b -#c"
+func (s *sqlStorage) GetNotesByTagQuery(userId int64, query tagquery.Node, order SortOrder) ([]Note, error) {
+	var err error
+	notes := []Note{}
+	args := []any{userId}
+	cond := tagquery.SQL(query, func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	})
+	rows, err := s.db.Query(`select notes.id, notes.title, url, description from notes 
+	where notes.user_id = $1 and notes.deleted_at is null
+	and `+cond+" "+order.orderBy(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := Note{}
+		err = rows.Scan(&note.Id, &note.Title, &note.Url, &note.Description)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (s *sqlStorage) GetNote(userId, noteId int64) (Note, error) {
 	var err error
 	note := Note{}
-	row := DB.QueryRow("select id, title, url, description, user_id from notes where id = $1", noteId)
+	row := s.db.QueryRow("select id, title, url, description, user_id from notes where id = $1 and user_id = $2 and deleted_at is null", noteId, userId)
 	err = row.Scan(&note.Id, &note.Title, &note.Url, &note.Description, &note.UserId)
-	if err != nil && !errors.Is(sql.ErrNoRows, err) {
-		return note, err
-	}
 	if errors.Is(sql.ErrNoRows, err) {
-		return note, nil
+		return Note{}, ErrNotFound
+	}
+	if err != nil {
+		return Note{}, err
 	}
 
 	return note, nil
 }
 
-func DeleteNote(noteId int64) error {
+// DeleteNote переносит заметку в корзину, совсем она удаляется PurgeNote или PurgeTrash
+func (s *sqlStorage) DeleteNote(userId, noteId int64) error {
 	log.DEBUG(fmt.Sprintf("delete note with id=%v", noteId))
-	_, err := DB.Exec("delete from notes where id = $1", noteId)
-	if err != nil {
+	err := affected(s.db.Exec("update notes set deleted_at = $1 where id = $2 and user_id = $3 and deleted_at is null", time.Now().UTC(), noteId, userId))
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		log.ERROR(err.Error())
 	}
 
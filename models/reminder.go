@@ -0,0 +1,140 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type Reminder struct {
+	Id        int64     `json:"id"`
+	UserId    int64     `json:"user_id"`
+	NoteId    int64     `json:"note_id"`
+	FireAt    time.Time `json:"fire_at"`
+	Repeat    string    `json:"repeat"` // правило повторения в формате пакета schedule, пусто для разовых
+	Paused    bool      `json:"paused"`
+	TgChatId  int64     `json:"tg_chat_id"`
+	NoteTitle string    `json:"note_title"`
+}
+
+// NewReminder время напоминаний хранится в UTC: SQLite сравнивает его как строку
+func (s *sqlStorage) NewReminder(ctx context.Context, userId, noteId int64, fireAt time.Time, repeat string) (id int64, err error) {
+	if err = ownNote(ctx, s.db, userId, noteId); err != nil {
+		return 0, err
+	}
+	err = s.db.QueryRowContext(ctx, "insert into reminders (user_id, note_id, fire_at, repeat) values ($1, $2, $3, $4) returning id", userId, noteId, fireAt.UTC(), repeat).Scan(&id)
+	return
+}
+
+func (s *sqlStorage) GetReminder(userId, id int64) (Reminder, error) {
+	reminder := Reminder{}
+	err := s.db.QueryRow(`select r.id, r.user_id, r.note_id, r.fire_at, coalesce(r.repeat, ''), r.paused, n.title from reminders r
+	join notes n on n.id = r.note_id
+	where r.id = $1 and r.user_id = $2`, id, userId).
+		Scan(&reminder.Id, &reminder.UserId, &reminder.NoteId, &reminder.FireAt, &reminder.Repeat, &reminder.Paused, &reminder.NoteTitle)
+	if errors.Is(sql.ErrNoRows, err) {
+		return Reminder{}, ErrNotFound
+	}
+	if err != nil {
+		return reminder, err
+	}
+
+	return reminder, nil
+}
+
+// GetActiveReminders напоминания пользователя, которые ещё не сработали, включая приостановленные
+func (s *sqlStorage) GetActiveReminders(userId int64) ([]Reminder, error) {
+	reminders := []Reminder{}
+	rows, err := s.db.Query(`select r.id, r.user_id, r.note_id, r.fire_at, coalesce(r.repeat, ''), r.paused, n.title from reminders r
+	join notes n on n.id = r.note_id
+	where r.user_id = $1 and r.sent_at is null and n.deleted_at is null
+	order by r.fire_at`, userId)
+	if err != nil && !errors.Is(sql.ErrNoRows, err) {
+		return nil, err
+	}
+	if errors.Is(sql.ErrNoRows, err) {
+		return reminders, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reminder := Reminder{}
+		err = rows.Scan(&reminder.Id, &reminder.UserId, &reminder.NoteId, &reminder.FireAt, &reminder.Repeat, &reminder.Paused, &reminder.NoteTitle)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// ClaimDueReminders помечает сработавшие напоминания отправленными и возвращает их.
+// Строки блокируются через skip locked, поэтому несколько запущенных ботов
+// не получат одно и то же напоминание.
+func (p *Postgres) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error) {
+	reminders := []Reminder{}
+	rows, err := p.db.QueryContext(ctx, `update reminders r set sent_at = $1
+	from users u
+	where u.id = r.user_id and r.id in (
+		select id from reminders
+		where sent_at is null and not paused and fire_at <= $1
+		and note_id in (select id from notes where deleted_at is null)
+		order by fire_at
+		limit $2
+		for update skip locked)
+	returning r.id, r.user_id, r.note_id, r.fire_at, coalesce(r.repeat, ''), u.tg_chat_id`, now, limit)
+	if err != nil && !errors.Is(sql.ErrNoRows, err) {
+		return nil, err
+	}
+	if errors.Is(sql.ErrNoRows, err) {
+		return reminders, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reminder := Reminder{}
+		err = rows.Scan(&reminder.Id, &reminder.UserId, &reminder.NoteId, &reminder.FireAt, &reminder.Repeat, &reminder.TgChatId)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// ReleaseReminder возвращает напоминание в очередь, если его не удалось доставить.
+func (s *sqlStorage) ReleaseReminder(ctx context.Context, id int64) error {
+	_, err := s.db.ExecContext(ctx, "update reminders set sent_at = null where id = $1", id)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("release reminder %v error: %s", id, err))
+	}
+	return err
+}
+
+// RescheduleReminder переносит повторяющееся напоминание на следующее срабатывание
+func (s *sqlStorage) RescheduleReminder(ctx context.Context, id int64, fireAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, "update reminders set fire_at = $1, sent_at = null where id = $2", fireAt.UTC(), id)
+	return err
+}
+
+func (s *sqlStorage) PauseReminder(ctx context.Context, userId, id int64) error {
+	return affected(s.db.ExecContext(ctx, "update reminders set paused = true where id = $1 and user_id = $2", id, userId))
+}
+
+func (s *sqlStorage) ResumeReminder(ctx context.Context, userId, id int64, fireAt time.Time) error {
+	return affected(s.db.ExecContext(ctx, "update reminders set paused = false, fire_at = $1 where id = $2 and user_id = $3", fireAt.UTC(), id, userId))
+}
+
+func (s *sqlStorage) DeleteReminder(ctx context.Context, userId, id int64) error {
+	return affected(s.db.ExecContext(ctx, "delete from reminders where id = $1 and user_id = $2", id, userId))
+}
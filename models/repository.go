@@ -0,0 +1,113 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/playmixer/bot-note/tagquery"
+)
+
+type UserRepository interface {
+	// GetUserByTelegramId пользователь по id чата, если его нет - пустой User без ошибки
+	GetUserByTelegramId(id int64) (User, error)
+	GetUserByUserId(id int64) (User, error)
+	NewUser(tgChatId int64, tgUsername string) (id int64, err error)
+}
+
+type TagRepository interface {
+	GetTagsByNoteId(userId, noteId int64) ([]Tag, error)
+	GetTagsByUserId(userId int64) ([]Tag, error)
+	RemoveNoteTag(ctx context.Context, userId, tagId, noteId int64) error
+}
+
+type NoteRepository interface {
+	// NewNote создаёт заметку и возвращает её id, теги пользователя переиспользуются по названию
+	NewNote(ctx context.Context, userId int64, title, url, description string, tags []string) (int64, error)
+	// UpdNote обновляет заметку note.UserId и приводит её теги к tags, прежнее состояние сохраняется ревизией.
+	// Чужая заметка или заметка в корзине - ErrNotFound, теги при этом не меняются
+	UpdNote(ctx context.Context, note Note, tags []string) error
+	GetNotes(userId int64, order SortOrder) ([]Note, error)
+	GetNotesByTag(userId int64, tag string, order SortOrder) ([]Note, error)
+	GetNotesByTagQuery(userId int64, query tagquery.Node, order SortOrder) ([]Note, error)
+	// GetNote заметка пользователя по id, если её нет или она в корзине - ErrNotFound
+	GetNote(userId, noteId int64) (Note, error)
+	// DeleteNote переносит заметку пользователя в корзину
+	DeleteNote(userId, noteId int64) error
+	SearchNotes(userId int64, query string) ([]Note, error)
+	SearchNotesFuzzy(userId int64, query string) ([]Note, error)
+}
+
+type TrashRepository interface {
+	// GetTrash заметки пользователя в корзине, сначала удалённые последними
+	GetTrash(userId int64) ([]Note, error)
+	// RestoreNote возвращает заметку пользователя из корзины, restored - false, если её там нет.
+	// Чужая или удалённая навсегда заметка - ErrNotFound
+	RestoreNote(ctx context.Context, userId, noteId int64) (restored bool, err error)
+	// PurgeNote удаляет заметку пользователя из корзины навсегда
+	PurgeNote(ctx context.Context, userId, noteId int64) error
+	// PurgeTrash удаляет навсегда заметки, которые лежат в корзине с момента before или дольше
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+}
+
+type ReminderRepository interface {
+	// NewReminder напоминание о заметке пользователя, чужая заметка - ErrNotFound
+	NewReminder(ctx context.Context, userId, noteId int64, fireAt time.Time, repeat string) (id int64, err error)
+	// GetReminder напоминание пользователя по id, если его нет - ErrNotFound
+	GetReminder(userId, id int64) (Reminder, error)
+	GetActiveReminders(userId int64) ([]Reminder, error)
+	ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error)
+	ReleaseReminder(ctx context.Context, id int64) error
+	RescheduleReminder(ctx context.Context, id int64, fireAt time.Time) error
+	PauseReminder(ctx context.Context, userId, id int64) error
+	ResumeReminder(ctx context.Context, userId, id int64, fireAt time.Time) error
+	DeleteReminder(ctx context.Context, userId, id int64) error
+}
+
+type AttachmentRepository interface {
+	// AddAttachment прикрепляет файл к заметке пользователя, added - false, если этот файл уже прикреплён
+	AddAttachment(ctx context.Context, userId int64, attachment Attachment) (added bool, err error)
+	GetAttachments(userId, noteId int64) ([]Attachment, error)
+	CountAttachments(userId, noteId int64) (int, error)
+}
+
+type ChecklistRepository interface {
+	// AddChecklistItems добавляет пункты в конец списка заметки
+	AddChecklistItems(ctx context.Context, userId, noteId int64, titles []string) error
+	GetChecklist(userId, noteId int64) ([]ChecklistItem, error)
+	ToggleChecklistItem(ctx context.Context, userId, noteId, itemId int64) error
+	ClearDoneChecklistItems(ctx context.Context, userId, noteId int64) error
+	// GetChecklistProgress прогресс списков заметок пользователя, заметок без списка в ответе нет
+	GetChecklistProgress(userId int64, noteIds []int64) (map[int64]ChecklistProgress, error)
+}
+
+type RevisionRepository interface {
+	// GetNoteRevisions последние limit ревизий заметки пользователя, сначала новые
+	GetNoteRevisions(userId, noteId int64, limit int) ([]NoteRevision, error)
+	// GetNoteRevision ревизия заметки пользователя по id, если её нет - ErrNotFound
+	GetNoteRevision(userId, noteId, id int64) (NoteRevision, error)
+}
+
+type SettingsRepository interface {
+	// GetUserSettings настройки пользователя, если он их не менял - значения по умолчанию
+	GetUserSettings(userId int64) (UserSettings, error)
+	SetUserSettings(ctx context.Context, settings UserSettings) error
+}
+
+// Storage всё хранилище бота. Реализации: Postgres, SQLite и Memory (данные в памяти процесса)
+type Storage interface {
+	UserRepository
+	TagRepository
+	NoteRepository
+	TrashRepository
+	ReminderRepository
+	AttachmentRepository
+	ChecklistRepository
+	RevisionRepository
+	SettingsRepository
+}
+
+var (
+	_ Storage = (*Postgres)(nil)
+	_ Storage = (*SQLite)(nil)
+	_ Storage = (*Memory)(nil)
+)
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"sort"
+	"time"
+)
+
+// NoteRevision состояние заметки до очередного изменения: кто и когда её изменил
+// и какими были название, ссылка, описание и теги
+type NoteRevision struct {
+	Id          int64
+	NoteId      int64
+	UserId      int64
+	CreatedAt   time.Time
+	Title       string
+	Url         string
+	Description string
+	Tags        []string
+}
+
+// Note заметка в том виде, какой она была в ревизии
+func (r NoteRevision) Note() Note {
+	return Note{Id: r.NoteId, UserId: r.UserId, Title: r.Title, Url: r.Url, Description: r.Description}
+}
+
+// Changed отличается ли ревизия от заметки note с тегами tags
+func (r NoteRevision) Changed(note Note, tags []string) bool {
+	if r.Title != note.Title || r.Url != note.Url || r.Description != note.Description {
+		return true
+	}
+	return !sameTags(r.Tags, tags)
+}
+
+func sameTags(a, b []string) bool {
+	a, b = sortedTags(a), sortedTags(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedTags копия тегов без пустых, по алфавиту
+func sortedTags(tags []string) []string {
+	sorted := []string{}
+	for _, tag := range tags {
+		if tag != "" {
+			sorted = append(sorted, tag)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// saveRevision сохраняет текущее состояние заметки перед тем, как UpdNote заменит его на note и tags.
+// Если заметка не меняется, ревизия не нужна
+func (s *sqlStorage) saveRevision(ctx context.Context, tx *sql.Tx, note Note, tags []string) error {
+	revision := NoteRevision{NoteId: note.Id, UserId: note.UserId, CreatedAt: time.Now().UTC()}
+	err := tx.QueryRowContext(ctx, "select title, coalesce(url, ''), coalesce(description, '') from notes where id = $1 and user_id = $2",
+		note.Id, note.UserId).Scan(&revision.Title, &revision.Url, &revision.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `select tags.title from tags
+	join tags_to_note ttn on tags.id = ttn.tag_id
+	where ttn.note_id = $1`, note.Id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err = rows.Scan(&tag); err != nil {
+			return err
+		}
+		revision.Tags = append(revision.Tags, tag)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if !revision.Changed(note, tags) {
+		return nil
+	}
+	data, err := json.Marshal(sortedTags(revision.Tags))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into note_revisions (note_id, user_id, created_at, title, url, description, tags)
+	values ($1, $2, $3, $4, $5, $6, $7)`,
+		revision.NoteId, revision.UserId, revision.CreatedAt, revision.Title, revision.Url, revision.Description, string(data))
+	return err
+}
+
+// GetNoteRevisions последние limit ревизий заметки пользователя, сначала новые
+func (s *sqlStorage) GetNoteRevisions(userId, noteId int64, limit int) ([]NoteRevision, error) {
+	revisions := []NoteRevision{}
+	rows, err := s.db.Query(`select r.id, r.note_id, r.user_id, r.created_at, r.title, r.url, r.description, r.tags
+	from note_revisions r
+	join notes n on n.id = r.note_id
+	where r.note_id = $1 and n.user_id = $2
+	order by r.id desc limit $3`, noteId, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// GetNoteRevision ревизия заметки пользователя по id
+func (s *sqlStorage) GetNoteRevision(userId, noteId, id int64) (NoteRevision, error) {
+	row := s.db.QueryRow(`select r.id, r.note_id, r.user_id, r.created_at, r.title, r.url, r.description, r.tags
+	from note_revisions r
+	join notes n on n.id = r.note_id
+	where r.note_id = $1 and r.id = $2 and n.user_id = $3`, noteId, id, userId)
+	revision, err := scanRevision(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NoteRevision{}, ErrNotFound
+	}
+	return revision, err
+}
+
+func scanRevision(row interface{ Scan(...any) error }) (NoteRevision, error) {
+	revision := NoteRevision{}
+	var tags []byte
+	err := row.Scan(&revision.Id, &revision.NoteId, &revision.UserId, &revision.CreatedAt,
+		&revision.Title, &revision.Url, &revision.Description, &tags)
+	if err != nil {
+		return NoteRevision{}, err
+	}
+	if err = json.Unmarshal(tags, &revision.Tags); err != nil {
+		return NoteRevision{}, err
+	}
+	return revision, nil
+}
@@ -0,0 +1,158 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+const SEARCH_LIMIT = 500
+
+// SearchNotes ищет заметки пользователя по названию, описанию и ссылке.
+// Запрос разбирается в русской и английской конфигурациях, результаты отсортированы по релевантности.
+func (p *Postgres) SearchNotes(userId int64, query string) ([]Note, error) {
+	var err error
+	notes := []Note{}
+	rows, err := p.db.Query(`select notes.id, notes.title, notes.url, notes.description from notes,
+	(select websearch_to_tsquery('russian', $2) || websearch_to_tsquery('english', $2) as q) query
+	where notes.user_id = $1 and notes.deleted_at is null and notes.search_vector @@ query.q
+	order by ts_rank(notes.search_vector, query.q) desc, notes.id desc
+	limit $3`, userId, query, SEARCH_LIMIT)
+	if err != nil && !errors.Is(sql.ErrNoRows, err) {
+		return nil, err
+	}
+	if errors.Is(sql.ErrNoRows, err) {
+		return notes, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := Note{}
+		err = rows.Scan(&note.Id, &note.Title, &note.Url, &note.Description)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// SearchNotesFuzzy ищет заметки с учётом неверной раскладки клавиатуры и опечаток.
+// Сначала идут совпадения полнотекстового поиска по исходному запросу и запросу в другой раскладке,
+// затем заметки, похожие по триграммам на название или тег. Каждая заметка в результате встречается один раз.
+func (p *Postgres) SearchNotesFuzzy(userId int64, query string) ([]Note, error) {
+	return searchFuzzy(userId, query, p.SearchNotes, func(ranked rankedNotes, userId int64, query string) error {
+		return ranked.addSimilar(p.db, userId, query)
+	})
+}
+
+// searchFuzzy объединяет результаты search и similar для запроса и запроса в другой раскладке
+func searchFuzzy(userId int64, query string,
+	search func(userId int64, query string) ([]Note, error),
+	similar func(ranked rankedNotes, userId int64, query string) error,
+) ([]Note, error) {
+	queries := []string{query}
+	if switched := SwitchLayout(query); switched != query {
+		queries = append(queries, switched)
+	}
+
+	ranked := rankedNotes{}
+	for _, q := range queries {
+		notes, err := search(userId, q)
+		if err != nil {
+			return nil, err
+		}
+		for i, note := range notes {
+			// полнотекстовые совпадения всегда выше похожих по триграммам
+			ranked.add(note, 2-float64(i)/float64(len(notes)))
+		}
+	}
+
+	for _, q := range queries {
+		err := similar(ranked, userId, q)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ranked.sorted(), nil
+}
+
+type rankedNote struct {
+	note  Note
+	rank  float64
+	order int
+}
+
+type rankedNotes map[int64]*rankedNote
+
+func (r rankedNotes) add(note Note, rank float64) {
+	if n, ok := r[note.Id]; ok {
+		if rank > n.rank {
+			n.rank = rank
+		}
+		return
+	}
+	r[note.Id] = &rankedNote{note: note, rank: rank, order: len(r)}
+}
+
+func (r rankedNotes) addSimilar(db *sql.DB, userId int64, query string) error {
+	rows, err := db.Query(`select notes.id, notes.title, notes.url, notes.description, max(similar.rank) from (
+		select notes.id, word_similarity($2, notes.title) as rank from notes
+		where notes.user_id = $1 and $2 <% notes.title
+		union all
+		select ttn.note_id, similarity(t.title, $2) from tags t
+		join tags_to_note ttn on ttn.tag_id = t.id
+		where t.user_id = $1 and t.title % $2
+	) similar
+	join notes on notes.id = similar.id
+	where notes.deleted_at is null
+	group by notes.id
+	order by max(similar.rank) desc
+	limit $3`, userId, query, SEARCH_LIMIT)
+	if err != nil && !errors.Is(sql.ErrNoRows, err) {
+		return err
+	}
+	if errors.Is(sql.ErrNoRows, err) {
+		return nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := Note{}
+		var rank float64
+		err = rows.Scan(&note.Id, &note.Title, &note.Url, &note.Description, &rank)
+		if err != nil {
+			return err
+		}
+		r.add(note, rank)
+	}
+
+	return rows.Err()
+}
+
+func (r rankedNotes) sorted() []Note {
+	list := make([]*rankedNote, 0, len(r))
+	for _, n := range r {
+		list = append(list, n)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].rank != list[j].rank {
+			return list[i].rank > list[j].rank
+		}
+		return list[i].order < list[j].order
+	})
+
+	notes := make([]Note, len(list))
+	for i, n := range list {
+		notes[i] = n.note
+	}
+	if len(notes) > SEARCH_LIMIT {
+		notes = notes[:SEARCH_LIMIT]
+	}
+	return notes
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+type SortOrder string
+
+const (
+	SORT_ORDER_NEW   SortOrder = "new"   // сначала новые
+	SORT_ORDER_OLD   SortOrder = "old"   // сначала старые
+	SORT_ORDER_TITLE SortOrder = "title" // по названию
+)
+
+const (
+	DEFAULT_LANGUAGE  = "ru"
+	DEFAULT_PAGE_SIZE = 5
+)
+
+type UserSettings struct {
+	UserId    int64     `json:"user_id"`
+	Timezone  string    `json:"timezone"` // IANA имя пояса, пусто - время сервера
+	Language  string    `json:"language"`
+	PageSize  int       `json:"page_size"`
+	SortOrder SortOrder `json:"sort_order"`
+}
+
+func DefaultUserSettings(userId int64) UserSettings {
+	return UserSettings{
+		UserId:    userId,
+		Language:  DEFAULT_LANGUAGE,
+		PageSize:  DEFAULT_PAGE_SIZE,
+		SortOrder: SORT_ORDER_NEW,
+	}
+}
+
+// GetUserSettings настройки пользователя, если он их не менял - значения по умолчанию
+func (s *sqlStorage) GetUserSettings(userId int64) (UserSettings, error) {
+	settings := DefaultUserSettings(userId)
+	row := s.db.QueryRow(`select timezone, "language", page_size, sort_order from user_settings where user_id = $1`, userId)
+	err := row.Scan(&settings.Timezone, &settings.Language, &settings.PageSize, &settings.SortOrder)
+	if err != nil && !errors.Is(sql.ErrNoRows, err) {
+		return DefaultUserSettings(userId), err
+	}
+
+	return settings, nil
+}
+
+func (s *sqlStorage) SetUserSettings(ctx context.Context, settings UserSettings) error {
+	_, err := s.db.ExecContext(ctx, `insert into user_settings (user_id, timezone, "language", page_size, sort_order)
+	values ($1, $2, $3, $4, $5)
+	on conflict (user_id) do update set timezone = excluded.timezone, "language" = excluded."language",
+	page_size = excluded.page_size, sort_order = excluded.sort_order`,
+		settings.UserId, settings.Timezone, settings.Language, settings.PageSize, settings.SortOrder)
+	return err
+}
+
+// orderBy часть запроса для сортировки заметок, таблица notes должна быть доступна как notes
+func (o SortOrder) orderBy() string {
+	switch o {
+	case SORT_ORDER_OLD:
+		return "order by notes.id"
+	case SORT_ORDER_TITLE:
+		return "order by lower(notes.title), notes.id"
+	}
+	return "order by notes.id desc"
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLite хранилище в файле SQLite для запуска бота одним процессом без Postgres.
+// Полнотекстовый поиск идёт через FTS5, поиск с опечатками считается в памяти.
+type SQLite struct {
+	sqlStorage
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{sqlStorage{db: db}}
+}
+
+// ConnectSQLite открывает файл базы, включает внешние ключи и WAL
+func ConnectSQLite(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// SearchNotes ищет заметки по индексу notes_fts. Каждое слово запроса ищется как префикс,
+// это заменяет стемминг русского языка, которого нет в FTS5.
+func (s *SQLite) SearchNotes(userId int64, query string) ([]Note, error) {
+	words := searchWords(query)
+	if len(words) == 0 {
+		return []Note{}, nil
+	}
+	terms := make([]string, len(words))
+	for i, w := range words {
+		terms[i] = fmt.Sprintf(`"%s"*`, stem(w))
+	}
+
+	notes := []Note{}
+	rows, err := s.db.Query(`select notes.id, notes.title, notes.url, notes.description from notes_fts
+	join notes on notes.id = notes_fts.rowid
+	where notes_fts match $2 and notes.user_id = $1 and notes.deleted_at is null
+	order by bm25(notes_fts, 10.0, 4.0, 1.0), notes.id desc
+	limit $3`, userId, strings.Join(terms, " "), SEARCH_LIMIT)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := Note{}
+		err = rows.Scan(&note.Id, &note.Title, &note.Url, &note.Description)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (s *SQLite) SearchNotesFuzzy(userId int64, query string) ([]Note, error) {
+	return searchFuzzy(userId, query, s.SearchNotes, s.addSimilar)
+}
+
+// addSimilar похожие по триграммам заметки, в SQLite нет pg_trgm, поэтому похожесть
+// названий и тегов считается в памяти
+func (s *SQLite) addSimilar(ranked rankedNotes, userId int64, query string) error {
+	notes, err := s.GetNotes(userId, SORT_ORDER_NEW)
+	if err != nil {
+		return err
+	}
+
+	tags := map[int64][]string{}
+	rows, err := s.db.Query(`select ttn.note_id, t.title from tags t
+	join tags_to_note ttn on ttn.tag_id = t.id
+	where t.user_id = $1`, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var noteId int64
+		var title string
+		if err = rows.Scan(&noteId, &title); err != nil {
+			return err
+		}
+		tags[noteId] = append(tags[noteId], title)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		if rank := similarRank(query, note.Title, tags[note.Id]); rank > 0 {
+			ranked.add(note, rank)
+		}
+	}
+	return nil
+}
+
+// ClaimDueReminders помечает сработавшие напоминания отправленными одним запросом,
+// SQLite выполняет его атомарно
+func (s *SQLite) ClaimDueReminders(ctx context.Context, now time.Time, limit int) ([]Reminder, error) {
+	reminders := []Reminder{}
+	rows, err := s.db.QueryContext(ctx, `update reminders set sent_at = $1
+	where id in (
+		select id from reminders
+		where sent_at is null and not paused and fire_at <= $1
+		and note_id in (select id from notes where deleted_at is null)
+		order by fire_at
+		limit $2)
+	returning id, user_id, note_id, fire_at, coalesce(repeat, ''),
+		(select tg_chat_id from users where users.id = reminders.user_id)`, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		reminder := Reminder{}
+		err = rows.Scan(&reminder.Id, &reminder.UserId, &reminder.NoteId, &reminder.FireAt, &reminder.Repeat, &reminder.TgChatId)
+		if err != nil {
+			return nil, err
+		}
+		reminders = append(reminders, reminder)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
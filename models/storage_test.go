@@ -0,0 +1,787 @@
+package models_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/playmixer/bot-note/migrations"
+	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/tagquery"
+)
+
+// Каждая реализация Storage проходит один и тот же набор проверок.
+// Postgres проверяется, только если задана строка подключения TEST_POSTGRES_DSN,
+// например "host=localhost user=postgres password=postgres dbname=bot_note_test sslmode=disable"
+
+func TestMemoryStorage(t *testing.T) {
+	runStorageSuite(t, models.NewMemory())
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	runStorageSuite(t, models.NewSQLite(openDB(t, "sqlite", fmt.Sprintf(
+		"file:%s?mode=memory&cache=shared&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", t.Name()),
+		migrations.DIALECT_SQLITE)))
+}
+
+func TestPostgresStorage(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	runStorageSuite(t, models.NewPostgres(openDB(t, "postgres", dsn, migrations.DIALECT_POSTGRES)))
+}
+
+// TestSQLiteSingleConn с одним соединением запрос мимо открытой транзакции ждал бы его вечно
+func TestSQLiteSingleConn(t *testing.T) {
+	db := openDB(t, "sqlite", fmt.Sprintf("file:%s?mode=memory&cache=shared&_pragma=foreign_keys(1)", t.Name()),
+		migrations.DIALECT_SQLITE)
+	db.SetMaxOpenConns(1)
+	s := models.NewSQLite(db)
+	userId := newUser(t, s)
+	noteId := newNote(t, s, userId, "note", "go", "db")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.UpdNote(ctx, models.Note{Id: noteId, UserId: userId, Title: "note"}, []string{"go", "sql"})
+	if err != nil {
+		t.Fatalf("UpdNote: %s", err)
+	}
+	tags, err := s.GetTagsByNoteId(userId, noteId)
+	if err != nil || !equal(tagTitles(tags), []string{"go", "sql"}) {
+		t.Errorf("GetTagsByNoteId after UpdNote = %v, %v", tagTitles(tags), err)
+	}
+}
+
+// TestSQLiteQueryErrors ошибка запроса возвращается, а не выдаётся за пустой список
+func TestSQLiteQueryErrors(t *testing.T) {
+	db := openDB(t, "sqlite", fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name()), migrations.DIALECT_SQLITE)
+	s := models.NewSQLite(db)
+	db.Close()
+
+	if tags, err := s.GetTagsByNoteId(1, 1); err == nil {
+		t.Errorf("GetTagsByNoteId on a closed db = %v, nil", tags)
+	}
+	if tags, err := s.GetTagsByUserId(1); err == nil {
+		t.Errorf("GetTagsByUserId on a closed db = %v, nil", tags)
+	}
+}
+
+// openDB открывает базу и применяет к ней миграции
+func openDB(t *testing.T, driver, dsn, dialect string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func runStorageSuite(t *testing.T, s models.Storage) {
+	t.Run("users", func(t *testing.T) { testUsers(t, s) })
+	t.Run("notes", func(t *testing.T) { testNotes(t, s) })
+	t.Run("tags", func(t *testing.T) { testTags(t, s) })
+	t.Run("trash", func(t *testing.T) { testTrash(t, s) })
+	t.Run("revisions", func(t *testing.T) { testRevisions(t, s) })
+	t.Run("checklist", func(t *testing.T) { testChecklist(t, s) })
+	t.Run("attachments", func(t *testing.T) { testAttachments(t, s) })
+	t.Run("reminders", func(t *testing.T) { testReminders(t, s) })
+	t.Run("settings", func(t *testing.T) { testSettings(t, s) })
+	t.Run("isolation", func(t *testing.T) { testIsolation(t, s) })
+}
+
+// tgChatSeq id чатов Telegram для тестовых пользователей, не повторяются между запусками,
+// потому что база Postgres не очищается. Id больше 2^31, как у настоящих чатов
+var tgChatSeq = time.Now().UnixNano() / 1000
+
+func newUser(t *testing.T, s models.Storage) int64 {
+	t.Helper()
+	id, err := s.NewUser(atomic.AddInt64(&tgChatSeq, 1), "test")
+	if err != nil {
+		t.Fatalf("NewUser: %s", err)
+	}
+	return id
+}
+
+func newNote(t *testing.T, s models.Storage, userId int64, title string, tags ...string) int64 {
+	t.Helper()
+	id, err := s.NewNote(context.Background(), userId, title, "https://example.com/"+title, title+" description", tags)
+	if err != nil {
+		t.Fatalf("NewNote: %s", err)
+	}
+	return id
+}
+
+func noteIds(notes []models.Note) []int64 {
+	ids := make([]int64, len(notes))
+	for i, note := range notes {
+		ids[i] = note.Id
+	}
+	return ids
+}
+
+func tagTitles(tags []models.Tag) []string {
+	titles := make([]string, len(tags))
+	for i, tag := range tags {
+		titles[i] = tag.Title
+	}
+	sort.Strings(titles)
+	return titles
+}
+
+func equal[T comparable](a, b []T) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testUsers(t *testing.T, s models.Storage) {
+	tgChatId := atomic.AddInt64(&tgChatSeq, 1)
+	id, err := s.NewUser(tgChatId, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := s.GetUserByTelegramId(tgChatId)
+	if err != nil || user.Id != id || user.TgChatId != tgChatId || user.TgUsername != "alice" {
+		t.Errorf("GetUserByTelegramId = %+v, %v", user, err)
+	}
+	user, err = s.GetUserByUserId(id)
+	if err != nil || user.TgChatId != tgChatId {
+		t.Errorf("GetUserByUserId = %+v, %v", user, err)
+	}
+	if _, err = s.NewUser(tgChatId, "alice"); err == nil {
+		t.Error("NewUser with the same chat id succeeded")
+	}
+
+	user, err = s.GetUserByTelegramId(atomic.AddInt64(&tgChatSeq, 1))
+	if err != nil || user.Id != 0 {
+		t.Errorf("GetUserByTelegramId of unknown user = %+v, %v", user, err)
+	}
+}
+
+func testNotes(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+
+	first := newNote(t, s, userId, "banana", "go", "work")
+	second := newNote(t, s, userId, "Apple", "go")
+	third := newNote(t, s, userId, "cherry")
+
+	note, err := s.GetNote(userId, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.Note{Id: first, UserId: userId, Title: "banana", Url: "https://example.com/banana", Description: "banana description"}
+	if note != want {
+		t.Errorf("GetNote = %+v, want %+v", note, want)
+	}
+	if _, err = s.GetNote(userId, third+1000); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("GetNote of missing note: %v", err)
+	}
+
+	for _, tt := range []struct {
+		order models.SortOrder
+		want  []int64
+	}{
+		{models.SORT_ORDER_NEW, []int64{third, second, first}},
+		{models.SORT_ORDER_OLD, []int64{first, second, third}},
+		{models.SORT_ORDER_TITLE, []int64{second, first, third}},
+	} {
+		notes, err := s.GetNotes(userId, tt.order)
+		if err != nil || !equal(noteIds(notes), tt.want) {
+			t.Errorf("GetNotes(%s) = %v, %v, want %v", tt.order, noteIds(notes), err, tt.want)
+		}
+	}
+
+	notes, err := s.GetNotesByTag(userId, "go", models.SORT_ORDER_OLD)
+	if err != nil || !equal(noteIds(notes), []int64{first, second}) {
+		t.Errorf("GetNotesByTag = %v, %v", noteIds(notes), err)
+	}
+	query, err := tagquery.Parse("#go -#work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err = s.GetNotesByTagQuery(userId, query, models.SORT_ORDER_OLD)
+	if err != nil || !equal(noteIds(notes), []int64{second}) {
+		t.Errorf("GetNotesByTagQuery = %v, %v", noteIds(notes), err)
+	}
+
+	err = s.UpdNote(ctx, models.Note{Id: first, UserId: userId, Title: "blueberry", Url: "", Description: "ripe"}, []string{"work", "food"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err = s.GetNote(userId, first)
+	if err != nil || note.Title != "blueberry" || note.Url != "" || note.Description != "ripe" {
+		t.Errorf("GetNote after UpdNote = %+v, %v", note, err)
+	}
+	tags, err := s.GetTagsByNoteId(userId, first)
+	if err != nil || !equal(tagTitles(tags), []string{"food", "work"}) {
+		t.Errorf("tags after UpdNote = %v, %v", tagTitles(tags), err)
+	}
+
+	notes, err = s.SearchNotes(userId, "blueberry")
+	if err != nil || !equal(noteIds(notes), []int64{first}) {
+		t.Errorf("SearchNotes = %v, %v", noteIds(notes), err)
+	}
+	notes, err = s.SearchNotesFuzzy(userId, "bluebery")
+	if err != nil || len(notes) == 0 || notes[0].Id != first {
+		t.Errorf("SearchNotesFuzzy = %v, %v", noteIds(notes), err)
+	}
+
+	if err = s.DeleteNote(userId, second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetNote(userId, second); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("GetNote of deleted note: %v", err)
+	}
+	notes, err = s.GetNotes(userId, models.SORT_ORDER_OLD)
+	if err != nil || !equal(noteIds(notes), []int64{first, third}) {
+		t.Errorf("GetNotes after DeleteNote = %v, %v", noteIds(notes), err)
+	}
+	notes, err = s.GetNotesByTag(userId, "go", models.SORT_ORDER_OLD)
+	if err != nil || len(notes) != 0 {
+		t.Errorf("GetNotesByTag after DeleteNote = %v, %v", noteIds(notes), err)
+	}
+	if err = s.DeleteNote(userId, second); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("DeleteNote twice: %v", err)
+	}
+	if err = s.UpdNote(ctx, models.Note{Id: second, UserId: userId, Title: "changed"}, nil); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("UpdNote of deleted note: %v", err)
+	}
+}
+
+func testTags(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+
+	first := newNote(t, s, userId, "first", "go", "db", " ")
+	second := newNote(t, s, userId, "second", "go")
+
+	tags, err := s.GetTagsByUserId(userId)
+	if err != nil || !equal(tagTitles(tags), []string{"db", "go"}) {
+		t.Fatalf("GetTagsByUserId = %v, %v", tagTitles(tags), err)
+	}
+	tags, err = s.GetTagsByNoteId(userId, first)
+	if err != nil || !equal(tagTitles(tags), []string{"db", "go"}) {
+		t.Errorf("GetTagsByNoteId = %v, %v", tagTitles(tags), err)
+	}
+
+	var goTag models.Tag
+	for _, tag := range tags {
+		if tag.Title == "go" {
+			goTag = tag
+		}
+	}
+	if err = s.RemoveNoteTag(ctx, userId, goTag.Id, first); err != nil {
+		t.Fatal(err)
+	}
+	tags, err = s.GetTagsByNoteId(userId, first)
+	if err != nil || !equal(tagTitles(tags), []string{"db"}) {
+		t.Errorf("GetTagsByNoteId after RemoveNoteTag = %v, %v", tagTitles(tags), err)
+	}
+	// тег остаётся у пользователя и у другой заметки
+	tags, err = s.GetTagsByNoteId(userId, second)
+	if err != nil || !equal(tagTitles(tags), []string{"go"}) {
+		t.Errorf("GetTagsByNoteId of other note = %v, %v", tagTitles(tags), err)
+	}
+	tags, err = s.GetTagsByUserId(userId)
+	if err != nil || len(tags) != 2 {
+		t.Errorf("GetTagsByUserId after RemoveNoteTag = %v, %v", tagTitles(tags), err)
+	}
+}
+
+func testTrash(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+
+	kept := newNote(t, s, userId, "kept")
+	trashed := newNote(t, s, userId, "trashed", "go")
+
+	if err := s.AddChecklistItems(ctx, userId, trashed, []string{"milk"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := s.GetChecklist(userId, trashed)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("GetChecklist = %+v, %v", items, err)
+	}
+	if err = s.DeleteNote(userId, trashed); err != nil {
+		t.Fatal(err)
+	}
+	// заметка из корзины не меняется
+	if err = s.ToggleChecklistItem(ctx, userId, trashed, items[0].Id); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("ToggleChecklistItem of a trashed note: %v", err)
+	}
+	if items, err = s.GetChecklist(userId, trashed); err != nil || len(items) != 1 || items[0].Done {
+		t.Errorf("GetChecklist of a trashed note = %+v, %v", items, err)
+	}
+	trash, err := s.GetTrash(userId)
+	if err != nil || !equal(noteIds(trash), []int64{trashed}) || trash[0].DeletedAt.IsZero() || trash[0].Title != "trashed" {
+		t.Fatalf("GetTrash = %+v, %v", trash, err)
+	}
+
+	restored, err := s.RestoreNote(ctx, userId, trashed)
+	if err != nil || !restored {
+		t.Errorf("RestoreNote = %v, %v", restored, err)
+	}
+	if restored, err = s.RestoreNote(ctx, userId, trashed); err != nil || restored {
+		t.Errorf("RestoreNote of a note not in trash = %v, %v", restored, err)
+	}
+	note, err := s.GetNote(userId, trashed)
+	if err != nil || !note.DeletedAt.IsZero() {
+		t.Errorf("GetNote after RestoreNote = %+v, %v", note, err)
+	}
+	tags, err := s.GetTagsByNoteId(userId, trashed)
+	if err != nil || !equal(tagTitles(tags), []string{"go"}) {
+		t.Errorf("tags after RestoreNote = %v, %v", tagTitles(tags), err)
+	}
+
+	// PurgeNote удаляет только заметки из корзины
+	if err = s.PurgeNote(ctx, userId, kept); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetNote(userId, kept); err != nil {
+		t.Errorf("PurgeNote removed a note outside trash: %v", err)
+	}
+	if err = s.DeleteNote(userId, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.PurgeNote(ctx, userId, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if trash, err = s.GetTrash(userId); err != nil || len(trash) != 0 {
+		t.Errorf("GetTrash after PurgeNote = %v, %v", noteIds(trash), err)
+	}
+	if restored, err = s.RestoreNote(ctx, userId, trashed); !errors.Is(err, models.ErrNotFound) || restored {
+		t.Errorf("RestoreNote of purged note = %v, %v", restored, err)
+	}
+
+	// PurgeTrash удаляет заметки, удалённые не позже before
+	old := newNote(t, s, userId, "old")
+	if err = s.DeleteNote(userId, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.PurgeTrash(ctx, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if trash, err = s.GetTrash(userId); err != nil || !equal(noteIds(trash), []int64{old}) {
+		t.Errorf("PurgeTrash removed a recently deleted note: %v, %v", noteIds(trash), err)
+	}
+	n, err := s.PurgeTrash(ctx, time.Now().Add(time.Hour))
+	if err != nil || n < 1 {
+		t.Errorf("PurgeTrash = %v, %v", n, err)
+	}
+	if trash, err = s.GetTrash(userId); err != nil || len(trash) != 0 {
+		t.Errorf("GetTrash after PurgeTrash = %v, %v", noteIds(trash), err)
+	}
+	if _, err = s.GetNote(userId, kept); err != nil {
+		t.Errorf("PurgeTrash removed a note outside trash: %v", err)
+	}
+}
+
+func testRevisions(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+	noteId := newNote(t, s, userId, "v1", "a", "b")
+
+	revisions, err := s.GetNoteRevisions(userId, noteId, 10)
+	if err != nil || len(revisions) != 0 {
+		t.Fatalf("GetNoteRevisions of a new note = %v, %v", revisions, err)
+	}
+
+	update := func(title string, tags ...string) {
+		t.Helper()
+		err := s.UpdNote(ctx, models.Note{Id: noteId, UserId: userId, Title: title, Url: "https://example.com/v1", Description: "v1 description"}, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	update("v2", "b", "a")
+	update("v2", "a", "b") // ничего не поменялось, ревизии нет
+	update("v3", "c")
+
+	revisions, err = s.GetNoteRevisions(userId, noteId, 10)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("GetNoteRevisions = %+v, %v", revisions, err)
+	}
+	if revisions[0].Title != "v2" || !equal(revisions[0].Tags, []string{"a", "b"}) ||
+		revisions[1].Title != "v1" || !equal(revisions[1].Tags, []string{"a", "b"}) {
+		t.Errorf("GetNoteRevisions = %+v", revisions)
+	}
+	if revisions[1].Url != "https://example.com/v1" || revisions[1].Description != "v1 description" ||
+		revisions[1].NoteId != noteId || revisions[1].UserId != userId || revisions[1].CreatedAt.IsZero() {
+		t.Errorf("revision fields = %+v", revisions[1])
+	}
+
+	if limited, err := s.GetNoteRevisions(userId, noteId, 1); err != nil || len(limited) != 1 || limited[0].Id != revisions[0].Id {
+		t.Errorf("GetNoteRevisions with limit = %+v, %v", limited, err)
+	}
+	revision, err := s.GetNoteRevision(userId, noteId, revisions[1].Id)
+	if err != nil || revision.Title != "v1" || revision.Note().Title != "v1" {
+		t.Errorf("GetNoteRevision = %+v, %v", revision, err)
+	}
+	if _, err = s.GetNoteRevision(userId, noteId, revisions[0].Id+1000); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("GetNoteRevision of missing revision: %v", err)
+	}
+}
+
+func testChecklist(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+	noteId := newNote(t, s, userId, "todo")
+	empty := newNote(t, s, userId, "empty")
+
+	if err := s.AddChecklistItems(ctx, userId, noteId, []string{"milk", "bread"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddChecklistItems(ctx, userId, noteId, []string{"eggs"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := s.GetChecklist(userId, noteId)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("GetChecklist = %+v, %v", items, err)
+	}
+	for i, title := range []string{"milk", "bread", "eggs"} {
+		if items[i].Title != title || items[i].Position != i+1 || items[i].NoteId != noteId || items[i].Done {
+			t.Errorf("item %d = %+v", i, items[i])
+		}
+	}
+
+	if err = s.ToggleChecklistItem(ctx, userId, noteId, items[1].Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ToggleChecklistItem(ctx, userId, noteId, items[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ToggleChecklistItem(ctx, userId, noteId, items[2].Id); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.ToggleChecklistItem(ctx, userId, empty, items[0].Id); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("ToggleChecklistItem of an item from another note: %v", err)
+	}
+
+	progress, err := s.GetChecklistProgress(userId, []int64{noteId, empty})
+	if err != nil || len(progress) != 1 || progress[noteId] != (models.ChecklistProgress{Done: 1, Total: 3}) {
+		t.Errorf("GetChecklistProgress = %v, %v", progress, err)
+	}
+	if progress[noteId].String() != "1/3" {
+		t.Errorf("ChecklistProgress.String() = %q", progress[noteId].String())
+	}
+
+	if err = s.ClearDoneChecklistItems(ctx, userId, noteId); err != nil {
+		t.Fatal(err)
+	}
+	items, err = s.GetChecklist(userId, noteId)
+	if err != nil || len(items) != 2 || items[0].Title != "milk" || items[1].Title != "eggs" {
+		t.Errorf("GetChecklist after ClearDoneChecklistItems = %+v, %v", items, err)
+	}
+	if err = s.AddChecklistItems(ctx, userId, noteId, []string{"tea"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err = s.GetChecklist(userId, noteId)
+	if err != nil || len(items) != 3 || items[2].Title != "tea" || items[2].Position <= items[1].Position {
+		t.Errorf("GetChecklist after adding to a cleared list = %+v, %v", items, err)
+	}
+}
+
+func testAttachments(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+	noteId := newNote(t, s, userId, "files")
+
+	photo := models.Attachment{NoteId: noteId, Kind: models.ATTACHMENT_PHOTO, FileId: "photo-1", FileUniqueId: "u-photo"}
+	doc := models.Attachment{NoteId: noteId, Kind: models.ATTACHMENT_DOCUMENT, FileId: "doc-1", FileUniqueId: "u-doc", FileName: "report.pdf"}
+
+	for _, a := range []models.Attachment{photo, doc} {
+		if added, err := s.AddAttachment(ctx, userId, a); err != nil || !added {
+			t.Fatalf("AddAttachment(%s) = %v, %v", a.FileUniqueId, added, err)
+		}
+	}
+	// тот же файл с другим file_id не добавляется второй раз
+	again := photo
+	again.FileId = "photo-2"
+	if added, err := s.AddAttachment(ctx, userId, again); err != nil || added {
+		t.Errorf("AddAttachment of a duplicate = %v, %v", added, err)
+	}
+
+	attachments, err := s.GetAttachments(userId, noteId)
+	if err != nil || len(attachments) != 2 {
+		t.Fatalf("GetAttachments = %+v, %v", attachments, err)
+	}
+	if attachments[0].FileId != "photo-1" || attachments[0].Kind != models.ATTACHMENT_PHOTO || attachments[0].FileName != "" ||
+		attachments[1].FileName != "report.pdf" || attachments[1].NoteId != noteId || attachments[0].Id >= attachments[1].Id {
+		t.Errorf("GetAttachments = %+v", attachments)
+	}
+	if count, err := s.CountAttachments(userId, noteId); err != nil || count != 2 {
+		t.Errorf("CountAttachments = %v, %v", count, err)
+	}
+}
+
+func testReminders(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+	noteId := newNote(t, s, userId, "remind me")
+	user, err := s.GetUserByUserId(userId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	past := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	future := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	dueId, err := s.NewReminder(ctx, userId, noteId, past, "daily 10:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	laterId, err := s.NewReminder(ctx, userId, noteId, future, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reminder, err := s.GetReminder(userId, dueId)
+	if err != nil || reminder.NoteId != noteId || reminder.NoteTitle != "remind me" || reminder.Repeat != "daily 10:00" ||
+		!reminder.FireAt.Equal(past) || reminder.Paused {
+		t.Errorf("GetReminder = %+v, %v", reminder, err)
+	}
+	active, err := s.GetActiveReminders(userId)
+	if err != nil || len(active) != 2 || active[0].Id != dueId || active[1].Id != laterId {
+		t.Errorf("GetActiveReminders = %+v, %v", active, err)
+	}
+
+	claim := func() []int64 {
+		t.Helper()
+		claimed, err := s.ClaimDueReminders(ctx, time.Now(), 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []int64{}
+		for _, r := range claimed {
+			if r.UserId != userId {
+				continue
+			}
+			if r.TgChatId != user.TgChatId || r.NoteId != noteId {
+				t.Errorf("claimed reminder = %+v", r)
+			}
+			ids = append(ids, r.Id)
+		}
+		return ids
+	}
+
+	if err = s.PauseReminder(ctx, userId, dueId); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); len(ids) != 0 {
+		t.Errorf("paused reminder was claimed: %v", ids)
+	}
+	if err = s.ResumeReminder(ctx, userId, dueId, past); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); !equal(ids, []int64{dueId}) {
+		t.Errorf("ClaimDueReminders = %v, want %v", ids, []int64{dueId})
+	}
+	// отправленное напоминание не выдаётся второй раз и не считается активным
+	if ids := claim(); len(ids) != 0 {
+		t.Errorf("reminder was claimed twice: %v", ids)
+	}
+	if active, err = s.GetActiveReminders(userId); err != nil || len(active) != 1 || active[0].Id != laterId {
+		t.Errorf("GetActiveReminders after claim = %+v, %v", active, err)
+	}
+
+	if err = s.ReleaseReminder(ctx, dueId); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); !equal(ids, []int64{dueId}) {
+		t.Errorf("released reminder was not claimed again: %v", ids)
+	}
+	if err = s.RescheduleReminder(ctx, dueId, future.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); len(ids) != 0 {
+		t.Errorf("rescheduled reminder was claimed: %v", ids)
+	}
+	reminder, err = s.GetReminder(userId, dueId)
+	if err != nil || !reminder.FireAt.Equal(future.Add(time.Hour)) {
+		t.Errorf("GetReminder after RescheduleReminder = %+v, %v", reminder, err)
+	}
+
+	// напоминания заметок из корзины не срабатывают
+	if err = s.RescheduleReminder(ctx, dueId, past); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteNote(userId, noteId); err != nil {
+		t.Fatal(err)
+	}
+	if ids := claim(); len(ids) != 0 {
+		t.Errorf("reminder of a trashed note was claimed: %v", ids)
+	}
+	if active, err = s.GetActiveReminders(userId); err != nil || len(active) != 0 {
+		t.Errorf("GetActiveReminders of a trashed note = %+v, %v", active, err)
+	}
+	if _, err = s.NewReminder(ctx, userId, noteId, future, ""); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("NewReminder for a trashed note: %v", err)
+	}
+
+	if err = s.DeleteReminder(ctx, userId, laterId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.GetReminder(userId, laterId); !errors.Is(err, models.ErrNotFound) {
+		t.Errorf("GetReminder after DeleteReminder: %v", err)
+	}
+}
+
+func testSettings(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	userId := newUser(t, s)
+
+	settings, err := s.GetUserSettings(userId)
+	if err != nil || settings != models.DefaultUserSettings(userId) {
+		t.Errorf("GetUserSettings of a new user = %+v, %v", settings, err)
+	}
+
+	want := models.UserSettings{UserId: userId, Timezone: "Asia/Tokyo", Language: "en", PageSize: 10, SortOrder: models.SORT_ORDER_TITLE}
+	if err = s.SetUserSettings(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if settings, err = s.GetUserSettings(userId); err != nil || settings != want {
+		t.Errorf("GetUserSettings = %+v, %v, want %+v", settings, err, want)
+	}
+
+	want.Timezone, want.PageSize = "", 5
+	if err = s.SetUserSettings(ctx, want); err != nil {
+		t.Fatal(err)
+	}
+	if settings, err = s.GetUserSettings(userId); err != nil || settings != want {
+		t.Errorf("GetUserSettings after update = %+v, %v, want %+v", settings, err, want)
+	}
+}
+
+// testIsolation чужой пользователь не видит и не меняет заметку: на каждый вызов ErrNotFound, данные владельца прежние
+func testIsolation(t *testing.T, s models.Storage) {
+	ctx := context.Background()
+	owner := newUser(t, s)
+	stranger := newUser(t, s)
+
+	noteId := newNote(t, s, owner, "private", "go", "work")
+	trashed := newNote(t, s, owner, "binned", "old")
+	if err := s.DeleteNote(owner, trashed); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddChecklistItems(ctx, owner, noteId, []string{"milk"}); err != nil {
+		t.Fatal(err)
+	}
+	items, err := s.GetChecklist(owner, noteId)
+	if err != nil || len(items) != 1 {
+		t.Fatalf("GetChecklist = %+v, %v", items, err)
+	}
+	if _, err = s.AddAttachment(ctx, owner, models.Attachment{NoteId: noteId, Kind: models.ATTACHMENT_PHOTO, FileId: "photo-1", FileUniqueId: "u-photo"}); err != nil {
+		t.Fatal(err)
+	}
+	fireAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	reminderId, err := s.NewReminder(ctx, owner, noteId, fireAt, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	note, err := s.GetNote(owner, noteId)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := []struct {
+		name string
+		call func() error
+	}{
+		{"GetNote", func() error {
+			_, err := s.GetNote(stranger, noteId)
+			return err
+		}},
+		{"UpdNote", func() error {
+			return s.UpdNote(ctx, models.Note{Id: noteId, UserId: stranger, Title: "hacked", Url: "https://example.com/hacked"}, []string{"hacked"})
+		}},
+		{"DeleteNote", func() error { return s.DeleteNote(stranger, noteId) }},
+		{"RestoreNote", func() error {
+			restored, err := s.RestoreNote(ctx, stranger, trashed)
+			if restored {
+				t.Error("RestoreNote restored another user's note")
+			}
+			return err
+		}},
+		{"AddAttachment", func() error {
+			added, err := s.AddAttachment(ctx, stranger, models.Attachment{NoteId: noteId, Kind: models.ATTACHMENT_DOCUMENT, FileId: "doc-1", FileUniqueId: "u-doc"})
+			if added {
+				t.Error("AddAttachment attached a file to another user's note")
+			}
+			return err
+		}},
+		{"ToggleChecklistItem", func() error { return s.ToggleChecklistItem(ctx, stranger, noteId, items[0].Id) }},
+		{"NewReminder", func() error {
+			_, err := s.NewReminder(ctx, stranger, noteId, fireAt, "")
+			return err
+		}},
+		{"GetReminder", func() error {
+			_, err := s.GetReminder(stranger, reminderId)
+			return err
+		}},
+		{"PauseReminder", func() error { return s.PauseReminder(ctx, stranger, reminderId) }},
+		{"ResumeReminder", func() error { return s.ResumeReminder(ctx, stranger, reminderId, fireAt.Add(time.Hour)) }},
+		{"DeleteReminder", func() error { return s.DeleteReminder(ctx, stranger, reminderId) }},
+	}
+	for _, c := range calls {
+		if err := c.call(); !errors.Is(err, models.ErrNotFound) {
+			t.Errorf("%s of another user's note: %v, want ErrNotFound", c.name, err)
+		}
+	}
+
+	if got, err := s.GetNote(owner, noteId); err != nil || got != note {
+		t.Errorf("owner's note = %+v, %v, want %+v", got, err, note)
+	}
+	if tags, err := s.GetTagsByNoteId(owner, noteId); err != nil || !equal(tagTitles(tags), []string{"go", "work"}) {
+		t.Errorf("owner's tags = %v, %v", tagTitles(tags), err)
+	}
+	if tags, err := s.GetTagsByUserId(owner); err != nil || !equal(tagTitles(tags), []string{"go", "old", "work"}) {
+		t.Errorf("owner's tag list = %v, %v", tagTitles(tags), err)
+	}
+	if trash, err := s.GetTrash(owner); err != nil || !equal(noteIds(trash), []int64{trashed}) {
+		t.Errorf("owner's trash = %v, %v", noteIds(trash), err)
+	}
+	if attachments, err := s.GetAttachments(owner, noteId); err != nil || len(attachments) != 1 || attachments[0].FileUniqueId != "u-photo" {
+		t.Errorf("owner's attachments = %+v, %v", attachments, err)
+	}
+	if items, err = s.GetChecklist(owner, noteId); err != nil || len(items) != 1 || items[0].Done {
+		t.Errorf("owner's checklist = %+v, %v", items, err)
+	}
+	if reminder, err := s.GetReminder(owner, reminderId); err != nil || reminder.Paused || !reminder.FireAt.Equal(fireAt) {
+		t.Errorf("owner's reminder = %+v, %v", reminder, err)
+	}
+
+	// у чужого пользователя ничего не появилось
+	if notes, err := s.GetNotes(stranger, models.SORT_ORDER_NEW); err != nil || len(notes) != 0 {
+		t.Errorf("stranger's notes = %v, %v", noteIds(notes), err)
+	}
+	if tags, err := s.GetTagsByUserId(stranger); err != nil || len(tags) != 0 {
+		t.Errorf("stranger's tags = %v, %v", tagTitles(tags), err)
+	}
+	if reminders, err := s.GetActiveReminders(stranger); err != nil || len(reminders) != 0 {
+		t.Errorf("stranger's reminders = %+v, %v", reminders, err)
+	}
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// GetTrash заметки пользователя в корзине, сначала удалённые последними
+func (s *sqlStorage) GetTrash(userId int64) ([]Note, error) {
+	notes := []Note{}
+	rows, err := s.db.Query(`select id, user_id, title, url, description, deleted_at from notes
+	where user_id = $1 and deleted_at is not null
+	order by deleted_at desc, id desc`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		note := Note{}
+		err = rows.Scan(&note.Id, &note.UserId, &note.Title, &note.Url, &note.Description, &note.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+// RestoreNote возвращает заметку пользователя из корзины, restored - false, если её там нет.
+// Чужая или удалённая навсегда заметка - ErrNotFound
+func (s *sqlStorage) RestoreNote(ctx context.Context, userId, noteId int64) (restored bool, err error) {
+	res, err := s.db.ExecContext(ctx, "update notes set deleted_at = null where id = $1 and user_id = $2 and deleted_at is not null", noteId, userId)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n > 0 {
+		return n > 0, err
+	}
+	var id int64
+	err = s.db.QueryRowContext(ctx, "select id from notes where id = $1 and user_id = $2", noteId, userId).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	return false, err
+}
+
+// PurgeNote удаляет заметку пользователя из корзины навсегда вместе с тегами, вложениями и напоминаниями
+func (s *sqlStorage) PurgeNote(ctx context.Context, userId, noteId int64) error {
+	_, err := s.db.ExecContext(ctx, "delete from notes where id = $1 and user_id = $2 and deleted_at is not null", noteId, userId)
+	return err
+}
+
+// PurgeTrash удаляет навсегда заметки, которые лежат в корзине с момента before или дольше
+func (s *sqlStorage) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "delete from notes where deleted_at is not null and deleted_at <= $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
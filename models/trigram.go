@@ -0,0 +1,74 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Пороги pg_trgm по умолчанию для операторов % и <%
+const (
+	SIMILARITY_THRESHOLD      = 0.3
+	WORD_SIMILARITY_THRESHOLD = 0.6
+)
+
+// trigrams набор триграмм текста так же, как их строит pg_trgm:
+// слова в нижнем регистре дополняются двумя пробелами слева и одним справа
+func trigrams(text string) map[string]bool {
+	set := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range words {
+		runes := []rune("  " + w + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			set[string(runes[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// similarity доля общих триграмм двух строк
+func similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range ta {
+		if tb[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// wordSimilarity доля триграмм запроса, найденных в тексте,
+// упрощённый аналог word_similarity из pg_trgm
+func wordSimilarity(query, text string) float64 {
+	tq, tt := trigrams(query), trigrams(text)
+	if len(tq) == 0 {
+		return 0
+	}
+	common := 0
+	for t := range tq {
+		if tt[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(tq))
+}
+
+// similarRank похожесть заметки на запрос как в поиске Postgres: по названию через
+// word_similarity, по тегам через similarity. 0 - заметка не похожа
+func similarRank(query, title string, tags []string) float64 {
+	rank := 0.0
+	if s := wordSimilarity(query, title); s >= WORD_SIMILARITY_THRESHOLD {
+		rank = s
+	}
+	for _, tag := range tags {
+		if s := similarity(tag, query); s >= SIMILARITY_THRESHOLD && s > rank {
+			rank = s
+		}
+	}
+	return rank
+}
@@ -0,0 +1,169 @@
+// Package quickadd разбирает заметку, записанную одним сообщением:
+//
+//	Go memory model | https://go.dev/ref/mem | описание | #go #concurrency
+//	Статья про индексы https://use-the-index-luke.com #sql
+//
+// Ссылка ищется в любом месте сообщения, хештеги в любом месте становятся тегами.
+// Оставшийся текст делится по "|": первая часть - название, остальные - описание.
+// Без "|" название - первая строка, описание - остальные строки.
+package quickadd
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const SEPARATOR = "|"
+
+var ErrEmpty = errors.New("quickadd: empty note")
+
+type Note struct {
+	Title       string
+	Url         string
+	Description string
+	Tags        []string
+}
+
+// Is похоже ли сообщение на быструю заметку, а не на поисковый запрос:
+// в нём есть ссылка или название, отделённое "|". Запросы по тегам вида "#a | #b" заметкой не считаются
+func Is(text string) bool {
+	for _, word := range strings.Fields(text) {
+		if isUrl(word) {
+			return true
+		}
+	}
+	title, _, ok := strings.Cut(text, SEPARATOR)
+	if !ok {
+		return false
+	}
+	for _, word := range strings.Fields(title) {
+		if i := strings.IndexByte(word, '#'); i >= 0 {
+			word = word[:i]
+		}
+		if strings.IndexFunc(word, isWordRune) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse разбирает сообщение. Первая ссылка становится ссылкой заметки, остальные остаются в тексте.
+// Если кроме ссылки и тегов ничего нет, названием становится ссылка
+func Parse(text string) (Note, error) {
+	note := Note{}
+	seen := map[string]bool{}
+
+	texts := []string{}
+	for _, part := range split(text) {
+		lines := []string{}
+		for _, line := range part {
+			words := []string{}
+			for _, word := range line {
+				switch {
+				case note.Url == "" && isUrl(word):
+					note.Url = trimUrl(word)
+				case isTag(word):
+					tag := strings.TrimLeft(word, "#")
+					if !seen[tag] {
+						seen[tag] = true
+						note.Tags = append(note.Tags, tag)
+					}
+				default:
+					words = append(words, word)
+				}
+			}
+			if len(words) > 0 {
+				lines = append(lines, strings.Join(words, " "))
+			}
+		}
+		texts = append(texts, strings.Join(lines, "\n"))
+	}
+
+	note.Title = texts[0]
+	description := []string{}
+	for _, t := range texts[1:] {
+		if t != "" {
+			description = append(description, t)
+		}
+	}
+	note.Description = strings.Join(description, "\n")
+
+	if note.Title == "" {
+		note.Title = note.Url
+	}
+	if note.Title == "" {
+		return note, ErrEmpty
+	}
+	return note, nil
+}
+
+// split делит сообщение на части по "|", части - на строки, строки - на слова.
+// Ссылки выделяются до деления, поэтому "|" внутри ссылки её не разрезает
+func split(text string) [][][]string {
+	parts := [][][]string{{nil}}
+	separated := false
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			parts[len(parts)-1] = append(parts[len(parts)-1], nil)
+		}
+		for _, word := range strings.Fields(line) {
+			pieces := []string{word}
+			if !isUrl(word) {
+				pieces = strings.Split(word, SEPARATOR)
+			}
+			for j, piece := range pieces {
+				if j > 0 {
+					separated = true
+					parts = append(parts, [][]string{nil})
+				}
+				if piece != "" {
+					part := parts[len(parts)-1]
+					part[len(part)-1] = append(part[len(part)-1], piece)
+				}
+			}
+		}
+	}
+	if separated {
+		return parts
+	}
+
+	// без "|" название - первая непустая строка, описание - остальные строки
+	lines := parts[0]
+	for len(lines) > 1 && len(lines[0]) == 0 {
+		lines = lines[1:]
+	}
+	return [][][]string{lines[:1], lines[1:]}
+}
+
+func isUrl(word string) bool {
+	word = trimUrl(word)
+	if !strings.HasPrefix(word, "http://") && !strings.HasPrefix(word, "https://") {
+		return false
+	}
+	u, err := url.ParseRequestURI(word)
+	return err == nil && u.Host != ""
+}
+
+// trimUrl убирает знаки препинания, которые стоят после ссылки в тексте
+func trimUrl(word string) string {
+	return strings.TrimRight(word, ".,;:!?)»\"'")
+}
+
+func isTag(word string) bool {
+	tag := strings.TrimLeft(word, "#")
+	if len(tag) == len(word) || tag == "" {
+		return false
+	}
+	for _, r := range tag {
+		if !isWordRune(r) && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
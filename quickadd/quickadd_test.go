@@ -0,0 +1,113 @@
+package quickadd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want Note
+	}{
+		{
+			"Go memory model | https://go.dev/ref/mem | описание | #go #concurrency",
+			Note{Title: "Go memory model", Url: "https://go.dev/ref/mem", Description: "описание", Tags: []string{"go", "concurrency"}},
+		},
+		{
+			"Статья про индексы https://use-the-index-luke.com #sql",
+			Note{Title: "Статья про индексы", Url: "https://use-the-index-luke.com", Tags: []string{"sql"}},
+		},
+		// "|" внутри ссылки её не разрезает
+		{
+			"https://x.com/a?b=c|d",
+			Note{Title: "https://x.com/a?b=c|d", Url: "https://x.com/a?b=c|d"},
+		},
+		{
+			"Поиск | https://x.com/search?q=a|b | по двум словам",
+			Note{Title: "Поиск", Url: "https://x.com/search?q=a|b", Description: "по двум словам"},
+		},
+		{
+			"Поиск https://x.com/a|b\nописание",
+			Note{Title: "Поиск", Url: "https://x.com/a|b", Description: "описание"},
+		},
+		// "|" без пробелов вокруг делит текст
+		{
+			"Название|описание|#tag",
+			Note{Title: "Название", Description: "описание", Tags: []string{"tag"}},
+		},
+		{
+			"Название |https://go.dev",
+			Note{Title: "Название", Url: "https://go.dev"},
+		},
+		// без "|" название - первая строка, с "|" - всё до него
+		{
+			"\n\nНазвание\nпервая строка\n\nвторая строка https://go.dev.",
+			Note{Title: "Название", Url: "https://go.dev", Description: "первая строка\nвторая строка"},
+		},
+		{
+			"Название\nописание | продолжение",
+			Note{Title: "Название\nописание", Description: "продолжение"},
+		},
+		// первая ссылка - ссылка заметки, остальные остаются в тексте
+		{
+			"Две ссылки https://a.com https://b.com",
+			Note{Title: "Две ссылки https://b.com", Url: "https://a.com"},
+		},
+		{
+			"Документация: https://go.dev, #go #go ##go",
+			Note{Title: "Документация:", Url: "https://go.dev", Tags: []string{"go"}},
+		},
+		{
+			"#a #b-c | Название",
+			Note{Description: "Название", Tags: []string{"a", "b-c"}},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.text)
+		if tt.want.Title == "" {
+			if !errors.Is(err, ErrEmpty) {
+				t.Errorf("Parse(%q) = %+v, %v, want ErrEmpty", tt.text, got, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.text, err)
+			continue
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+			t.Errorf("Parse(%q) =\n%q\nwant\n%q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseEmpty(t *testing.T) {
+	for _, text := range []string{"", "  \n ", "|", " | | ", "#go #sql", "#go | #sql"} {
+		if note, err := Parse(text); !errors.Is(err, ErrEmpty) {
+			t.Errorf("Parse(%q) = %+v, %v, want ErrEmpty", text, note, err)
+		}
+	}
+}
+
+func TestIs(t *testing.T) {
+	for text, want := range map[string]bool{
+		"https://go.dev":          true,
+		"статья https://go.dev.":  true,
+		"https://x.com/a?b=c|d":   true,
+		"Название | описание":     true,
+		"Название|описание":       true,
+		"#go Название | описание": true,
+		"#a | #b":       false,
+		"#a | #b #c":    false,
+		"(#a | #b) -#c": false,
+		"просто текст":  false,
+		"ftp://go.dev":  false,
+		"https://":      false,
+		"":              false,
+	} {
+		if got := Is(text); got != want {
+			t.Errorf("Is(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSpec разобранное cron-выражение из пяти полей: минута, час, день месяца, месяц, день недели
+type cronSpec struct {
+	minute  uint64
+	hour    uint64
+	dom     uint64
+	month   uint64
+	dow     uint64
+	anyDom  bool
+	anyDow  bool
+	express string
+}
+
+type cronField struct {
+	min, max int
+}
+
+var (
+	fieldMinute = cronField{0, 59}
+	fieldHour   = cronField{0, 23}
+	fieldDom    = cronField{1, 31}
+	fieldMonth  = cronField{1, 12}
+	fieldDow    = cronField{0, 7}
+)
+
+var dowNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+func parseCron(express string) (cronSpec, error) {
+	fields := strings.Fields(express)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("cron expression must have 5 fields, got %v", len(fields))
+	}
+
+	var err error
+	spec := cronSpec{express: strings.Join(fields, " ")}
+	if spec.minute, err = parseCronField(fields[0], fieldMinute, nil); err != nil {
+		return spec, err
+	}
+	if spec.hour, err = parseCronField(fields[1], fieldHour, nil); err != nil {
+		return spec, err
+	}
+	if spec.dom, err = parseCronField(fields[2], fieldDom, nil); err != nil {
+		return spec, err
+	}
+	if spec.month, err = parseCronField(fields[3], fieldMonth, monthNames); err != nil {
+		return spec, err
+	}
+	if spec.dow, err = parseCronField(fields[4], fieldDow, dowNames); err != nil {
+		return spec, err
+	}
+	// 7 и 0 обозначают воскресенье
+	if spec.dow&(1<<7) != 0 {
+		spec.dow |= 1
+	}
+	spec.anyDom = fields[2] == "*" || fields[2] == "?"
+	spec.anyDow = fields[4] == "*" || fields[4] == "?"
+
+	return spec, nil
+}
+
+func parseCronField(field string, bounds cronField, names map[string]int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %q", part)
+			}
+			part = part[:i]
+		}
+
+		lo, hi := bounds.min, bounds.max
+		switch {
+		case part == "*" || part == "?":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = parseCronValue(bounds[0], names); err != nil {
+				return 0, err
+			}
+			if hi, err = parseCronValue(bounds[1], names); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := parseCronValue(part, names)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < bounds.min || hi > bounds.max || lo > hi {
+			return 0, fmt.Errorf("value out of range in %q", field)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("bad value %q", value)
+	}
+	return v, nil
+}
+
+func (c cronSpec) dayMatches(t time.Time) bool {
+	domOk := c.dom&(1<<uint(t.Day())) != 0
+	dowOk := c.dow&(1<<uint(t.Weekday())) != 0
+	// как в классическом cron: если заданы оба поля, достаточно совпадения одного
+	if c.anyDom || c.anyDow {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
+
+// next возвращает ближайший момент строго после after в часовом поясе after.
+// Поиск идёт по показаниям часов, поэтому при переводе часов назад повторившийся час
+// не срабатывает второй раз, а время, пропущенное при переводе вперёд, срабатывает сразу после перевода
+func (c cronSpec) next(after time.Time) time.Time {
+	loc := after.Location()
+	// показания часов, как если бы перевода не было
+	t := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		if at := wallTime(t, loc); at.After(after) {
+			return at
+		}
+		t = t.Add(time.Minute)
+	}
+
+	return time.Time{}
+}
+
+// wallTime момент, когда часы в loc показывают wall (wall задан в UTC без учёта пояса).
+// Из повторившегося при переводе назад времени берётся первое, пропущенное при переводе вперёд
+// сдвигается на величину перевода
+func wallTime(wall time.Time, loc *time.Location) time.Time {
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	for _, offset := range []int{before, after} {
+		t := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Day() == wall.Day() {
+			return t
+		}
+	}
+	return wall.Add(-time.Duration(before) * time.Second).In(loc)
+}
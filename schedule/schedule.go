@@ -0,0 +1,318 @@
+// Package schedule разбирает правила повторения напоминаний и считает время следующего срабатывания.
+//
+// Правило хранится в базе в каноническом виде:
+//
+//	daily 10:00
+//	weekly mon,fri 09:00
+//	monthly 15 09:00
+//	cron 0 9 * * 1-5
+//
+// Parse дополнительно понимает человеческие формулировки на русском и английском:
+// "ежедневно в 10:00", "по пн,пт 9:00", "каждую пятницу 18:30", "ежемесячно 15 в 9",
+// "every day at 10", "every mon,fri 9:00", "monthly 15 9:00".
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/playmixer/bot-note/dateparse"
+)
+
+type Kind string
+
+const (
+	KindDaily   Kind = "daily"
+	KindWeekly  Kind = "weekly"
+	KindMonthly Kind = "monthly"
+	KindCron    Kind = "cron"
+)
+
+var ErrNotSchedule = errors.New("text is not a repeat rule")
+
+type Schedule struct {
+	Kind     Kind
+	Hour     int
+	Minute   int
+	Weekdays []time.Weekday
+	Day      int
+	Cron     string
+
+	spec cronSpec
+}
+
+var weekdayCodes = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+var weekdayShortRu = []string{"вс", "пн", "вт", "ср", "чт", "пт", "сб"}
+
+// dailyWords и monthlyWords сами означают повтор, dayUnits и monthUnits только выбирают его вид:
+// "каждый день", но не "15 числа" или "день рождения"
+var (
+	dailyWords   = []string{"daily", "ежедневно"}
+	monthlyWords = []string{"monthly", "ежемесячно"}
+	dayUnits     = []string{"день", "day"}
+	monthUnits   = []string{"месяц", "месяца", "month", "число", "числа"}
+	repeatWords  = []string{"каждый", "каждую", "каждое", "каждые", "каждого", "every", "по", "weekly", "еженедельно"}
+	fillerWords  = []string{"в", "at", "on", "-го", "го"}
+)
+
+// Parse разбирает правило повторения. Для текста, в котором нет признаков повтора,
+// возвращается ErrNotSchedule.
+func Parse(rule string) (Schedule, error) {
+	text := strings.ToLower(strings.TrimSpace(rule))
+	if strings.HasPrefix(text, "cron ") {
+		return Cron(strings.TrimSpace(rule[len("cron "):]))
+	}
+
+	tokens := strings.Fields(strings.NewReplacer(",", " , ", "ё", "е", "-го", " ").Replace(text))
+	if len(tokens) == 0 {
+		return Schedule{}, ErrNotSchedule
+	}
+
+	s := Schedule{Hour: 9}
+	isRepeat := false
+	numbers := []int{}
+	timeFound := false
+	afterAt := false
+
+	for _, token := range tokens {
+		switch {
+		case token == ",":
+			continue
+		case contains(dailyWords, token) || contains(dayUnits, token):
+			isRepeat = isRepeat || contains(dailyWords, token)
+			if s.Kind == "" {
+				s.Kind = KindDaily
+			}
+		case contains(monthlyWords, token) || contains(monthUnits, token):
+			isRepeat = isRepeat || contains(monthlyWords, token)
+			s.Kind = KindMonthly
+		case token == "будни" || token == "weekdays" || token == "будням":
+			isRepeat = true
+			s.Kind = KindWeekly
+			s.Weekdays = append(s.Weekdays, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+		case token == "выходные" || token == "weekends" || token == "выходным":
+			isRepeat = true
+			s.Kind = KindWeekly
+			s.Weekdays = append(s.Weekdays, time.Saturday, time.Sunday)
+		case isClock(token):
+			h, m, _ := parseClock(token)
+			s.Hour, s.Minute = h, m
+			timeFound = true
+		case isNumber(token):
+			n, _ := strconv.Atoi(token)
+			if afterAt && !timeFound && n < 24 {
+				s.Hour, s.Minute = n, 0
+				timeFound = true
+			} else {
+				numbers = append(numbers, n)
+			}
+		default:
+			if day, ok := dateparse.ParseWeekday(token); ok {
+				s.Weekdays = append(s.Weekdays, day)
+				if s.Kind != KindMonthly {
+					s.Kind = KindWeekly
+				}
+				continue
+			}
+			if contains(repeatWords, token) {
+				isRepeat = true
+				continue
+			}
+			if !contains(fillerWords, token) {
+				return Schedule{}, ErrNotSchedule
+			}
+		}
+		afterAt = token == "в" || token == "at"
+	}
+
+	if !isRepeat {
+		return Schedule{}, ErrNotSchedule
+	}
+
+	switch s.Kind {
+	case KindMonthly:
+		if len(numbers) == 0 {
+			return Schedule{}, fmt.Errorf("day of month is required")
+		}
+		s.Day = numbers[0]
+		numbers = numbers[1:]
+	case KindWeekly, KindDaily:
+	default:
+		return Schedule{}, ErrNotSchedule
+	}
+	if !timeFound && len(numbers) == 1 && numbers[0] < 24 {
+		s.Hour = numbers[0]
+		numbers = nil
+	}
+	if len(numbers) > 0 {
+		return Schedule{}, fmt.Errorf("unexpected number %v", numbers[0])
+	}
+
+	return s.build()
+}
+
+// Cron создаёт расписание из сырого cron-выражения
+func Cron(express string) (Schedule, error) {
+	spec, err := parseCron(express)
+	if err != nil {
+		return Schedule{}, err
+	}
+	return Schedule{Kind: KindCron, Cron: spec.express, spec: spec}, nil
+}
+
+func (s Schedule) build() (Schedule, error) {
+	if s.Hour < 0 || s.Hour > 23 || s.Minute < 0 || s.Minute > 59 {
+		return Schedule{}, fmt.Errorf("bad time %02d:%02d", s.Hour, s.Minute)
+	}
+
+	var express string
+	switch s.Kind {
+	case KindDaily:
+		express = fmt.Sprintf("%d %d * * *", s.Minute, s.Hour)
+	case KindWeekly:
+		s.Weekdays = uniqueWeekdays(s.Weekdays)
+		if len(s.Weekdays) == 0 {
+			return Schedule{}, fmt.Errorf("weekdays are required")
+		}
+		days := make([]string, len(s.Weekdays))
+		for i, d := range s.Weekdays {
+			days[i] = strconv.Itoa(int(d))
+		}
+		express = fmt.Sprintf("%d %d * * %s", s.Minute, s.Hour, strings.Join(days, ","))
+	case KindMonthly:
+		if s.Day < 1 || s.Day > 31 {
+			return Schedule{}, fmt.Errorf("bad day of month %v", s.Day)
+		}
+		express = fmt.Sprintf("%d %d %d * *", s.Minute, s.Hour, s.Day)
+	default:
+		return Schedule{}, fmt.Errorf("unknown schedule kind %q", s.Kind)
+	}
+
+	spec, err := parseCron(express)
+	if err != nil {
+		return Schedule{}, err
+	}
+	s.spec = spec
+	return s, nil
+}
+
+// Next время следующего срабатывания строго после after, в часовом поясе after.
+// Нулевое время означает, что расписание больше не сработает.
+func (s Schedule) Next(after time.Time) time.Time {
+	return s.spec.next(after)
+}
+
+// String каноническая запись правила для хранения в базе
+func (s Schedule) String() string {
+	clock := fmt.Sprintf("%02d:%02d", s.Hour, s.Minute)
+	switch s.Kind {
+	case KindDaily:
+		return fmt.Sprintf("daily %s", clock)
+	case KindWeekly:
+		days := make([]string, len(s.Weekdays))
+		for i, d := range s.Weekdays {
+			days[i] = weekdayCodes[d]
+		}
+		return fmt.Sprintf("weekly %s %s", strings.Join(days, ","), clock)
+	case KindMonthly:
+		return fmt.Sprintf("monthly %d %s", s.Day, clock)
+	case KindCron:
+		return fmt.Sprintf("cron %s", s.Cron)
+	}
+	return ""
+}
+
+// Describe описание правила для пользователя на языке lang ("ru" или "en")
+func (s Schedule) Describe(lang string) string {
+	clock := fmt.Sprintf("%02d:%02d", s.Hour, s.Minute)
+	if lang == "en" {
+		switch s.Kind {
+		case KindDaily:
+			return fmt.Sprintf("daily at %s", clock)
+		case KindWeekly:
+			days := make([]string, len(s.Weekdays))
+			for i, d := range s.Weekdays {
+				days[i] = weekdayCodes[d]
+			}
+			return fmt.Sprintf("every %s at %s", strings.Join(days, ", "), clock)
+		case KindMonthly:
+			return fmt.Sprintf("monthly on day %d at %s", s.Day, clock)
+		case KindCron:
+			return fmt.Sprintf("cron %s", s.Cron)
+		}
+		return ""
+	}
+
+	switch s.Kind {
+	case KindDaily:
+		return fmt.Sprintf("ежедневно в %s", clock)
+	case KindWeekly:
+		days := make([]string, len(s.Weekdays))
+		for i, d := range s.Weekdays {
+			days[i] = weekdayShortRu[d]
+		}
+		return fmt.Sprintf("по %s в %s", strings.Join(days, ", "), clock)
+	case KindMonthly:
+		return fmt.Sprintf("ежемесячно %d числа в %s", s.Day, clock)
+	case KindCron:
+		return fmt.Sprintf("cron %s", s.Cron)
+	}
+	return ""
+}
+
+func uniqueWeekdays(days []time.Weekday) []time.Weekday {
+	seen := map[time.Weekday]bool{}
+	result := []time.Weekday{}
+	for _, d := range days {
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		// неделя начинается с понедельника
+		return (result[i]+6)%7 < (result[j]+6)%7
+	})
+	return result
+}
+
+func isClock(token string) bool {
+	_, _, ok := parseClock(token)
+	return ok
+}
+
+func parseClock(token string) (hour, minute int, ok bool) {
+	parts := strings.Split(token, ":")
+	if len(parts) != 2 || !isNumber(parts[0]) || !isNumber(parts[1]) {
+		return 0, 0, false
+	}
+	hour, _ = strconv.Atoi(parts[0])
+	minute, _ = strconv.Atoi(parts[1])
+	return hour, minute, hour < 24 && minute < 60
+}
+
+func isNumber(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, r := range token {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
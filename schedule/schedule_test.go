@@ -0,0 +1,227 @@
+package schedule
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ежедневно в 10:00", "daily 10:00"},
+		{"каждый день в 10", "daily 10:00"},
+		{"every day at 10", "daily 10:00"},
+		{"daily 7:05", "daily 07:05"},
+		{"по пн,пт 9:00", "weekly mon,fri 09:00"},
+		{"каждую пятницу 18:30", "weekly fri 18:30"},
+		{"по пятницам в 18", "weekly fri 18:00"},
+		{"every mon,fri 9:00", "weekly mon,fri 09:00"},
+		{"every sunday", "weekly sun 09:00"},
+		{"по будням в 8", "weekly mon,tue,wed,thu,fri 08:00"},
+		{"по выходным в 11:30", "weekly sat,sun 11:30"},
+		{"ежемесячно 15 в 9", "monthly 15 09:00"},
+		{"каждый месяц 15 числа в 9", "monthly 15 09:00"},
+		{"15 числа каждого месяца в 9", "monthly 15 09:00"},
+		{"ежемесячно 1-го", "monthly 1 09:00"},
+		{"monthly 15 9:00", "monthly 15 09:00"},
+		{"every month 31 at 23:59", "monthly 31 23:59"},
+		{"cron 0 9 * * 1-5", "cron 0 9 * * 1-5"},
+		{"cron  */15   * * * *", "cron */15 * * * *"},
+		// каноническая запись разбирается в себя же
+		{"daily 10:00", "daily 10:00"},
+		{"weekly mon,fri 09:00", "weekly mon,fri 09:00"},
+		{"monthly 15 09:00", "monthly 15 09:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.text)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.text, err)
+			continue
+		}
+		if got := s.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseNotSchedule(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"15 числа в 9",
+		"15 числа",
+		"день",
+		"day at 10",
+		"месяц",
+		"день рождения",
+		"в пятницу 18:30",
+		"завтра в 10",
+		"через 2 часа",
+		"hello",
+	} {
+		if s, err := Parse(text); !errors.Is(err, ErrNotSchedule) {
+			t.Errorf("Parse(%q) = %q, %v, want ErrNotSchedule", text, s, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{
+		"ежемесячно в 9",
+		"ежемесячно 32",
+		"ежемесячно 0 в 9",
+		"каждый день 10 11",
+		"ежедневно в 25",
+		"cron 61 * * * *",
+		"cron * * * *",
+	} {
+		s, err := Parse(text)
+		if err == nil || errors.Is(err, ErrNotSchedule) {
+			t.Errorf("Parse(%q) = %q, %v, want a rule error", text, s, err)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		rule, ru, en string
+	}{
+		{"daily 10:00", "ежедневно в 10:00", "daily at 10:00"},
+		{"weekly mon,fri 09:00", "по пн, пт в 09:00", "every mon, fri at 09:00"},
+		{"monthly 15 09:00", "ежемесячно 15 числа в 09:00", "monthly on day 15 at 09:00"},
+		{"cron 0 9 * * 1-5", "cron 0 9 * * 1-5", "cron 0 9 * * 1-5"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Describe("ru"); got != tt.ru {
+			t.Errorf("Describe(ru) of %q = %q, want %q", tt.rule, got, tt.ru)
+		}
+		if got := s.Describe("en"); got != tt.en {
+			t.Errorf("Describe(en) of %q = %q, want %q", tt.rule, got, tt.en)
+		}
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	for _, express := range []string{
+		"* * * * *",
+		"*/15 * * * *",
+		"0 9 * * mon-fri",
+		"0 9 * * MON,Fri",
+		"0 0 1 jan,jul *",
+		"30 8 1-7 * 1",
+		"0 0 * * 7",
+		"0 12 ? * ?",
+		"5/10 1-23/2 * * *",
+	} {
+		if _, err := parseCron(express); err != nil {
+			t.Errorf("parseCron(%q) error: %s", express, err)
+		}
+	}
+
+	for _, express := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1- * * * *",
+	} {
+		if _, err := parseCron(express); err == nil {
+			t.Errorf("parseCron(%q) accepted", express)
+		}
+	}
+
+	spec, err := parseCron("0 0 * * 7")
+	if err != nil || spec.dow&1 == 0 {
+		t.Errorf("7 is not sunday: %b, %v", spec.dow, err)
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	tests := []struct {
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		// воскресенье 18 октября 2026
+		{"daily 10:00", time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"daily 10:00", time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)},
+		{"daily 10:00", time.Date(2026, 10, 18, 9, 59, 59, 0, time.UTC), time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC)},
+		{"daily 00:00", time.Date(2026, 12, 31, 23, 30, 0, 0, time.UTC), time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"weekly mon,fri 09:00", time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC), time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)},
+		{"weekly mon,fri 09:00", time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC)},
+		{"weekly sun 09:00", time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC), time.Date(2026, 10, 25, 9, 0, 0, 0, time.UTC)},
+		{"cron */15 * * * *", time.Date(2026, 10, 18, 10, 7, 0, 0, time.UTC), time.Date(2026, 10, 18, 10, 15, 0, 0, time.UTC)},
+		{"cron 0 9 * * 1-5", time.Date(2026, 10, 23, 9, 0, 0, 0, time.UTC), time.Date(2026, 10, 26, 9, 0, 0, 0, time.UTC)},
+		// если заданы и день месяца, и день недели, достаточно одного: пятница или 13-е
+		{"cron 0 9 13 * 5", time.Date(2026, 11, 6, 10, 0, 0, 0, time.UTC), time.Date(2026, 11, 13, 9, 0, 0, 0, time.UTC)},
+		{"cron 0 9 13 * 5", time.Date(2026, 11, 13, 10, 0, 0, 0, time.UTC), time.Date(2026, 11, 20, 9, 0, 0, 0, time.UTC)},
+
+		// конец месяца: в коротких месяцах дня нет, расписание ждёт следующего подходящего месяца
+		{"monthly 31 09:00", time.Date(2026, 10, 31, 10, 0, 0, 0, time.UTC), time.Date(2026, 12, 31, 9, 0, 0, 0, time.UTC)},
+		{"monthly 31 09:00", time.Date(2027, 1, 31, 10, 0, 0, 0, time.UTC), time.Date(2027, 3, 31, 9, 0, 0, 0, time.UTC)},
+		{"monthly 30 09:00", time.Date(2027, 1, 30, 10, 0, 0, 0, time.UTC), time.Date(2027, 3, 30, 9, 0, 0, 0, time.UTC)},
+		{"monthly 29 09:00", time.Date(2027, 1, 29, 10, 0, 0, 0, time.UTC), time.Date(2027, 3, 29, 9, 0, 0, 0, time.UTC)},
+		{"monthly 29 09:00", time.Date(2028, 1, 29, 10, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 9, 0, 0, 0, time.UTC)},
+		{"cron 0 0 29 2 *", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"monthly 1 09:00", time.Date(2026, 12, 1, 9, 0, 0, 0, time.UTC), time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC)},
+
+		// часовой пояс after сохраняется, время считается по местным часам
+		{"daily 10:00", time.Date(2026, 10, 18, 9, 0, 0, 0, berlin), time.Date(2026, 10, 18, 10, 0, 0, 0, berlin)},
+		// перевод вперёд 29 марта 2026 в 02:00: сутки короче, время по часам то же
+		{"daily 10:00", time.Date(2026, 3, 28, 10, 0, 0, 0, berlin), time.Date(2026, 3, 29, 10, 0, 0, 0, berlin)},
+		// 02:30 в этот день нет, напоминание приходит сразу после перевода
+		{"daily 02:30", time.Date(2026, 3, 28, 12, 0, 0, 0, berlin), time.Date(2026, 3, 29, 1, 30, 0, 0, time.UTC)},
+		{"daily 02:30", time.Date(2026, 3, 8, 12, 0, 0, 0, newYork), time.Date(2026, 3, 9, 2, 30, 0, 0, newYork)},
+		{"daily 02:30", time.Date(2026, 3, 7, 12, 0, 0, 0, newYork), time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC)},
+		// перевод назад 25 октября 2026 в 03:00: 02:30 бывает дважды, срабатывает первое
+		{"daily 02:30", time.Date(2026, 10, 24, 12, 0, 0, 0, berlin), time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC)},
+		{"daily 02:30", time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC).In(berlin), time.Date(2026, 10, 26, 2, 30, 0, 0, berlin)},
+		{"daily 02:30", time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC).In(berlin), time.Date(2026, 10, 26, 2, 30, 0, 0, berlin)},
+		{"daily 01:30", time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC)},
+		{"daily 01:30", time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC).In(newYork), time.Date(2026, 11, 2, 1, 30, 0, 0, newYork)},
+		{"daily 10:00", time.Date(2026, 10, 24, 10, 0, 0, 0, berlin), time.Date(2026, 10, 25, 10, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := s.Next(tt.after)
+		if !got.Equal(tt.want) || got.Location() != tt.after.Location() {
+			t.Errorf("%q Next(%s) = %s, want %s", tt.rule, tt.after, got, tt.want.In(tt.after.Location()))
+		}
+	}
+
+	// 31 февраля не бывает
+	s, err := Cron("0 9 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("Next of an impossible date = %s, want zero", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf16"
+
+	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/schedule"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+const (
+	REMINDER_POLL_INTERVAL = time.Second * 30
+	REMINDER_BATCH_SIZE    = 50
+	REMINDER_DB_TIMEOUT    = time.Second * 10 // на каждый запрос к базе, свой у каждого напоминания
+	REMINDER_SEND_TIMEOUT  = time.Second * 10 // на отправку одного напоминания в Telegram
+	MESSAGE_MAX_LEN        = 4096             // предел Telegram на текст сообщения, в UTF-16 единицах
+)
+
+// runScheduler периодически забирает из базы наступившие напоминания и отправляет их.
+// Состояние хранится только в Postgres, поэтому после перезапуска ничего не теряется.
+func runScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.INFO("reminder scheduler started")
+	for {
+		sendDueReminders(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.INFO("reminder scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func sendDueReminders(ctx context.Context) {
+	claimCtx, cancel := context.WithTimeout(ctx, REMINDER_DB_TIMEOUT)
+	reminders, err := storage.ClaimDueReminders(claimCtx, time.Now(), REMINDER_BATCH_SIZE)
+	cancel()
+	if err != nil {
+		log.ERROR(fmt.Sprintf("claim reminders error: %s", err))
+		return
+	}
+
+	for i, reminder := range reminders {
+		if ctx.Err() != nil {
+			// бот останавливается: неотправленные напоминания возвращаются в очередь
+			for _, reminder := range reminders[i:] {
+				finishReminder(reminder, ctx.Err())
+			}
+			return
+		}
+		finishReminder(reminder, sendReminder(reminder))
+	}
+}
+
+// finishReminder после попытки отправки переносит напоминание на следующее срабатывание
+// или возвращает его в очередь. Запись идёт не в контексте остановки бота: иначе у захваченного
+// напоминания останется sent_at и оно больше не сработает
+func finishReminder(reminder models.Reminder, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), REMINDER_DB_TIMEOUT)
+	defer cancel()
+
+	switch {
+	case err == nil:
+		log.INFO(fmt.Sprintf("%v reminder %v sent", reminder.TgChatId, reminder.Id))
+		rescheduleReminder(ctx, reminder)
+	case errors.Is(err, errReminderUndeliverable):
+		log.ERROR(fmt.Sprintf("%v reminder %v error: %s", reminder.TgChatId, reminder.Id, err))
+	default:
+		log.ERROR(fmt.Sprintf("%v reminder %v error: %s", reminder.TgChatId, reminder.Id, err))
+		storage.ReleaseReminder(ctx, reminder.Id)
+	}
+}
+
+// rescheduleReminder для повторяющегося напоминания считает следующее срабатывание от текущего момента,
+// чтобы после простоя бот не присылал пачку пропущенных напоминаний
+func rescheduleReminder(ctx context.Context, reminder models.Reminder) {
+	if reminder.Repeat == "" {
+		return
+	}
+	sched, err := schedule.Parse(reminder.Repeat)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("reminder %v bad repeat rule %q: %s", reminder.Id, reminder.Repeat, err))
+		return
+	}
+	settings, err := storage.GetUserSettings(reminder.UserId)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("reminder %v settings error: %s", reminder.Id, err))
+	}
+	next := sched.Next(time.Now().In(LoadLocation(settings.Timezone)))
+	if next.IsZero() {
+		return
+	}
+	err = storage.RescheduleReminder(ctx, reminder.Id, next)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("reminder %v reschedule error: %s", reminder.Id, err))
+	}
+}
+
+var errReminderUndeliverable = errors.New("reminder undeliverable")
+
+func sendReminder(reminder models.Reminder) error {
+	note, err := storage.GetNote(reminder.UserId, reminder.NoteId)
+	if errors.Is(err, models.ErrNotFound) {
+		return fmt.Errorf("note %v not found: %w", reminder.NoteId, errReminderUndeliverable)
+	}
+	if err != nil {
+		return err
+	}
+	tags, err := storage.GetTagsByNoteId(reminder.UserId, note.Id)
+	if err != nil {
+		return err
+	}
+
+	settings, err := storage.GetUserSettings(reminder.UserId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), REMINDER_SEND_TIMEOUT)
+	defer cancel()
+	err = callApi(ctx, bot, "sendMessage", map[string]any{
+		"chat_id":    reminder.TgChatId,
+		"text":       validateString(reminderText(settings.Language, note, tags)),
+		"parse_mode": tg.MessageStyleMarkdownV2,
+	})
+	apiErr := &apiError{}
+	if errors.As(err, &apiErr) && (apiErr.Code == 400 || apiErr.Code == 403) {
+		// 403 - пользователь заблокировал бота, 400 - чата нет или Telegram не принял текст: повтор не поможет.
+		// Остальные ошибки временные, напоминание вернётся в очередь и уйдёт при следующей проверке
+		return fmt.Errorf("%w: %w", err, errReminderUndeliverable)
+	}
+	return err
+}
+
+// reminderText текст напоминания не длиннее MESSAGE_MAX_LEN: сначала обрезается описание, затем название
+func reminderText(lang string, note models.Note, tags []models.Tag) string {
+	text := func() string {
+		return fmt.Sprintf(Translate(lang, "⏰ *Напоминание*\n\n%s"), NoteText(lang, note, tags))
+	}
+	for _, field := range []*string{&note.Description, &note.Title} {
+		if utf16Len(text()) <= MESSAGE_MAX_LEN {
+			break
+		}
+		// самое длинное начало поля, с которым текст помещается
+		runes := []rune(*field)
+		lo, hi := 0, len(runes)
+		for lo < hi {
+			mid := (lo + hi + 1) / 2
+			*field = string(runes[:mid]) + "…"
+			if utf16Len(text()) <= MESSAGE_MAX_LEN {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		*field = ""
+		if lo > 0 {
+			*field = string(runes[:lo]) + "…"
+		}
+	}
+	return text()
+}
+
+// utf16Len длина s в UTF-16 единицах, так Telegram считает длину текста
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += runeUnits(r)
+	}
+	return n
+}
+
+// runeUnits сколько UTF-16 единиц занимает r: символы вне BMP записываются суррогатной парой
+func runeUnits(r rune) int {
+	if utf16.IsSurrogate(r) || r < 0x10000 {
+		return 1
+	}
+	return 2
+}
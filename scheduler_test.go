@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/playmixer/bot-note/models"
+)
+
+func TestReminderText(t *testing.T) {
+	short := models.Note{Title: "Go", Url: "https://go.dev", Description: "memory model"}
+	if text := reminderText(LANG_RU, short, nil); strings.Contains(text, "…") || !strings.Contains(text, "memory model") {
+		t.Errorf("short reminder changed: %q", text)
+	}
+
+	tests := []struct {
+		name string
+		note models.Note
+	}{
+		{"long description", models.Note{Title: "Go", Description: strings.Repeat("описание. ", 1000)}},
+		{"emoji description", models.Note{Title: "Go", Description: strings.Repeat("🙂_", 3000)}},
+		{"long title", models.Note{Title: strings.Repeat("T.", 3000), Description: strings.Repeat("d", 5000)}},
+	}
+	for _, tt := range tests {
+		text := validateString(reminderText(LANG_EN, tt.note, []models.Tag{{Title: "go"}}))
+		if n := utf16Len(text); n > MESSAGE_MAX_LEN || n < MESSAGE_MAX_LEN-100 {
+			t.Errorf("%s: %d UTF-16 units, want close to %d", tt.name, n, MESSAGE_MAX_LEN)
+		}
+		if !strings.Contains(text, "…") || !strings.HasSuffix(text, "go") {
+			t.Errorf("%s: text is not shortened in the middle: ...%q", tt.name, text[len(text)-80:])
+		}
+	}
+}
+
+func TestUtf16Len(t *testing.T) {
+	for text, want := range map[string]int{"": 0, "abc": 3, "привет": 6, "🙂": 2, "a🙂я": 4} {
+		if got := utf16Len(text); got != want {
+			t.Errorf("utf16Len(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf16"
+
+	"github.com/playmixer/bot-note/models"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+const SHARED_TITLE_MAX_LEN = 100 // длина названия заметки из пересланного сообщения, в символах
+
+// messageEntity сущность в тексте сообщения: ссылка, хештег и т.д.
+// Offset и Length считаются в UTF-16 единицах
+type messageEntity struct {
+	Type   string `json:"type"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Url    string `json:"url"`
+}
+
+// messageOrigin откуда переслано сообщение
+type messageOrigin struct {
+	Type           string  `json:"type"` // user, hidden_user, chat, channel
+	SenderUser     tg.User `json:"sender_user"`
+	SenderUserName string  `json:"sender_user_name"`
+	SenderChat     tg.Chat `json:"sender_chat"`
+	Chat           tg.Chat `json:"chat"`
+	MessageId      int64   `json:"message_id"`
+}
+
+// telegramFile файл в сообщении: фото, документ, аудио или голосовое
+type telegramFile struct {
+	FileId       string `json:"file_id"`
+	FileUniqueId string `json:"file_unique_id"`
+	FileName     string `json:"file_name"`
+}
+
+// sharedMessage поля сообщения, которые не разбирает tg: пересылка, подпись, файлы и сущности.
+// Заполняется при приёме обновления, обработчики получают его через sharedMessageOf
+type sharedMessage struct {
+	Text                 string          `json:"text"`
+	Entities             []messageEntity `json:"entities"`
+	Caption              string          `json:"caption"`
+	CaptionEntities      []messageEntity `json:"caption_entities"`
+	ForwardOrigin        *messageOrigin  `json:"forward_origin"`
+	ForwardFromChat      tg.Chat         `json:"forward_from_chat"`
+	ForwardFromMessageId int64           `json:"forward_from_message_id"`
+	ForwardSenderName    string          `json:"forward_sender_name"`
+	ForwardFrom          tg.User         `json:"forward_from"`
+	ForwardDate          int64           `json:"forward_date"`
+	Photo                []telegramFile  `json:"photo"`
+	Document             *telegramFile   `json:"document"`
+	Audio                *telegramFile   `json:"audio"`
+	Voice                *telegramFile   `json:"voice"`
+}
+
+// sharedMessages разобранные sharedMessage по update_id, пока обновление обрабатывается
+var sharedMessages sync.Map
+
+// sharedMessageOf сообщение обновления с полями пересылки и сущностями
+func sharedMessageOf(update tg.UpdateResult) (sharedMessage, bool) {
+	v, ok := sharedMessages.Load(update.UpdateId)
+	if !ok {
+		return sharedMessage{}, false
+	}
+	return v.(sharedMessage), true
+}
+
+// Forwarded переслано ли сообщение
+func (m sharedMessage) Forwarded() bool {
+	return m.ForwardOrigin != nil || m.ForwardDate != 0
+}
+
+// Shared нужно ли сохранить сообщение как заметку целиком: пересланное сообщение,
+// медиа с подписью или текст со ссылкой, спрятанной под словом
+func (m sharedMessage) Shared() bool {
+	if m.Forwarded() || m.Caption != "" {
+		return true
+	}
+	for _, entity := range m.Entities {
+		if entity.Type == "text_link" {
+			return true
+		}
+	}
+	return false
+}
+
+// Attachment файл сообщения для вложения в заметку, у фото берётся самый большой размер
+func (m sharedMessage) Attachment() (models.Attachment, bool) {
+	var kind models.AttachmentKind
+	var file *telegramFile
+	switch {
+	case len(m.Photo) > 0:
+		kind, file = models.ATTACHMENT_PHOTO, &m.Photo[len(m.Photo)-1]
+	case m.Document != nil:
+		kind, file = models.ATTACHMENT_DOCUMENT, m.Document
+	case m.Audio != nil:
+		kind, file = models.ATTACHMENT_AUDIO, m.Audio
+	case m.Voice != nil:
+		kind, file = models.ATTACHMENT_VOICE, m.Voice
+	default:
+		return models.Attachment{}, false
+	}
+	return models.Attachment{
+		Kind:         kind,
+		FileId:       file.FileId,
+		FileUniqueId: file.FileUniqueId,
+		FileName:     file.FileName,
+	}, true
+}
+
+func (m sharedMessage) body() (string, []messageEntity) {
+	if m.Text != "" {
+		return m.Text, m.Entities
+	}
+	return m.Caption, m.CaptionEntities
+}
+
+// Links ссылки из сущностей сообщения в порядке появления
+func (m sharedMessage) Links() []string {
+	text, entities := m.body()
+	links := []string{}
+	for _, entity := range entities {
+		switch entity.Type {
+		case "url":
+			links = append(links, entitySubstr(text, entity))
+		case "text_link":
+			links = append(links, entity.Url)
+		}
+	}
+	return links
+}
+
+// Hashtags хештеги сообщения без символа #
+func (m sharedMessage) Hashtags() []string {
+	text, entities := m.body()
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, entity := range entities {
+		if entity.Type != "hashtag" {
+			continue
+		}
+		tag := strings.TrimPrefix(entitySubstr(text, entity), "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// SourceName название канала, чата или имя автора пересланного сообщения
+func (m sharedMessage) SourceName() string {
+	if o := m.ForwardOrigin; o != nil {
+		switch o.Type {
+		case "channel":
+			return o.Chat.Title
+		case "chat":
+			return o.SenderChat.Title
+		case "hidden_user":
+			return o.SenderUserName
+		case "user":
+			return strings.TrimSpace(o.SenderUser.FirstName + " " + o.SenderUser.LastName)
+		}
+	}
+	if m.ForwardFromChat.Title != "" {
+		return m.ForwardFromChat.Title
+	}
+	if m.ForwardSenderName != "" {
+		return m.ForwardSenderName
+	}
+	return strings.TrimSpace(m.ForwardFrom.FirstName + " " + m.ForwardFrom.LastName)
+}
+
+// SourceLink ссылка на пересланный пост канала, для остальных источников пустая
+func (m sharedMessage) SourceLink() string {
+	chat, messageId := m.ForwardFromChat, m.ForwardFromMessageId
+	if o := m.ForwardOrigin; o != nil {
+		chat, messageId = o.Chat, o.MessageId
+	}
+	if messageId == 0 || chat.Id == 0 {
+		return ""
+	}
+	if chat.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", chat.Username, messageId)
+	}
+	// приватный канал: id вида -100XXXXXXXXXX открывается как t.me/c/XXXXXXXXXX
+	id := strings.TrimPrefix(fmt.Sprint(chat.Id), "-100")
+	return fmt.Sprintf("https://t.me/c/%s/%d", id, messageId)
+}
+
+// Note заметка из сообщения: первая строка - название, остальной текст - описание,
+// первая ссылка из текста или ссылка на пост - ссылка заметки
+func (m sharedMessage) Note(lang string) (title, url, description string, tags []string) {
+	text, _ := m.body()
+	text = strings.TrimSpace(text)
+	title, description, _ = strings.Cut(text, "\n")
+	title = strings.TrimSpace(title)
+	description = strings.TrimSpace(description)
+
+	if runes := []rune(title); len(runes) > SHARED_TITLE_MAX_LEN {
+		title = string(runes[:SHARED_TITLE_MAX_LEN]) + "…"
+		description = strings.TrimSpace(text)
+	}
+	if title == "" {
+		title = m.SourceName()
+	}
+	if title == "" {
+		title = Translate(lang, "Пересланное сообщение")
+	}
+
+	source := m.SourceLink()
+	if links := m.Links(); len(links) > 0 {
+		url = links[0]
+	} else {
+		url, source = source, ""
+	}
+	if m.Forwarded() {
+		name := m.SourceName()
+		if name == title {
+			name = ""
+		}
+		if line := strings.TrimSpace(name + " " + source); line != "" {
+			description = strings.TrimSpace(description + "\n\n" + Translate(lang, "Источник:") + " " + line)
+		}
+	}
+
+	return title, url, description, m.Hashtags()
+}
+
+// entitySubstr текст сущности, смещения в Telegram считаются в UTF-16
+func entitySubstr(text string, entity messageEntity) string {
+	units := utf16.Encode([]rune(text))
+	start, end := entity.Offset, entity.Offset+entity.Length
+	if start < 0 || end > len(units) || start > end {
+		return ""
+	}
+	return string(utf16.Decode(units[start:end]))
+}
@@ -0,0 +1,61 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory состояние в памяти процесса, теряется при перезапуске
+type Memory struct {
+	mu   sync.Mutex
+	data map[int64]entry
+}
+
+type entry struct {
+	data      []byte
+	version   int64
+	expiresAt time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{data: map[int64]entry{}}
+}
+
+func (m *Memory) Load(ctx context.Context, key int64) ([]byte, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data[key]
+	if !ok {
+		return nil, 0, nil
+	}
+	if time.Now().After(e.expiresAt) {
+		return nil, e.version, nil
+	}
+	return e.data, e.version, nil
+}
+
+func (m *Memory) Save(ctx context.Context, key int64, data []byte, version int64, ttl time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.data[key].version != version {
+		return 0, ErrConflict
+	}
+	m.data[key] = entry{data: data, version: version + 1, expiresAt: time.Now().Add(ttl)}
+	return version + 1, nil
+}
+
+func (m *Memory) Purge(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	for key, e := range m.data {
+		if now.After(e.expiresAt) {
+			delete(m.data, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// SQL состояние в таблице user_states, запросы одинаковы для Postgres и SQLite
+type SQL struct {
+	db *sql.DB
+}
+
+func NewSQL(db *sql.DB) *SQL {
+	return &SQL{db: db}
+}
+
+func (s *SQL) Load(ctx context.Context, key int64) ([]byte, int64, error) {
+	var data []byte
+	var version int64
+	var expiresAt time.Time
+	err := s.db.QueryRowContext(ctx, "select data, version, expires_at from user_states where user_key = $1", key).
+		Scan(&data, &version, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if time.Now().After(expiresAt) {
+		return nil, version, nil
+	}
+	return data, version, nil
+}
+
+func (s *SQL) Save(ctx context.Context, key int64, data []byte, version int64, ttl time.Duration) (int64, error) {
+	expiresAt := time.Now().Add(ttl).UTC()
+
+	var res sql.Result
+	var err error
+	if version == 0 {
+		res, err = s.db.ExecContext(ctx, `insert into user_states (user_key, data, version, expires_at) values ($1, $2, 1, $3)
+		on conflict (user_key) do nothing`, key, string(data), expiresAt)
+	} else {
+		res, err = s.db.ExecContext(ctx, `update user_states set data = $2, version = version + 1, expires_at = $3
+		where user_key = $1 and version = $4`, key, string(data), expiresAt, version)
+	}
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, ErrConflict
+	}
+	return version + 1, nil
+}
+
+func (s *SQL) Purge(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, "delete from user_states where expires_at < $1", time.Now().UTC())
+	return err
+}
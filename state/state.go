@@ -0,0 +1,26 @@
+// Package state хранит состояние диалога с пользователем (шаг мастера, черновик заметки,
+// страницу списка) между обновлениями и перезапусками бота.
+//
+// Состояние хранится как непрозрачные байты с версией. Save принимает версию, прочитанную
+// через Load, и отклоняет запись, если с тех пор состояние уже изменили (ErrConflict),
+// поэтому два одновременных обновления одного пользователя не затирают друг друга.
+// У каждой записи есть срок жизни: брошенный черновик истекает и читается как пустой.
+package state
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrConflict = errors.New("state: version conflict")
+
+type Store interface {
+	// Load состояние и его версия. Если состояния нет или оно истекло, data пустой,
+	// а версию всё равно нужно передать в Save
+	Load(ctx context.Context, key int64) (data []byte, version int64, err error)
+	// Save записывает состояние, если его версия всё ещё version, и возвращает новую версию
+	Save(ctx context.Context, key int64, data []byte, version int64, ttl time.Duration) (int64, error)
+	// Purge удаляет истёкшие состояния
+	Purge(ctx context.Context) error
+}
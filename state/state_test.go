@@ -0,0 +1,195 @@
+package state_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"github.com/playmixer/bot-note/migrations"
+	"github.com/playmixer/bot-note/state"
+)
+
+// Memory и SQL проходят один набор проверок, SQL - на SQLite и, если задан TEST_POSTGRES_DSN, на Postgres
+
+func TestMemory(t *testing.T) {
+	runStoreSuite(t, state.NewMemory())
+}
+
+func TestSQLite(t *testing.T) {
+	runStoreSuite(t, state.NewSQL(openDB(t, "sqlite", fmt.Sprintf(
+		"file:%s?mode=memory&cache=shared&_pragma=busy_timeout(5000)", t.Name()),
+		migrations.DIALECT_SQLITE)))
+}
+
+func TestPostgres(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	runStoreSuite(t, state.NewSQL(openDB(t, "postgres", dsn, migrations.DIALECT_POSTGRES)))
+}
+
+func openDB(t *testing.T, driver, dsn, dialect string) *sql.DB {
+	t.Helper()
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// keySeq ключи состояний, не пересекающиеся между запусками на одной базе
+var keySeq = time.Now().UnixNano() / 1000
+
+func newKey() int64 {
+	return atomic.AddInt64(&keySeq, 1)
+}
+
+func runStoreSuite(t *testing.T, s state.Store) {
+	t.Run("versions", func(t *testing.T) { testVersions(t, s) })
+	t.Run("concurrent save", func(t *testing.T) { testConcurrentSave(t, s) })
+	t.Run("ttl", func(t *testing.T) { testTTL(t, s) })
+	t.Run("purge", func(t *testing.T) { testPurge(t, s) })
+}
+
+func testVersions(t *testing.T, s state.Store) {
+	ctx := context.Background()
+	key := newKey()
+
+	data, version, err := s.Load(ctx, key)
+	if err != nil || data != nil || version != 0 {
+		t.Fatalf("Load of a new key = %q, %v, %v", data, version, err)
+	}
+	first, err := s.Save(ctx, key, []byte(`{"page":1}`), version, time.Hour)
+	if err != nil || first == version {
+		t.Fatalf("Save = %v, %v", first, err)
+	}
+	// вторая запись нового состояния с той же версией - конфликт
+	if _, err = s.Save(ctx, key, []byte(`{"page":9}`), version, time.Hour); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("Save of a new key twice: %v, want ErrConflict", err)
+	}
+
+	second, err := s.Save(ctx, key, []byte(`{"page":2}`), first, time.Hour)
+	if err != nil || second == first {
+		t.Fatalf("Save = %v, %v", second, err)
+	}
+	// устаревшая версия отклоняется и не затирает состояние
+	if _, err = s.Save(ctx, key, []byte(`{"page":3}`), first, time.Hour); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("Save with a stale version: %v, want ErrConflict", err)
+	}
+	if _, err = s.Save(ctx, key, []byte(`{"page":3}`), second+10, time.Hour); !errors.Is(err, state.ErrConflict) {
+		t.Errorf("Save with a future version: %v, want ErrConflict", err)
+	}
+	data, version, err = s.Load(ctx, key)
+	if err != nil || string(data) != `{"page":2}` || version != second {
+		t.Errorf("Load = %q, %v, %v", data, version, err)
+	}
+
+	// состояния разных ключей независимы
+	other := newKey()
+	if data, version, err = s.Load(ctx, other); err != nil || data != nil || version != 0 {
+		t.Errorf("Load of another key = %q, %v, %v", data, version, err)
+	}
+}
+
+func testConcurrentSave(t *testing.T, s state.Store) {
+	ctx := context.Background()
+	key := newKey()
+	version, err := s.Save(ctx, key, []byte(`{}`), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// из одновременных записей с одной версией проходит ровно одна
+	const writers = 8
+	var wg sync.WaitGroup
+	var saved, conflicts int64
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := s.Save(ctx, key, []byte(fmt.Sprintf(`{"writer":%d}`, i)), version, time.Hour)
+			switch {
+			case err == nil:
+				atomic.AddInt64(&saved, 1)
+			case errors.Is(err, state.ErrConflict):
+				atomic.AddInt64(&conflicts, 1)
+			default:
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if saved != 1 || conflicts != writers-1 {
+		t.Errorf("concurrent Save: %d saved, %d conflicts", saved, conflicts)
+	}
+}
+
+func testTTL(t *testing.T, s state.Store) {
+	ctx := context.Background()
+	key := newKey()
+
+	version, err := s.Save(ctx, key, []byte(`{"draft":"note"}`), 0, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// истёкшее состояние читается пустым, но с версией, иначе его нельзя перезаписать
+	data, loaded, err := s.Load(ctx, key)
+	if err != nil || data != nil || loaded != version {
+		t.Fatalf("Load of an expired state = %q, %v, %v", data, loaded, err)
+	}
+	next, err := s.Save(ctx, key, []byte(`{"page":1}`), loaded, time.Hour)
+	if err != nil {
+		t.Fatalf("Save over an expired state: %v", err)
+	}
+	if data, loaded, err = s.Load(ctx, key); err != nil || string(data) != `{"page":1}` || loaded != next {
+		t.Errorf("Load after Save over an expired state = %q, %v, %v", data, loaded, err)
+	}
+}
+
+func testPurge(t *testing.T, s state.Store) {
+	ctx := context.Background()
+	expired, alive := newKey(), newKey()
+
+	if _, err := s.Save(ctx, expired, []byte(`{"page":1}`), 0, -time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	version, err := s.Save(ctx, alive, []byte(`{"page":2}`), 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Purge(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	data, loaded, err := s.Load(ctx, expired)
+	if err != nil || data != nil || loaded != 0 {
+		t.Errorf("Load of a purged state = %q, %v, %v", data, loaded, err)
+	}
+	// удалённое состояние записывается заново с нулевой версией
+	if _, err = s.Save(ctx, expired, []byte(`{"page":3}`), 0, time.Hour); err != nil {
+		t.Errorf("Save of a purged state: %v", err)
+	}
+	if data, loaded, err = s.Load(ctx, alive); err != nil || !bytes.Equal(data, []byte(`{"page":2}`)) || loaded != version {
+		t.Errorf("Purge removed a live state: %q, %v, %v", data, loaded, err)
+	}
+}
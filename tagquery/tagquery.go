@@ -0,0 +1,361 @@
+// Package tagquery разбирает запросы по тегам с логическими операциями:
+//
+//	#work #go -#archived    заметки с тегами work и go, но без archived
+//	#a | #b                 заметки с тегом a или b
+//	(#a | #b) #c            заметки с тегом c и одним из тегов a, b
+//
+// Теги начинаются с #, перечисленные подряд объединяются через И. Также поддерживаются операторы
+// AND/OR/NOT, И/ИЛИ/НЕ, & и !; оператор без операнда - ошибка. Запрос разбирается в дерево, которое можно
+// вычислить для набора тегов (Eval) или превратить в условие SQL (SQL).
+package tagquery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+const (
+	maxDepth  = 32
+	maxTokens = 100
+)
+
+var ErrSyntax = errors.New("tagquery: syntax error")
+
+type Node interface {
+	String() string
+}
+
+type Tag struct {
+	Name string
+}
+
+type Not struct {
+	Expr Node
+}
+
+type And struct {
+	Exprs []Node
+}
+
+type Or struct {
+	Exprs []Node
+}
+
+func (t Tag) String() string {
+	return "#" + t.Name
+}
+
+func (n Not) String() string {
+	if _, ok := n.Expr.(Tag); ok {
+		return "-" + n.Expr.String()
+	}
+	return "-(" + n.Expr.String() + ")"
+}
+
+func (a And) String() string {
+	parts := make([]string, len(a.Exprs))
+	for i, e := range a.Exprs {
+		parts[i] = e.String()
+		if _, ok := e.(Or); ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (o Or) String() string {
+	parts := make([]string, len(o.Exprs))
+	for i, e := range o.Exprs {
+		parts[i] = e.String()
+	}
+	return strings.Join(parts, " | ")
+}
+
+// IsQuery похож ли текст на запрос по тегам
+func IsQuery(text string) bool {
+	return strings.Contains(text, "#")
+}
+
+// Parse разбирает запрос
+func Parse(query string) (Node, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty query", ErrSyntax)
+	}
+	if len(tokens) > maxTokens {
+		return nil, fmt.Errorf("%w: query is too long", ErrSyntax)
+	}
+
+	p := parser{tokens: tokens}
+	node, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, p.tokens[p.pos].text)
+	}
+	return node, nil
+}
+
+// Tags все теги, упомянутые в запросе, без повторов
+func Tags(node Node) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	var walk func(Node)
+	walk = func(n Node) {
+		switch n := n.(type) {
+		case Tag:
+			if !seen[n.Name] {
+				seen[n.Name] = true
+				tags = append(tags, n.Name)
+			}
+		case Not:
+			walk(n.Expr)
+		case And:
+			for _, e := range n.Exprs {
+				walk(e)
+			}
+		case Or:
+			for _, e := range n.Exprs {
+				walk(e)
+			}
+		}
+	}
+	walk(node)
+	return tags
+}
+
+// Eval вычисляет запрос для заметки, has сообщает, есть ли у заметки тег
+func Eval(node Node, has func(tag string) bool) bool {
+	switch n := node.(type) {
+	case Tag:
+		return has(n.Name) || has("#"+n.Name)
+	case Not:
+		return !Eval(n.Expr, has)
+	case And:
+		for _, e := range n.Exprs {
+			if !Eval(e, has) {
+				return false
+			}
+		}
+		return true
+	case Or:
+		for _, e := range n.Exprs {
+			if Eval(e, has) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// SQL превращает запрос в условие над заметкой notes.id. Значения тегов не подставляются
+// в текст запроса: arg получает значение и возвращает плейсхолдер ($1, ? и т.п.).
+func SQL(node Node, arg func(value any) string) string {
+	switch n := node.(type) {
+	case Tag:
+		return fmt.Sprintf("exists (select 1 from tags_to_note ttn join tags t on t.id = ttn.tag_id"+
+			" where ttn.note_id = notes.id and t.user_id = notes.user_id and t.title in (%s, %s))", arg(n.Name), arg("#"+n.Name))
+	case Not:
+		return "not " + SQL(n.Expr, arg)
+	case And:
+		return joinSQL(n.Exprs, " and ", arg)
+	case Or:
+		return joinSQL(n.Exprs, " or ", arg)
+	}
+	return "false"
+}
+
+func joinSQL(exprs []Node, sep string, arg func(value any) string) string {
+	parts := make([]string, len(exprs))
+	for i, e := range exprs {
+		parts[i] = SQL(e, arg)
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+type tokenKind int
+
+const (
+	tokenTag tokenKind = iota
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenOpen
+	tokenClose
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var keywords = map[string]tokenKind{
+	"and": tokenAnd, "и": tokenAnd,
+	"or": tokenOr, "или": tokenOr,
+	"not": tokenNot, "не": tokenNot,
+}
+
+func isDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("()|&!", r)
+}
+
+func tokenize(query string) ([]token, error) {
+	tokens := []token{}
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			i++
+		case r == '(':
+			tokens = append(tokens, token{tokenOpen, "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{tokenClose, ")"})
+			i++
+		case r == '|':
+			tokens = append(tokens, token{tokenOr, "|"})
+			i++
+		case r == '&':
+			tokens = append(tokens, token{tokenAnd, "&"})
+			i++
+		case r == '!' || (r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1])):
+			tokens = append(tokens, token{tokenNot, string(r)})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !isDelimiter(runes[i]) && runes[i] != ',' {
+				i++
+			}
+			word := string(runes[start:i])
+			if kind, ok := keywords[strings.ToLower(word)]; ok {
+				tokens = append(tokens, token{kind, word})
+				continue
+			}
+			// слово без # - опечатка в запросе, а не тег
+			if !strings.HasPrefix(word, "#") {
+				return nil, fmt.Errorf("%w: %q is not a tag, tags start with #", ErrSyntax, word)
+			}
+			name := strings.TrimPrefix(word, "#")
+			if name == "" {
+				return nil, fmt.Errorf("%w: empty tag", ErrSyntax)
+			}
+			tokens = append(tokens, token{tokenTag, name})
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) or(depth int) (Node, error) {
+	exprs := []Node{}
+	for {
+		node, err := p.and(depth)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, node)
+
+		t, ok := p.peek()
+		if !ok || t.kind != tokenOr {
+			break
+		}
+		p.pos++
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return Or{Exprs: exprs}, nil
+}
+
+func (p *parser) and(depth int) (Node, error) {
+	exprs := []Node{}
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokenOr || t.kind == tokenClose {
+			break
+		}
+		if t.kind == tokenAnd {
+			if len(exprs) == 0 {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.text)
+			}
+			p.pos++
+			// после & нужен операнд: "#a & | #b", "#a & & #b" и "#a &" - ошибки
+			next, ok := p.peek()
+			if !ok {
+				return nil, fmt.Errorf("%w: unexpected end of query", ErrSyntax)
+			}
+			if next.kind != tokenTag && next.kind != tokenNot && next.kind != tokenOpen {
+				return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, next.text)
+			}
+			continue
+		}
+		node, err := p.unary(depth)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, node)
+	}
+
+	switch len(exprs) {
+	case 0:
+		if t, ok := p.peek(); ok {
+			return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.text)
+		}
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrSyntax)
+	case 1:
+		return exprs[0], nil
+	}
+	return And{Exprs: exprs}, nil
+}
+
+func (p *parser) unary(depth int) (Node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("%w: query is too deep", ErrSyntax)
+	}
+	t, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrSyntax)
+	}
+	p.pos++
+
+	switch t.kind {
+	case tokenTag:
+		return Tag{Name: t.text}, nil
+	case tokenNot:
+		node, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Expr: node}, nil
+	case tokenOpen:
+		node, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != tokenClose {
+			return nil, fmt.Errorf("%w: missing )", ErrSyntax)
+		}
+		p.pos++
+		return node, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %q", ErrSyntax, t.text)
+}
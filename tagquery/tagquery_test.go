@@ -0,0 +1,185 @@
+package tagquery
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"#work", "#work"},
+		{"#work #go -#archived", "#work #go -#archived"},
+		{"#a | #b", "#a | #b"},
+		{"(#a | #b) #c", "(#a | #b) #c"},
+		{"#a (#b | #c) | #d", "#a (#b | #c) | #d"},
+		{"#a & #b", "#a #b"},
+		{"#a, #b", "#a #b"},
+		{"#a AND #b OR NOT #c", "#a #b | -#c"},
+		{"#a and #b or not #c", "#a #b | -#c"},
+		{"#a и #b или не #c", "#a #b | -#c"},
+		{"!(#a | #b)", "-(#a | #b)"},
+		{"-(#a #b)", "-(#a #b)"},
+		{"!!#a", "-(-#a)"},
+		{"((#a))", "#a"},
+		{"-#a -#b", "-#a -#b"},
+		{"##go", "##go"},
+		{"#Go #заметки", "#Go #заметки"},
+		{"#a|#b&#c", "#a | #b #c"},
+		{"#and #or", "#and #or"},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.query)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %s", tt.query, err)
+			continue
+		}
+		if got := node.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		// String даёт запрос, который разбирается в то же дерево
+		again, err := Parse(node.String())
+		if err != nil || again.String() != node.String() {
+			t.Errorf("Parse(%q) round trip = %v, %v", node.String(), again, err)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, query := range []string{
+		"",
+		"   ",
+		"#",
+		"#a & | #b",
+		"#a & & #b",
+		"#a and or #b",
+		"#a &",
+		"& #a",
+		"#a |",
+		"| #a",
+		"#a | | #b",
+		"#a | & #b",
+		"(#a",
+		"#a)",
+		"()",
+		"!",
+		"#a !",
+		"work",
+		"#a work",
+		"#a - #b",
+		"#a | not",
+		strings.Repeat("(", maxDepth+2) + "#a" + strings.Repeat(")", maxDepth+2),
+		strings.Repeat("#a ", maxTokens+1),
+	} {
+		if node, err := Parse(query); !errors.Is(err, ErrSyntax) {
+			t.Errorf("Parse(%q) = %v, %v, want ErrSyntax", query, node, err)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	node, err := Parse("(#a | #b) -#a #c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(Tags(node)); got != "[a b c]" {
+		t.Errorf("Tags = %s", got)
+	}
+}
+
+func TestIsQuery(t *testing.T) {
+	for text, want := range map[string]bool{"#go": true, "docker #go": true, "docker": false, "": false} {
+		if got := IsQuery(text); got != want {
+			t.Errorf("IsQuery(%q) = %v", text, got)
+		}
+	}
+}
+
+func TestEval(t *testing.T) {
+	// теги из хештегов хранятся вместе с #
+	tags := map[string]bool{"go": true, "#work": true}
+	has := func(tag string) bool { return tags[tag] }
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"#go", true},
+		{"#work", true},
+		{"#a", false},
+		{"#go #work", true},
+		{"#go -#work", false},
+		{"#go #a", false},
+		{"#a | #go", true},
+		{"#a | #b", false},
+		{"-(#a | #b)", true},
+		{"(#a | #go) #work", true},
+		{"(#a | #b) #work", false},
+		{"!!#go", true},
+		{"-#a -#b", true},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Eval(node, has); got != tt.want {
+			t.Errorf("Eval(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// tagSQL условие SQL для одного тега с плейсхолдерами a и b
+func tagSQL(a, b string) string {
+	return "exists (select 1 from tags_to_note ttn join tags t on t.id = ttn.tag_id" +
+		" where ttn.note_id = notes.id and t.user_id = notes.user_id and t.title in (" + a + ", " + b + "))"
+}
+
+func TestSQL(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		args  []any
+	}{
+		{"#a", tagSQL("$2", "$3"), []any{"a", "#a"}},
+		{"-#a", "not " + tagSQL("$2", "$3"), []any{"a", "#a"}},
+		{"#a #b", "(" + tagSQL("$2", "$3") + " and " + tagSQL("$4", "$5") + ")", []any{"a", "#a", "b", "#b"}},
+		{"(#a | #b) -#c",
+			"((" + tagSQL("$2", "$3") + " or " + tagSQL("$4", "$5") + ") and not " + tagSQL("$6", "$7") + ")",
+			[]any{"a", "#a", "b", "#b", "c", "#c"}},
+		// значения тегов не попадают в текст запроса
+		{"#o'neil", tagSQL("$2", "$3"), []any{"o'neil", "#o'neil"}},
+	}
+	for _, tt := range tests {
+		node, err := Parse(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// первый аргумент, как в хранилище, - id пользователя
+		args := []any{int64(1)}
+		got := SQL(node, func(value any) string {
+			args = append(args, value)
+			return fmt.Sprintf("$%d", len(args))
+		})
+		if got != tt.want {
+			t.Errorf("SQL(%q) =\n%s\nwant\n%s", tt.query, got, tt.want)
+		}
+		if fmt.Sprint(args[1:]) != fmt.Sprint(tt.args) {
+			t.Errorf("SQL(%q) args = %v, want %v", tt.query, args[1:], tt.args)
+		}
+	}
+
+	// плейсхолдеры SQLite без номеров
+	node, err := Parse("#a | #b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := SQL(node, func(any) string { return "?" })
+	if want := "(" + tagSQL("?", "?") + " or " + tagSQL("?", "?") + ")"; got != want {
+		t.Errorf("SQL with ? = %s", got)
+	}
+}
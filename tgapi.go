@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/playmixer/bot-note/models"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+const MEDIA_GROUP_SIZE = 10 // больше файлов в одном альбоме Telegram не принимает
+
+// callApi вызывает метод Bot API, которого нет в tg, параметры передаются в теле запроса JSON
+func callApi(ctx context.Context, bot *tg.TelegramBot, method string, params any) error {
+	return callApiResult(ctx, bot, method, params, nil)
+}
+
+// callApiResult как callApi, но result метода разбирается в out, если out не nil
+func callApiResult(ctx context.Context, bot *tg.TelegramBot, method string, params, out any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, string(bot.GetApiUrl(method)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doApi(req, method, out)
+}
+
+// callApiMultipart вызывает метод Bot API с загрузкой файлов: files - пути к файлам по имени параметра
+func callApiMultipart(ctx context.Context, bot *tg.TelegramBot, method string, fields, files map[string]string, out any) error {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for name, value := range fields {
+		if err := form.WriteField(name, value); err != nil {
+			return err
+		}
+	}
+	for name, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		part, err := form.CreateFormFile(name, filepath.Base(path))
+		if err != nil {
+			return err
+		}
+		if _, err = part.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, string(bot.GetApiUrl(method)), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	return doApi(req, method, out)
+}
+
+// apiError ошибка, которую вернул Bot API
+type apiError struct {
+	Method      string
+	Code        int
+	Description string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("telegram %s: %d %s", e.Method, e.Code, e.Description)
+}
+
+// doApi выполняет запрос к Bot API и разбирает result в out, если out не nil
+func doApi(req *http.Request, method string, out any) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result := struct {
+		Ok          bool            `json:"ok"`
+		ErrorCode   int             `json:"error_code"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}{}
+	if err = json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	if !result.Ok {
+		return &apiError{Method: method, Code: result.ErrorCode, Description: result.Description}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Result, out)
+}
+
+type inputMedia struct {
+	Type  string `json:"type"`
+	Media string `json:"media"`
+}
+
+// sendAttachments отправляет вложения заметки: фото, документы и аудио альбомами,
+// голосовые сообщения по одному, их нельзя объединять в альбом
+func sendAttachments(ctx context.Context, bot *tg.TelegramBot, chatId int64, attachments []models.Attachment) error {
+	groups := map[models.AttachmentKind][]string{}
+	for _, attachment := range attachments {
+		groups[attachment.Kind] = append(groups[attachment.Kind], attachment.FileId)
+	}
+
+	for _, kind := range []models.AttachmentKind{models.ATTACHMENT_PHOTO, models.ATTACHMENT_DOCUMENT, models.ATTACHMENT_AUDIO} {
+		files := groups[kind]
+		for len(files) > 0 {
+			n := len(files)
+			if n > MEDIA_GROUP_SIZE {
+				n = MEDIA_GROUP_SIZE
+			}
+			if err := sendMediaGroup(ctx, bot, chatId, kind, files[:n]); err != nil {
+				return err
+			}
+			files = files[n:]
+		}
+	}
+	for _, fileId := range groups[models.ATTACHMENT_VOICE] {
+		err := callApi(ctx, bot, "sendVoice", map[string]any{"chat_id": chatId, "voice": fileId})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendMediaGroup альбом из файлов одного вида, один файл отправляется обычным сообщением
+func sendMediaGroup(ctx context.Context, bot *tg.TelegramBot, chatId int64, kind models.AttachmentKind, files []string) error {
+	if len(files) == 1 {
+		method := map[models.AttachmentKind]string{
+			models.ATTACHMENT_PHOTO:    "sendPhoto",
+			models.ATTACHMENT_DOCUMENT: "sendDocument",
+			models.ATTACHMENT_AUDIO:    "sendAudio",
+		}[kind]
+		return callApi(ctx, bot, method, map[string]any{"chat_id": chatId, string(kind): files[0]})
+	}
+
+	media := make([]inputMedia, len(files))
+	for i, fileId := range files {
+		media[i] = inputMedia{Type: string(kind), Media: fileId}
+	}
+	return callApi(ctx, bot, "sendMediaGroup", map[string]any{"chat_id": chatId, "media": media})
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/playmixer/bot-note/models"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+const (
+	MODE_WEBHOOK     = "webhook" // Telegram присылает обновления на ADDR, нужен публичный HTTPS
+	MODE_POLLING     = "polling" // бот сам забирает обновления, удобно для локальной разработки
+	POLLING_TIMEOUT  = time.Second * 30
+	POLLING_RETRY    = time.Second * 5
+	SHUTDOWN_TIMEOUT = time.Second * 30 // сколько ждать недоработавшие обработчики при остановке
+)
+
+// poll забирает обновления через getUpdates, пока не отменён ctx.
+// Вебхук при этом снимается, иначе Telegram не отдаёт обновления
+func poll(ctx context.Context, bot *tg.TelegramBot) error {
+	if err := callApi(ctx, bot, "deleteWebhook", map[string]any{}); err != nil {
+		return err
+	}
+
+	var offset int64
+	for {
+		updates := []json.RawMessage{}
+		err := callApiResult(ctx, bot, "getUpdates", map[string]any{
+			"offset":  offset,
+			"timeout": int(POLLING_TIMEOUT.Seconds()),
+		}, &updates)
+		if ctx.Err() != nil {
+			confirmUpdates(bot, offset)
+			return nil
+		}
+		if err != nil {
+			log.ERROR(fmt.Sprintf("polling error: %s", err))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(POLLING_RETRY):
+			}
+			continue
+		}
+
+		for _, body := range updates {
+			head := struct {
+				UpdateId int64 `json:"update_id"`
+			}{}
+			if err = json.Unmarshal(body, &head); err != nil {
+				log.ERROR(fmt.Sprintf("polling update_id decode error: %s", err))
+				continue
+			}
+			offset = head.UpdateId + 1
+			if err = dispatch(body, bot); err != nil {
+				log.ERROR(fmt.Sprintf("polling update %v dispatch error: %s", head.UpdateId, err))
+			}
+		}
+	}
+}
+
+// confirmUpdates сообщает Telegram, что обновления до offset получены,
+// иначе после перезапуска они придут ещё раз
+func confirmUpdates(bot *tg.TelegramBot, offset int64) {
+	if offset == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := callApi(ctx, bot, "getUpdates", map[string]any{"offset": offset, "timeout": 0, "limit": 1})
+	if err != nil {
+		log.ERROR(fmt.Sprintf("confirm updates error: %s", err))
+	}
+}
+
+// shutdown дожидается обработчиков и фоновых задач, затем закрывает базу.
+// Состояние пользователей сохраняют сами обработчики, поэтому после них оно уже записано
+func shutdown(jobs *sync.WaitGroup) {
+	log.INFO("Stopping...")
+	if !wait(&inflight, SHUTDOWN_TIMEOUT) {
+		log.WARN("in-flight updates did not finish in time, their state may be lost")
+	}
+	if !wait(jobs, SHUTDOWN_TIMEOUT) {
+		log.WARN("background jobs did not finish in time")
+	}
+	if models.DB != nil {
+		if err := models.DB.Close(); err != nil {
+			log.ERROR(fmt.Sprintf("close database error: %s", err))
+		}
+	}
+}
+
+// wait ждёт wg не дольше timeout, false - не дождался
+func wait(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	TRASH_PURGE_INTERVAL = time.Hour
+	TRASH_RETENTION_DAYS = 30     // сколько дней заметка лежит в корзине, если не задан TRASH_RETENTION_DAYS
+	TRASH_LIST_ARG       = "list" // действие нажато в списке корзины, после него список перерисовывается
+	DELETE_CONFIRM_ARG   = "yes"
+	DELETE_CANCEL_ARG    = "no"
+)
+
+// trashRetention сколько дней заметки лежат в корзине, задаётся при запуске
+var trashRetention = TRASH_RETENTION_DAYS
+
+// trashRetentionDays срок хранения заметок в корзине из переменной окружения TRASH_RETENTION_DAYS
+func trashRetentionDays() int {
+	value := os.Getenv("TRASH_RETENTION_DAYS")
+	if value == "" {
+		return TRASH_RETENTION_DAYS
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 1 {
+		log.WARN(fmt.Sprintf("bad TRASH_RETENTION_DAYS %q, using %d", value, TRASH_RETENTION_DAYS))
+		return TRASH_RETENTION_DAYS
+	}
+	return days
+}
+
+// runTrashPurge периодически удаляет навсегда заметки, которые лежат в корзине дольше retention
+func runTrashPurge(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purgeTrash(ctx, retention)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func purgeTrash(ctx context.Context, retention time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	defer cancel()
+
+	n, err := storage.PurgeTrash(ctx, time.Now().Add(-retention))
+	if err != nil {
+		log.ERROR(fmt.Sprintf("purge trash error: %s", err))
+		return
+	}
+	if n > 0 {
+		log.INFO(fmt.Sprintf("%d notes purged from trash", n))
+	}
+}
@@ -1,22 +1,36 @@
 package main
 
-import "sync"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/state"
+	"github.com/playmixer/bot-note/wizard"
+)
+
+const (
+	USER_STATE_TTL       = time.Hour * 24 * 7 // через сколько забывается брошенный диалог
+	STATE_PURGE_INTERVAL = time.Hour
+	STATE_SAVE_ATTEMPTS  = 3 // сколько раз пробовать сохранить состояние, которое меняют одновременно
+)
 
 type UserStatus uint
 
 const (
-	USER_STATUS_NONE            UserStatus = iota // Без статуса
-	USER_STATUS_NEW                               // Добавить заметку (ввести название)
-	USER_STATUS_NEW_URL                           // добавить урл для заметки
-	USER_STATUS_NEW_DESCRIPTION                   // добавить описание для заметки
-	USER_STATUS_NEW_TAGS                          // добавить теги для заметки
+	USER_STATUS_NONE   UserStatus = iota // Без статуса
+	USER_STATUS_WIZARD                   // Заполняет пошаговый диалог, шаг хранится в User.Wizard
 
 	USER_STATUS_DEL UserStatus = iota + 100 //удалить заметку
 
-	USER_STATUS_EDIT             UserStatus = iota + 200 //редактировать заметку
-	USER_STATUS_EDIT_URL                                 //редактировать ссылку
-	USER_STATUS_EDIT_DESCRIPTION                         //редактировать описание
-	USER_STATUS_EDIT_TAGS                                //редактировать теги
+	USER_STATUS_REMIND UserStatus = iota + 300 //установить напоминание для заметки
+
+	USER_STATUS_SETTINGS_TIMEZONE UserStatus = iota + 400 //ввести часовой пояс
 )
 
 type Note struct {
@@ -25,15 +39,101 @@ type Note struct {
 	URL         string
 	Description string
 	Tags        []string
+	Items       []string // новые пункты списка дел
 }
 
 type User struct {
 	Id            int64
 	Status        UserStatus
+	Wizard        wizard.State
 	Note          Note
 	LastMessageId int64
 	NotePage      uint
 	SearchTag     string
+	ShowRoute     string // из какого списка открыта карточка заметки
+	SelectedTags  []string
+	SearchQuery   string
+	RemindNoteId  int64
+	Settings      models.UserSettings
+
+	version int64  // версия состояния в UserStore
+	loaded  []byte // состояние, каким его прочитал UserStore, от него считаются изменения при конфликте
+	tgId    int64  // id пользователя Telegram, ключ состояния в UserStore
+}
+
+// Location часовой пояс, в котором пользователь вводит и видит время
+func (u *User) Location() *time.Location {
+	return LoadLocation(u.Settings.Timezone)
+}
+
+// IsTagSelected отмечен ли тег в /tags
+func (u *User) IsTagSelected(tag string) bool {
+	for _, t := range u.SelectedTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ToggleTag отмечает тег в /tags или снимает отметку
+func (u *User) ToggleTag(tag string) {
+	for i, t := range u.SelectedTags {
+		if t == tag {
+			u.SelectedTags = append(u.SelectedTags[:i:i], u.SelectedTags[i+1:]...)
+			return
+		}
+	}
+	u.SelectedTags = append(u.SelectedTags, tag)
+}
+
+// ShowRouteOrDefault маршрут, которым открыта карточка заметки, по умолчанию общий список
+func (u *User) ShowRouteOrDefault() string {
+	switch u.ShowRoute {
+	case CB_ROUTE_SHOW, CB_ROUTE_TAG_SHOW, CB_ROUTE_SEARCH_SHOW:
+		return u.ShowRoute
+	}
+	// пусто или маршрут из состояния, сохранённого до смены формата кнопок
+	return CB_ROUTE_SHOW
+}
+
+// Callback данные кнопки маршрута route, подписанные для этого пользователя.
+// Аргументы кнопок - id и константы, TestCallbackRoutes проверяет, что они помещаются.
+// Если данные всё же не поместились, ошибка пишется в лог, а кнопка открывает список заметок:
+// с пустыми данными Telegram отклонил бы всё сообщение
+func (u *User) Callback(route string, args ...any) string {
+	data, err := signer.Encode(u.tgId, route, args...)
+	if err == nil {
+		return data
+	}
+	log.ERROR(fmt.Sprintf("%v callback %q %v: %s", u.tgId, route, args, err))
+	data, _ = signer.Encode(u.tgId, CB_ROUTE_LIST_ALL)
+	return data
+}
+
+// PageSize количество заметок на странице списка
+func (u *User) PageSize() int {
+	if u.Settings.PageSize <= 0 {
+		return LIST_PAGE_SIZE
+	}
+	return u.Settings.PageSize
+}
+
+// T перевод строки интерфейса на язык пользователя
+func (u *User) T(text string) string {
+	return Translate(u.Settings.Language, text)
+}
+
+// LoadLocation часовой пояс по IANA имени, для пустого или неизвестного имени - пояс сервера
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+	return loc
 }
 
 func (u *User) Add(name string) {
@@ -57,22 +157,128 @@ func (u *User) SaveNote() error {
 	return nil
 }
 
+// UserStore состояние диалога пользователей поверх state.Store
 type UserStore struct {
-	data map[int64]User
-	mu   sync.Mutex
+	states state.Store
+	ttl    time.Duration
 }
 
+func NewUserStore(states state.Store, ttl time.Duration) *UserStore {
+	return &UserStore{states: states, ttl: ttl}
+}
+
+// Get состояние пользователя, при ошибке или истёкшем состоянии - пустой User
 func (s *UserStore) Get(key int64) User {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	if _, ok := s.data[key]; ok {
-		return s.data[key]
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	data, version, err := s.states.Load(ctx, key)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("load state %v error: %s", key, err))
+		return User{tgId: key}
+	}
+	user := User{}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &user); err != nil {
+			log.ERROR(fmt.Sprintf("decode state %v error: %s", key, err))
+			user = User{}
+		}
+	}
+	user.version = version
+	user.loaded = data
+	user.tgId = key
+	return user
+}
+
+// Set сохраняет состояние. Если его успели изменить после Get, состояние читается заново
+// и изменения value переносятся на него, пока не получится записать или не кончатся попытки.
+// Если одно и то же поле поменяли оба обновления, изменения value не сохраняются - state.ErrConflict
+func (s *UserStore) Set(key int64, value User) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	changed, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode state %v: %w", key, err)
+	}
+	data, version := changed, value.version
+	base := value.loaded
+	if len(base) == 0 {
+		// состояния не было или оно истекло: Get вернул пустого User
+		if base, err = json.Marshal(User{}); err != nil {
+			return fmt.Errorf("encode state %v: %w", key, err)
+		}
 	}
-	return User{}
+	for attempt := 1; ; attempt++ {
+		_, err = s.states.Save(ctx, key, data, version, s.ttl)
+		if !errors.Is(err, state.ErrConflict) || attempt == STATE_SAVE_ATTEMPTS {
+			break
+		}
+		log.WARN(fmt.Sprintf("state %v was changed concurrently, merging, attempt %d", key, attempt))
+
+		var current []byte
+		current, version, err = s.states.Load(ctx, key)
+		if err != nil {
+			break
+		}
+		// каждый раз переносятся только свои изменения: current уже содержит чужие
+		if data, err = mergeState(base, changed, current); err != nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("save state %v: %w", key, err)
+	}
+	return nil
 }
 
-func (s *UserStore) Set(key int64, value User) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	s.data[key] = value
+// mergeState переносит изменения состояния с loaded на changed в current, который успели записать
+// другие обновления. Сравниваются поля User верхнего уровня
+func mergeState(loaded, changed, current []byte) ([]byte, error) {
+	base, mine, theirs := map[string]any{}, map[string]any{}, map[string]any{}
+	for _, v := range []struct {
+		data []byte
+		into *map[string]any
+	}{{loaded, &base}, {changed, &mine}, {current, &theirs}} {
+		if len(v.data) == 0 {
+			continue
+		}
+		decoder := json.NewDecoder(bytes.NewReader(v.data))
+		decoder.UseNumber()
+		if err := decoder.Decode(v.into); err != nil {
+			return nil, err
+		}
+	}
+
+	for field, value := range mine {
+		if reflect.DeepEqual(value, base[field]) {
+			continue
+		}
+		if other, ok := theirs[field]; ok && !reflect.DeepEqual(other, base[field]) && !reflect.DeepEqual(other, value) {
+			return nil, fmt.Errorf("%w: field %s", state.ErrConflict, field)
+		}
+		theirs[field] = value
+	}
+	return json.Marshal(theirs)
+}
+
+func (s *UserStore) Purge(ctx context.Context) error {
+	return s.states.Purge(ctx)
+}
+
+// runStatePurge периодически удаляет истёкшие состояния
+func runStatePurge(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := store.Purge(ctx); err != nil {
+			log.ERROR(fmt.Sprintf("purge states error: %s", err))
+		}
+	}
 }
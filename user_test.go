@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/playmixer/bot-note/state"
+	"github.com/playmixer/corvid/logger"
+)
+
+func TestMergeState(t *testing.T) {
+	tests := []struct {
+		name                 string
+		loaded, mine, theirs string
+		want                 string
+	}{
+		{"disjoint fields", `{"A":1,"B":1}`, `{"A":2,"B":1}`, `{"A":1,"B":3}`, `{"A":2,"B":3}`},
+		{"same change", `{"A":1}`, `{"A":2}`, `{"A":2}`, `{"A":2}`},
+		{"nothing changed", `{"A":1,"B":1}`, `{"A":1,"B":1}`, `{"A":1,"B":5}`, `{"A":1,"B":5}`},
+		{"nested field", `{"Note":{"Name":"a"},"P":1}`, `{"Note":{"Name":"b"},"P":1}`, `{"Note":{"Name":"a"},"P":2}`, `{"Note":{"Name":"b"},"P":2}`},
+		{"field only in theirs", `{"A":1}`, `{"A":2}`, `{"A":1,"C":7}`, `{"A":2,"C":7}`},
+		{"large numbers", `{"Id":9007199254740993}`, `{"Id":9007199254740995}`, `{"Id":9007199254740993}`, `{"Id":9007199254740995}`},
+	}
+	for _, tt := range tests {
+		got, err := mergeState([]byte(tt.loaded), []byte(tt.mine), []byte(tt.theirs))
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: mergeState = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	for name, theirs := range map[string]string{
+		"same field":        `{"A":3,"B":1}`,
+		"same nested field": `{"A":1,"B":1,"Note":{"Name":"c"}}`,
+	} {
+		_, err := mergeState([]byte(`{"A":1,"B":1,"Note":{"Name":"a"}}`), []byte(`{"A":2,"B":1,"Note":{"Name":"b"}}`), []byte(theirs))
+		if !errors.Is(err, state.ErrConflict) {
+			t.Errorf("%s: mergeState error = %v, want state.ErrConflict", name, err)
+		}
+	}
+}
+
+// sneakyStore записывает чужое изменение при первом чтении, как обновление, пришедшее между попытками Set
+type sneakyStore struct {
+	state.Store
+	sneak func()
+}
+
+func (s *sneakyStore) Load(ctx context.Context, key int64) ([]byte, int64, error) {
+	if s.sneak != nil {
+		sneak := s.sneak
+		s.sneak = nil
+		sneak()
+	}
+	return s.Store.Load(ctx, key)
+}
+
+func TestUserStoreSet(t *testing.T) {
+	log = logger.New("test")
+	const key = 1001
+
+	t.Run("disjoint changes are merged", func(t *testing.T) {
+		s := NewUserStore(state.NewMemory(), time.Hour)
+		a, b := s.Get(key), s.Get(key)
+		b.NotePage = 3
+		if err := s.Set(key, b); err != nil {
+			t.Fatal(err)
+		}
+		a.SearchQuery = "go"
+		if err := s.Set(key, a); err != nil {
+			t.Fatalf("Set with a disjoint change: %s", err)
+		}
+		if got := s.Get(key); got.NotePage != 3 || got.SearchQuery != "go" {
+			t.Errorf("state = page %d, query %q", got.NotePage, got.SearchQuery)
+		}
+	})
+
+	t.Run("same field conflicts", func(t *testing.T) {
+		s := NewUserStore(state.NewMemory(), time.Hour)
+		a, b := s.Get(key), s.Get(key)
+		b.NotePage = 7
+		if err := s.Set(key, b); err != nil {
+			t.Fatal(err)
+		}
+		a.NotePage = 5
+		if err := s.Set(key, a); !errors.Is(err, state.ErrConflict) {
+			t.Fatalf("Set of the same field: %v, want state.ErrConflict", err)
+		}
+		if got := s.Get(key); got.NotePage != 7 {
+			t.Errorf("conflicting Set overwrote the state: page %d", got.NotePage)
+		}
+	})
+
+	t.Run("change between attempts", func(t *testing.T) {
+		store := &sneakyStore{Store: state.NewMemory()}
+		s := NewUserStore(store, time.Hour)
+		a, b := s.Get(key), s.Get(key)
+		b.NotePage = 3
+		if err := s.Set(key, b); err != nil {
+			t.Fatal(err)
+		}
+		// пока a сливает изменения, третье обновление ещё раз меняет страницу
+		store.sneak = func() {
+			c := s.Get(key)
+			c.NotePage = 4
+			if err := s.Set(key, c); err != nil {
+				t.Error(err)
+			}
+		}
+		a.SearchQuery = "go"
+		if err := s.Set(key, a); err != nil {
+			t.Fatalf("Set after two concurrent changes: %s", err)
+		}
+		if got := s.Get(key); got.NotePage != 4 || got.SearchQuery != "go" {
+			t.Errorf("state = page %d, query %q", got.NotePage, got.SearchQuery)
+		}
+	})
+
+	t.Run("expired state", func(t *testing.T) {
+		s := NewUserStore(state.NewMemory(), -time.Minute)
+		a := s.Get(key)
+		a.NotePage = 2
+		if err := s.Set(key, a); err != nil {
+			t.Fatal(err)
+		}
+		// состояние истекло: оба обновления начинают с пустого User и меняют разные поля
+		b, c := s.Get(key), s.Get(key)
+		b.SearchQuery = "go"
+		c.SearchTag = "work"
+		if err := s.Set(key, b); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Set(key, c); err != nil {
+			t.Fatalf("Set over an expired state: %s", err)
+		}
+		data, _, err := s.states.Load(context.Background(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != nil {
+			t.Errorf("expired state is loaded: %s", data)
+		}
+	})
+}
+
+func TestUserStoreSetMergedState(t *testing.T) {
+	log = logger.New("test")
+	const key = 1002
+
+	s := NewUserStore(state.NewMemory(), time.Hour)
+	a, b := s.Get(key), s.Get(key)
+	b.SearchTag = "work"
+	if err := s.Set(key, b); err != nil {
+		t.Fatal(err)
+	}
+	a.SearchQuery = "go"
+	if err := s.Set(key, a); err != nil {
+		t.Fatal(err)
+	}
+	// после слияния записан полный User, а не только изменённые поля
+	data, _, err := s.states.Load(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{}
+	if err = json.Unmarshal(data, &user); err != nil {
+		t.Fatal(err)
+	}
+	if user.SearchTag != "work" || user.SearchQuery != "go" {
+		t.Errorf("merged state = %s", data)
+	}
+}
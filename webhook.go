@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+const (
+	WEBHOOK_SECRET_HEADER  = "X-Telegram-Bot-Api-Secret-Token"
+	WEBHOOK_CHECK_INTERVAL = time.Minute * 10
+)
+
+// WEBHOOK_ALLOWED_UPDATES обновления, которые обрабатывает бот, остальные Telegram не присылает
+var WEBHOOK_ALLOWED_UPDATES = []string{"message", "callback_query"}
+
+// webhookSecretRe символы, которые Telegram допускает в secret_token
+var webhookSecretRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// webhookConfig настройки вебхука из переменных окружения
+type webhookConfig struct {
+	Addr   string // ADDR, адрес, который слушает сервер
+	Route  string // ROUTE, путь, на который Telegram присылает обновления
+	URL    string // WEBHOOK_URL, публичный адрес вебхука, пустой - вебхук регистрируют вручную
+	Secret string // WEBHOOK_SECRET, Telegram передаёт его в каждом запросе заголовком
+	Cert   string // WEBHOOK_CERT, самоподписанный сертификат, загружается в Telegram
+	Key    string // WEBHOOK_KEY, ключ сертификата, с ним сервер сам принимает HTTPS
+}
+
+func webhookConfigFromEnv() (webhookConfig, error) {
+	cfg := webhookConfig{
+		Addr:   os.Getenv("ADDR"),
+		Route:  os.Getenv("ROUTE"),
+		URL:    os.Getenv("WEBHOOK_URL"),
+		Secret: os.Getenv("WEBHOOK_SECRET"),
+		Cert:   os.Getenv("WEBHOOK_CERT"),
+		Key:    os.Getenv("WEBHOOK_KEY"),
+	}
+	if cfg.Route == "" {
+		cfg.Route = "/"
+	}
+	if !strings.HasPrefix(cfg.Route, "/") {
+		cfg.Route = "/" + cfg.Route
+	}
+	switch {
+	case cfg.Secret == "" && cfg.URL != "":
+		// вебхук регистрирует сам бот, поэтому без WEBHOOK_SECRET он передаёт Telegram случайный секрет
+		secret, err := newWebhookSecret()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Secret = secret
+		log.INFO("WEBHOOK_SECRET is not set, a random secret is registered with the webhook")
+	case cfg.Secret == "":
+		log.WARN("WEBHOOK_SECRET is not set, webhook requests are not verified")
+	case !webhookSecretRe.MatchString(cfg.Secret):
+		return cfg, errors.New("WEBHOOK_SECRET must be 1-256 characters A-Z, a-z, 0-9, _ or -")
+	}
+	if cfg.Key != "" && cfg.Cert == "" {
+		return cfg, errors.New("WEBHOOK_KEY is set without WEBHOOK_CERT")
+	}
+	return cfg, nil
+}
+
+// newWebhookSecret случайный секрет из символов, допустимых в secret_token
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// runWebhook регистрирует вебхук, если задан WEBHOOK_URL, и принимает обновления, пока не отменён ctx
+func runWebhook(ctx context.Context, bot *tg.TelegramBot) error {
+	cfg, err := webhookConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if cfg.URL != "" {
+		if err = setWebhook(ctx, bot, cfg); err != nil {
+			return err
+		}
+		log.INFO(fmt.Sprintf("webhook registered at %s", cfg.URL))
+		go watchWebhook(ctx, bot, WEBHOOK_CHECK_INTERVAL)
+	}
+	return serveWebhook(ctx, cfg, bot)
+}
+
+// setWebhook регистрирует вебхук в Telegram вместе с секретом и сертификатом
+func setWebhook(ctx context.Context, bot *tg.TelegramBot, cfg webhookConfig) error {
+	allowed, err := json.Marshal(WEBHOOK_ALLOWED_UPDATES)
+	if err != nil {
+		return err
+	}
+	fields := map[string]string{
+		"url":             cfg.URL,
+		"allowed_updates": string(allowed),
+	}
+	if cfg.Secret != "" {
+		fields["secret_token"] = cfg.Secret
+	}
+	files := map[string]string{}
+	if cfg.Cert != "" {
+		files["certificate"] = cfg.Cert
+	}
+	return callApiMultipart(ctx, bot, "setWebhook", fields, files, nil)
+}
+
+// webhookInfo ответ getWebhookInfo, только нужные поля
+type webhookInfo struct {
+	URL                string `json:"url"`
+	PendingUpdateCount int    `json:"pending_update_count"`
+	LastErrorDate      int64  `json:"last_error_date"`
+	LastErrorMessage   string `json:"last_error_message"`
+}
+
+// watchWebhook периодически запрашивает getWebhookInfo и пишет в лог новые ошибки доставки обновлений
+func watchWebhook(ctx context.Context, bot *tg.TelegramBot, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var reported int64
+	for {
+		info := webhookInfo{}
+		err := callApiResult(ctx, bot, "getWebhookInfo", map[string]any{}, &info)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.ERROR(fmt.Sprintf("get webhook info error: %s", err))
+		case info.LastErrorDate > reported:
+			reported = info.LastErrorDate
+			log.ERROR(fmt.Sprintf("webhook error at %s: %s, pending updates %d",
+				time.Unix(info.LastErrorDate, 0).Format(time.RFC3339), info.LastErrorMessage, info.PendingUpdateCount))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// serveWebhook принимает обновления от Telegram, пока не отменён ctx. В отличие от bot.WebhookServer
+// сохраняет поля сообщения, которых нет в tg.Message (пересылка, сущности, подпись)
+func serveWebhook(ctx context.Context, cfg webhookConfig, bot *tg.TelegramBot) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(cfg.Route, func(w http.ResponseWriter, r *http.Request) {
+		if !validWebhookSecret(r, cfg.Secret) {
+			log.WARN(fmt.Sprintf("webhook request from %s rejected: bad secret token", r.RemoteAddr))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			log.ERROR("webhook read error:", err.Error())
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = dispatch(body, bot)
+		if err != nil {
+			log.ERROR("webhook dispatch error:", err.Error())
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	srv := &http.Server{Addr: cfg.Addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		if cfg.Key != "" {
+			errc <- srv.ListenAndServeTLS(cfg.Cert, cfg.Key)
+			return
+		}
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	// новые обновления больше не принимаются, уже принятые дорабатывают в inflight
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
+}
+
+// validWebhookSecret запрос пришёл от Telegram: заголовок совпадает с WEBHOOK_SECRET.
+// Без секрета проверять нечего
+func validWebhookSecret(r *http.Request, secret string) bool {
+	if secret == "" {
+		return true
+	}
+	token := r.Header.Get(WEBHOOK_SECRET_HEADER)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
+}
+
+// inflight обновления, которые ещё обрабатываются, при остановке бот ждёт их
+var inflight sync.WaitGroup
+
+// dispatch разбирает обновление и запускает все обработчики бота, как bot.WebhookServer.
+// Разобранное sharedMessage доступно обработчикам, пока они не завершатся
+func dispatch(body []byte, bot *tg.TelegramBot) error {
+	update := tg.UpdateResult{}
+	if err := json.Unmarshal(body, &update); err != nil {
+		return err
+	}
+	raw := struct {
+		Message sharedMessage `json:"message"`
+	}{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+
+	sharedMessages.Store(update.UpdateId, raw.Message)
+	inflight.Add(1)
+	go func() {
+		defer inflight.Done()
+		defer sharedMessages.Delete(update.UpdateId)
+		wg := sync.WaitGroup{}
+		for _, route := range bot.Routes {
+			wg.Add(1)
+			go func(route tg.Handle) {
+				defer wg.Done()
+				route(update, bot)
+			}(route)
+		}
+		wg.Wait()
+	}()
+	return nil
+}
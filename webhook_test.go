@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/playmixer/corvid/logger"
+)
+
+func TestWebhookConfigSecret(t *testing.T) {
+	log = logger.New("test")
+
+	t.Setenv("WEBHOOK_URL", "https://example.com/bot-note")
+	t.Setenv("WEBHOOK_SECRET", "")
+	first, err := webhookConfigFromEnv()
+	if err != nil || !webhookSecretRe.MatchString(first.Secret) {
+		t.Fatalf("generated secret = %q, %v", first.Secret, err)
+	}
+	second, err := webhookConfigFromEnv()
+	if err != nil || second.Secret == first.Secret {
+		t.Errorf("second generated secret = %q, %v", second.Secret, err)
+	}
+
+	t.Setenv("WEBHOOK_SECRET", "my_secret-1")
+	if cfg, err := webhookConfigFromEnv(); err != nil || cfg.Secret != "my_secret-1" {
+		t.Errorf("WEBHOOK_SECRET = %q, %v", cfg.Secret, err)
+	}
+	t.Setenv("WEBHOOK_SECRET", "not a valid secret!")
+	if _, err := webhookConfigFromEnv(); err == nil {
+		t.Error("invalid WEBHOOK_SECRET accepted")
+	}
+
+	// вебхук регистрируют вручную: секрет не придумывается
+	t.Setenv("WEBHOOK_URL", "")
+	t.Setenv("WEBHOOK_SECRET", "")
+	if cfg, err := webhookConfigFromEnv(); err != nil || cfg.Secret != "" {
+		t.Errorf("secret without WEBHOOK_URL = %q, %v", cfg.Secret, err)
+	}
+}
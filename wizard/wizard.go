@@ -0,0 +1,160 @@
+// Package wizard описывает пошаговые диалоги (мастера) декларативно: мастер - это список
+// шагов с подсказкой и проверкой ввода и действие, которое выполняется после последнего шага.
+//
+// Сам мастер не хранит состояние пользователя. Позиция пользователя в мастере (State)
+// сохраняется вместе с остальным состоянием диалога, а данные, которые заполняют шаги,
+// передаются в каждый вызов. Отправкой сообщений и кнопками занимается вызывающий код.
+package wizard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrNotActive = errors.New("wizard: not active")
+	ErrRequired  = errors.New("wizard: step can't be skipped")
+	ErrNoStep    = errors.New("wizard: unknown step")
+)
+
+// InputError ввод отклонён проверкой шага, шаг нужно повторить
+type InputError struct {
+	Step string
+	Err  error
+}
+
+func (e *InputError) Error() string {
+	return fmt.Sprintf("wizard: invalid input on step %s: %s", e.Step, e.Err)
+}
+
+func (e *InputError) Unwrap() error {
+	return e.Err
+}
+
+// State позиция пользователя в мастере
+type State struct {
+	Name string `json:"name"`
+	Step int    `json:"step"`
+}
+
+// Active идёт ли сейчас какой-нибудь мастер
+func (s State) Active() bool {
+	return s.Name != ""
+}
+
+type Step[T any] struct {
+	Name     string
+	Prompt   string // подсказка, которую показывают при переходе на шаг
+	Retry    string // подсказка, если Apply отклонил ввод
+	Optional bool   // шаг можно пропустить
+	// Apply проверяет ввод и записывает его в data, ошибка оставляет пользователя на этом шаге
+	Apply func(data *T, input string) error
+	// Clear вызывается при пропуске шага, чтобы убрать из data прежнее значение
+	Clear func(data *T)
+}
+
+type Wizard[T any] struct {
+	Name  string
+	Steps []Step[T]
+	Done  string // сообщение после успешного OnComplete
+	// OnComplete выполняется после последнего шага или по кнопке сохранения.
+	// При ошибке пользователь остаётся в мастере и может повторить
+	OnComplete func(ctx context.Context, data *T) error
+}
+
+// Start начинает мастер с первого шага
+func (w *Wizard[T]) Start(s *State) {
+	*s = State{Name: w.Name}
+}
+
+// Current текущий шаг пользователя
+func (w *Wizard[T]) Current(s State) (Step[T], error) {
+	if s.Name != w.Name {
+		return Step[T]{}, ErrNotActive
+	}
+	if s.Step < 0 || s.Step >= len(w.Steps) {
+		return Step[T]{}, ErrNoStep
+	}
+	return w.Steps[s.Step], nil
+}
+
+// Goto переходит на шаг name, мастер начинается, если ещё не начат
+func (w *Wizard[T]) Goto(s *State, name string) error {
+	for i, step := range w.Steps {
+		if step.Name == name {
+			*s = State{Name: w.Name, Step: i}
+			return nil
+		}
+	}
+	return ErrNoStep
+}
+
+// Input применяет ввод к текущему шагу и переходит к следующему.
+// done - мастер завершён и OnComplete выполнен
+func (w *Wizard[T]) Input(ctx context.Context, s *State, data *T, input string) (done bool, err error) {
+	step, err := w.Current(*s)
+	if err != nil {
+		return false, err
+	}
+	if step.Apply != nil {
+		if err = step.Apply(data, input); err != nil {
+			return false, &InputError{Step: step.Name, Err: err}
+		}
+	}
+	return w.next(ctx, s, data)
+}
+
+// Skip пропускает необязательный шаг
+func (w *Wizard[T]) Skip(ctx context.Context, s *State, data *T) (done bool, err error) {
+	step, err := w.Current(*s)
+	if err != nil {
+		return false, err
+	}
+	if !step.Optional {
+		return false, ErrRequired
+	}
+	if step.Clear != nil {
+		step.Clear(data)
+	}
+	return w.next(ctx, s, data)
+}
+
+// Back возвращает на предыдущий шаг, на первом шаге ничего не делает и возвращает false
+func (w *Wizard[T]) Back(s *State) bool {
+	if _, err := w.Current(*s); err != nil || s.Step == 0 {
+		return false
+	}
+	s.Step--
+	return true
+}
+
+// Complete выполняет OnComplete досрочно, не проходя оставшиеся шаги
+func (w *Wizard[T]) Complete(ctx context.Context, s *State, data *T) error {
+	if s.Name != w.Name {
+		return ErrNotActive
+	}
+	if w.OnComplete != nil {
+		if err := w.OnComplete(ctx, data); err != nil {
+			return err
+		}
+	}
+	*s = State{}
+	return nil
+}
+
+// Cancel выходит из мастера
+func (w *Wizard[T]) Cancel(s *State) {
+	*s = State{}
+}
+
+func (w *Wizard[T]) next(ctx context.Context, s *State, data *T) (bool, error) {
+	if s.Step+1 < len(w.Steps) {
+		s.Step++
+		return false, nil
+	}
+	if err := w.Complete(ctx, s, data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
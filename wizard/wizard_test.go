@@ -0,0 +1,216 @@
+package wizard
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+)
+
+type note struct {
+	Title       string
+	Description string
+	Priority    int
+	Saved       int
+}
+
+var errEmpty = errors.New("empty")
+
+// newWizard мастер заметки: обязательный заголовок, необязательные описание и приоритет
+func newWizard(complete error) *Wizard[note] {
+	return &Wizard[note]{
+		Name: "note",
+		Steps: []Step[note]{
+			{
+				Name: "title",
+				Apply: func(data *note, input string) error {
+					if input == "" {
+						return errEmpty
+					}
+					data.Title = input
+					return nil
+				},
+			},
+			{
+				Name:     "description",
+				Optional: true,
+				Apply:    func(data *note, input string) error { data.Description = input; return nil },
+				Clear:    func(data *note) { data.Description = "" },
+			},
+			{
+				Name:     "priority",
+				Optional: true,
+				Apply: func(data *note, input string) (err error) {
+					data.Priority, err = strconv.Atoi(input)
+					return err
+				},
+			},
+		},
+		OnComplete: func(ctx context.Context, data *note) error {
+			if complete != nil {
+				return complete
+			}
+			data.Saved++
+			return nil
+		},
+	}
+}
+
+func TestInput(t *testing.T) {
+	ctx := context.Background()
+	w := newWizard(nil)
+	s, data := State{}, note{}
+	w.Start(&s)
+	if !s.Active() || s.Step != 0 {
+		t.Fatalf("Start = %+v", s)
+	}
+
+	// ошибка проверки оставляет на шаге и ничего не записывает
+	done, err := w.Input(ctx, &s, &data, "")
+	var inputErr *InputError
+	if done || !errors.As(err, &inputErr) || inputErr.Step != "title" || !errors.Is(err, errEmpty) {
+		t.Fatalf("Input with invalid value = %v, %v", done, err)
+	}
+	if s.Step != 0 || data.Title != "" {
+		t.Errorf("after invalid input: %+v, %+v", s, data)
+	}
+
+	for i, input := range []string{"title", "text"} {
+		if done, err = w.Input(ctx, &s, &data, input); done || err != nil {
+			t.Fatalf("Input(%q) = %v, %v", input, done, err)
+		}
+		if s.Step != i+1 {
+			t.Errorf("Input(%q): step %d, want %d", input, s.Step, i+1)
+		}
+	}
+	if _, err = w.Input(ctx, &s, &data, "high"); !errors.As(err, &inputErr) || inputErr.Step != "priority" {
+		t.Errorf("Input of a non-number priority = %v", err)
+	}
+
+	// последний шаг завершает мастер
+	if done, err = w.Input(ctx, &s, &data, "2"); !done || err != nil {
+		t.Fatalf("Input on the last step = %v, %v", done, err)
+	}
+	if s.Active() || data != (note{Title: "title", Description: "text", Priority: 2, Saved: 1}) {
+		t.Errorf("after complete: %+v, %+v", s, data)
+	}
+
+	// без активного мастера ввод не принимается
+	if _, err = w.Input(ctx, &s, &data, "title"); !errors.Is(err, ErrNotActive) {
+		t.Errorf("Input without wizard = %v, want ErrNotActive", err)
+	}
+	other := State{Name: "other"}
+	if _, err = w.Input(ctx, &other, &data, "title"); !errors.Is(err, ErrNotActive) {
+		t.Errorf("Input in another wizard = %v, want ErrNotActive", err)
+	}
+}
+
+func TestSkip(t *testing.T) {
+	ctx := context.Background()
+	w := newWizard(nil)
+	s, data := State{}, note{Description: "old"}
+	w.Start(&s)
+
+	if done, err := w.Skip(ctx, &s, &data); done || !errors.Is(err, ErrRequired) || s.Step != 0 {
+		t.Fatalf("Skip of a required step = %v, %v, step %d", done, err, s.Step)
+	}
+	if _, err := w.Input(ctx, &s, &data, "title"); err != nil {
+		t.Fatal(err)
+	}
+	// пропуск очищает прежнее значение шага
+	if done, err := w.Skip(ctx, &s, &data); done || err != nil || s.Step != 2 || data.Description != "" {
+		t.Fatalf("Skip of an optional step = %v, %v, %+v, %+v", done, err, s, data)
+	}
+	// пропуск последнего шага завершает мастер, шаг без Clear оставляет data как есть
+	data.Priority = 5
+	if done, err := w.Skip(ctx, &s, &data); !done || err != nil {
+		t.Fatalf("Skip of the last step = %v, %v", done, err)
+	}
+	if s.Active() || data.Priority != 5 || data.Saved != 1 {
+		t.Errorf("after skip: %+v, %+v", s, data)
+	}
+}
+
+func TestBack(t *testing.T) {
+	w := newWizard(nil)
+	s := State{}
+	if w.Back(&s) {
+		t.Error("Back without wizard = true")
+	}
+
+	w.Start(&s)
+	if w.Back(&s) || s != (State{Name: "note"}) {
+		t.Errorf("Back on the first step = true, %+v", s)
+	}
+	if err := w.Goto(&s, "priority"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []int{1, 0} {
+		if !w.Back(&s) || s.Step != want {
+			t.Errorf("Back: step %d, want %d", s.Step, want)
+		}
+	}
+	if w.Back(&s) || s.Step != 0 {
+		t.Errorf("Back past the first step: step %d", s.Step)
+	}
+}
+
+func TestGoto(t *testing.T) {
+	w := newWizard(nil)
+	s := State{}
+	// Goto начинает мастер
+	if err := w.Goto(&s, "description"); err != nil || s != (State{Name: "note", Step: 1}) {
+		t.Errorf("Goto = %v, %+v", err, s)
+	}
+	if err := w.Goto(&s, "tags"); !errors.Is(err, ErrNoStep) || s.Step != 1 {
+		t.Errorf("Goto of an unknown step = %v, %+v", err, s)
+	}
+	if _, err := w.Current(State{Name: "note", Step: 3}); !errors.Is(err, ErrNoStep) {
+		t.Errorf("Current past the last step = %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	ctx := context.Background()
+	w := newWizard(nil)
+	s, data := State{}, note{}
+	w.Start(&s)
+	if _, err := w.Input(ctx, &s, &data, "title"); err != nil {
+		t.Fatal(err)
+	}
+	w.Cancel(&s)
+	if s.Active() || data.Saved != 0 {
+		t.Errorf("after cancel: %+v, %+v", s, data)
+	}
+	if err := w.Complete(ctx, &s, &data); !errors.Is(err, ErrNotActive) {
+		t.Errorf("Complete after cancel = %v, want ErrNotActive", err)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	ctx := context.Background()
+	w := newWizard(nil)
+	s, data := State{}, note{}
+	w.Start(&s)
+	if _, err := w.Input(ctx, &s, &data, "title"); err != nil {
+		t.Fatal(err)
+	}
+	// досрочное сохранение не проходит оставшиеся шаги
+	if err := w.Complete(ctx, &s, &data); err != nil || s.Active() || data.Saved != 1 {
+		t.Errorf("Complete = %v, %+v, %+v", err, s, data)
+	}
+
+	// ошибка OnComplete оставляет пользователя в мастере
+	errSave := errors.New("save failed")
+	w = newWizard(errSave)
+	w.Start(&s)
+	if err := w.Goto(&s, "priority"); err != nil {
+		t.Fatal(err)
+	}
+	if done, err := w.Input(ctx, &s, &data, "1"); done || !errors.Is(err, errSave) || s.Step != 2 {
+		t.Errorf("Input with failing OnComplete = %v, %v, %+v", done, err, s)
+	}
+	if err := w.Complete(ctx, &s, &data); !errors.Is(err, errSave) || !s.Active() {
+		t.Errorf("Complete with failing OnComplete = %v, %+v", err, s)
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/playmixer/bot-note/models"
+	"github.com/playmixer/bot-note/wizard"
+	tg "github.com/playmixer/telegram-bot-api/v3"
+)
+
+var (
+	errInvalidUrl = errors.New("invalid url")
+	errEmptyInput = errors.New("empty input")
+)
+
+// noteSteps шаги заполнения заметки, общие для создания и редактирования.
+// При создании пропущенный шаг очищает поле, при редактировании оставляет прежнее значение
+func noteSteps(titlePrompt string, edit bool) []wizard.Step[User] {
+	steps := []wizard.Step[User]{
+		{
+			Name:     "title",
+			Prompt:   titlePrompt,
+			Optional: edit,
+			Apply: func(u *User, input string) error {
+				u.Add(input)
+				return nil
+			},
+		},
+		{
+			Name:     "url",
+			Prompt:   "Введите ссылку:",
+			Retry:    "Не корректная ссылка, введите ссылку:",
+			Optional: true,
+			Apply: func(u *User, input string) error {
+				if _, err := url.ParseRequestURI(input); err != nil {
+					return errInvalidUrl
+				}
+				u.AddUrl(input)
+				return nil
+			},
+			Clear: func(u *User) {
+				u.AddUrl("")
+			},
+		},
+		{
+			Name:     "description",
+			Prompt:   "Введите описание:",
+			Optional: true,
+			Apply: func(u *User, input string) error {
+				u.AddDescription(input)
+				return nil
+			},
+			Clear: func(u *User) {
+				u.AddDescription("")
+			},
+		},
+		{
+			Name:     "tags",
+			Prompt:   "Введите теги (через пробел):",
+			Optional: true,
+			Apply: func(u *User, input string) error {
+				u.AddTags(strings.Split(input, " "))
+				return nil
+			},
+			Clear: func(u *User) {
+				u.AddTags(nil)
+			},
+		},
+	}
+	if edit {
+		for i := range steps {
+			steps[i].Clear = nil
+		}
+	}
+	return steps
+}
+
+var newNoteWizard = &wizard.Wizard[User]{
+	Name:  "new_note",
+	Steps: noteSteps("Введите название заметки:", false),
+	Done:  "Заметка сохранена",
+	OnComplete: func(ctx context.Context, u *User) error {
+		_, err := storage.NewNote(ctx, u.Id, u.Note.Name, u.Note.URL, u.Note.Description, u.Note.Tags)
+		if err != nil {
+			return err
+		}
+		return u.SaveNote()
+	},
+}
+
+var editNoteWizard = &wizard.Wizard[User]{
+	Name:  "edit_note",
+	Steps: noteSteps("Введите название:", true),
+	Done:  "Заметка обновлена",
+	OnComplete: func(ctx context.Context, u *User) error {
+		return storage.UpdNote(ctx, models.Note{
+			Id:          u.Note.Id,
+			UserId:      u.Id,
+			Title:       u.Note.Name,
+			Url:         u.Note.URL,
+			Description: u.Note.Description,
+		}, u.Note.Tags)
+	},
+}
+
+var checklistWizard = &wizard.Wizard[User]{
+	Name: "checklist",
+	Steps: []wizard.Step[User]{
+		{
+			Name:   "items",
+			Prompt: "Отправьте пункты списка, каждый с новой строки:",
+			Apply: func(u *User, input string) error {
+				u.Note.Items = []string{}
+				for _, line := range strings.Split(input, "\n") {
+					if line = strings.TrimSpace(line); line != "" {
+						u.Note.Items = append(u.Note.Items, line)
+					}
+				}
+				if len(u.Note.Items) == 0 {
+					return errEmptyInput
+				}
+				return nil
+			},
+		},
+	},
+	Done: "Пункты добавлены",
+	OnComplete: func(ctx context.Context, u *User) error {
+		return storage.AddChecklistItems(ctx, u.Id, u.Note.Id, u.Note.Items)
+	},
+}
+
+// wizards все мастера по имени, имя хранится в User.Wizard
+var wizards = map[string]*wizard.Wizard[User]{
+	newNoteWizard.Name:   newNoteWizard,
+	editNoteWizard.Name:  editNoteWizard,
+	checklistWizard.Name: checklistWizard,
+}
+
+// startWizard начинает мастер w с шага step, пустой step - с первого шага
+func startWizard(user *User, w *wizard.Wizard[User], step string) error {
+	user.Status = USER_STATUS_WIZARD
+	if step == "" {
+		w.Start(&user.Wizard)
+		return nil
+	}
+	return w.Goto(&user.Wizard, step)
+}
+
+// activeWizard мастер, который сейчас заполняет пользователь
+func activeWizard(user *User) *wizard.Wizard[User] {
+	if user.Status != USER_STATUS_WIZARD {
+		return nil
+	}
+	return wizards[user.Wizard.Name]
+}
+
+// wizardKeyboard кнопки для текущего шага мастера
+func wizardKeyboard(user *User) (tg.InlineKeyboardMarkup, error) {
+	switch user.Wizard.Name {
+	case newNoteWizard.Name:
+		if user.Wizard.Step == 0 {
+			return KeyboardWizard(user)
+		}
+		return KeyboardNewNote(user)
+	case editNoteWizard.Name:
+		return KeyboardEditNote(user)
+	}
+	return KeyboardWizard(user)
+}
+
+// wizardDoneKeyboard кнопки под сообщением о завершении мастера
+func wizardDoneKeyboard(user *User, w *wizard.Wizard[User]) tg.InlineKeyboardMarkup {
+	keyboard := tg.InlineMarkup()
+	if w == checklistWizard {
+		btnShow := keyboard.Button(user.T("📋 Открыть заметку")).SetCallbackData(user.Callback(CB_ROUTE_SHOW, user.Note.Id))
+		keyboard.Add([]tg.InlineKeyboardButton{*btnShow})
+	}
+	return keyboard
+}
+
+// wizardPrompt отправляет подсказку текущего шага мастера
+func wizardPrompt(user *User, chatId int64, bot *tg.TelegramBot) {
+	w := activeWizard(user)
+	if w == nil {
+		return
+	}
+	step, err := w.Current(user.Wizard)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v wizard %s error: %s", user.Id, user.Wizard.Name, err))
+		return
+	}
+	keyboard, err := wizardKeyboard(user)
+	if err != nil {
+		log.ERROR(fmt.Sprintf("%v keyboard error: %e", user.Id, err))
+		return
+	}
+	msg := bot.SendMessage(chatId, user.T(step.Prompt), keyboard.Option())
+	if !msg.Ok {
+		log.ERROR(msg.Description)
+	}
+}
+
+// wizardInput передаёт текст пользователя текущему шагу мастера
+func wizardInput(ctx context.Context, user *User, chatId int64, text string, bot *tg.TelegramBot) {
+	w := activeWizard(user)
+	if w == nil {
+		return
+	}
+	done, err := w.Input(ctx, &user.Wizard, user, text)
+	wizardResult(user, w, chatId, done, err, bot)
+}
+
+// wizardComplete завершает мастер досрочно, например по кнопке "Сохранить"
+func wizardComplete(ctx context.Context, user *User, w *wizard.Wizard[User], chatId int64, bot *tg.TelegramBot) {
+	if activeWizard(user) != w {
+		startWizard(user, w, "")
+	}
+	err := w.Complete(ctx, &user.Wizard, user)
+	wizardResult(user, w, chatId, err == nil, err, bot)
+}
+
+// wizardResult сообщает пользователю итог шага: ошибку ввода, завершение или следующий шаг
+func wizardResult(user *User, w *wizard.Wizard[User], chatId int64, done bool, err error, bot *tg.TelegramBot) {
+	var inputErr *wizard.InputError
+	switch {
+	case errors.As(err, &inputErr):
+		step, _ := w.Current(user.Wizard)
+		text := step.Retry
+		if text == "" {
+			text = step.Prompt
+		}
+		keyboard, _ := wizardKeyboard(user)
+		bot.SendMessage(chatId, user.T(text), keyboard.Option())
+	case errors.Is(err, models.ErrNotFound):
+		// заметку удалили, пока шёл мастер: продолжать нечего
+		cancelWizard(user)
+		bot.SendMessage(chatId, user.T("Заметка не найдена"))
+	case err != nil:
+		log.ERROR(fmt.Sprintf("%v wizard %s error: %s", user.Id, w.Name, err))
+		bot.SendMessage(chatId, user.T("Ошибка на сервере"))
+	case done:
+		user.Status = USER_STATUS_NONE
+		log.INFO(fmt.Sprintf("%v wizard %s completed", chatId, w.Name))
+		keyboard := wizardDoneKeyboard(user, w)
+		msg := bot.SendMessage(chatId, user.T(w.Done), keyboard.Option())
+		if !msg.Ok {
+			log.ERROR(msg.Description)
+		}
+	default:
+		wizardPrompt(user, chatId, bot)
+	}
+}
+
+// wizardSkip пропускает текущий шаг, если он необязательный
+func wizardSkip(ctx context.Context, user *User, chatId int64, bot *tg.TelegramBot) {
+	w := activeWizard(user)
+	if w == nil {
+		return
+	}
+	done, err := w.Skip(ctx, &user.Wizard, user)
+	if errors.Is(err, wizard.ErrRequired) {
+		bot.SendMessage(chatId, user.T("Этот шаг нельзя пропустить"))
+		return
+	}
+	wizardResult(user, w, chatId, done, err, bot)
+}
+
+// wizardBack возвращает на предыдущий шаг, введённые значения остаются в черновике
+func wizardBack(user *User, chatId int64, bot *tg.TelegramBot) {
+	w := activeWizard(user)
+	if w == nil {
+		return
+	}
+	w.Back(&user.Wizard)
+	wizardPrompt(user, chatId, bot)
+}
+
+// cancelWizard выходит из мастера и выбрасывает черновик заметки,
+// возвращает false, если мастер не был начат
+func cancelWizard(user *User) bool {
+	w := activeWizard(user)
+	if w == nil {
+		return false
+	}
+	w.Cancel(&user.Wizard)
+	user.Status = USER_STATUS_NONE
+	user.Note = Note{}
+	return true
+}